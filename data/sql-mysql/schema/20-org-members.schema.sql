@@ -0,0 +1,10 @@
+CREATE TABLE `org_members` (
+  `org_id` INT(10) NOT NULL,
+  `user_id` INT(10) NOT NULL,
+  `role` VARCHAR(16) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT `org_members_key` PRIMARY KEY ( `org_id`, `user_id` ),
+  CONSTRAINT `org_members_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  CONSTRAINT `org_members_ref_users` FOREIGN KEY ( `user_id` ) REFERENCES `users` ( `id` ),
+  INDEX `org_members_user_idx` ( `user_id` )
+);
@@ -0,0 +1,3 @@
+-- Org legal IDs are stored encrypted (see 'legalid.go'), which needs more room
+-- than a plaintext SSN or EIN.
+ALTER TABLE `users` MODIFY `legal_id` VARCHAR(255);
@@ -0,0 +1,13 @@
+CREATE TABLE `org_audit` (
+  `id` INT(10) NOT NULL AUTO_INCREMENT,
+  `org_id` INT(10) NOT NULL,
+-- the auth ID of the actor, if known
+  `actor` VARCHAR(128),
+  `action` VARCHAR(16) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+-- JSON array of field changes; legal IDs are masked
+  `changes` TEXT NOT NULL,
+  CONSTRAINT `org_audit_key` PRIMARY KEY ( `id` ),
+  CONSTRAINT `org_audit_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  INDEX `org_audit_org_idx` ( `org_id`, `id` )
+);
@@ -0,0 +1,10 @@
+CREATE TABLE `org_versions` (
+  `id` INT(10) NOT NULL AUTO_INCREMENT,
+  `org_id` INT(10) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+-- JSON snapshot of the Org, including addresses; legal IDs are encrypted
+  `snapshot` TEXT NOT NULL,
+  CONSTRAINT `org_versions_key` PRIMARY KEY ( `id` ),
+  CONSTRAINT `org_versions_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  INDEX `org_versions_org_idx` ( `org_id`, `created_at` )
+);
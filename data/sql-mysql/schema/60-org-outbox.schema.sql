@@ -0,0 +1,31 @@
+CREATE TABLE `org_outbox` (
+  `id` INT(10) NOT NULL AUTO_INCREMENT,
+  `event_type` VARCHAR(32) NOT NULL,
+  `org_id` INT(10) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+-- JSON of the Org after the change; legal IDs are masked
+  `payload` TEXT NOT NULL,
+  `attempts` INT(10) NOT NULL DEFAULT 0,
+  `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `delivered_at` TIMESTAMP NULL,
+-- set when the event is dead-lettered
+  `failed_at` TIMESTAMP NULL,
+  `last_error` VARCHAR(1024),
+  CONSTRAINT `org_outbox_key` PRIMARY KEY ( `id` ),
+  CONSTRAINT `org_outbox_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  INDEX `org_outbox_pending_idx` ( `delivered_at`, `failed_at`, `next_attempt_at` )
+);
+-- the sinks which have accepted each event, so retries skip them
+CREATE TABLE `org_outbox_sinks` (
+  `event_id` INT(10) NOT NULL,
+  `sink` VARCHAR(64) NOT NULL,
+  `accepted_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT `org_outbox_sinks_key` PRIMARY KEY ( `event_id`, `sink` ),
+  CONSTRAINT `org_outbox_sinks_ref_outbox` FOREIGN KEY ( `event_id` ) REFERENCES `org_outbox` ( `id` )
+);
+-- the single row records the ID through which events have been pruned
+CREATE TABLE `org_outbox_pruned` (
+  `id` TINYINT NOT NULL DEFAULT 1,
+  `through_id` INT(10) NOT NULL,
+  CONSTRAINT `org_outbox_pruned_key` PRIMARY KEY ( `id` )
+);
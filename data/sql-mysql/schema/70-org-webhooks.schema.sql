@@ -0,0 +1,33 @@
+CREATE TABLE `org_webhooks` (
+  `id` INT(10) NOT NULL AUTO_INCREMENT,
+  `url` VARCHAR(255) NOT NULL,
+-- comma separated event types
+  `event_types` VARCHAR(255) NOT NULL,
+-- null for webhooks covering all orgs
+  `org_id` INT(10),
+-- encrypted as are legal IDs
+  `secret` VARCHAR(512) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT `org_webhooks_key` PRIMARY KEY ( `id` ),
+  CONSTRAINT `org_webhooks_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` )
+);
+CREATE TABLE `org_webhook_deliveries` (
+  `id` INT(10) NOT NULL AUTO_INCREMENT,
+  `webhook_id` INT(10) NOT NULL,
+  `event_id` INT(10) NOT NULL,
+  `event_type` VARCHAR(32) NOT NULL,
+-- JSON of the changed Org as sent
+  `payload` TEXT NOT NULL,
+  `attempts` INT(10) NOT NULL DEFAULT 0,
+  `next_attempt_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_status` INT(10),
+  `last_error` VARCHAR(1024),
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `delivered_at` TIMESTAMP NULL,
+  `failed_at` TIMESTAMP NULL,
+  CONSTRAINT `org_webhook_deliveries_key` PRIMARY KEY ( `id` ),
+  CONSTRAINT `org_webhook_deliveries_ref_webhooks` FOREIGN KEY ( `webhook_id` ) REFERENCES `org_webhooks` ( `id` ),
+  CONSTRAINT `org_webhook_deliveries_ref_outbox` FOREIGN KEY ( `event_id` ) REFERENCES `org_outbox` ( `id` ),
+  UNIQUE INDEX `org_webhook_deliveries_event_idx` ( `webhook_id`, `event_id` ),
+  INDEX `org_webhook_deliveries_pending_idx` ( `delivered_at`, `failed_at`, `next_attempt_at` )
+);
@@ -0,0 +1,13 @@
+CREATE TABLE `org_search` (
+  `org_id` INT(10) NOT NULL,
+  `name` VARCHAR(128),
+  `summary` VARCHAR(512),
+-- email and homepage
+  `contact` VARCHAR(512),
+-- city and state of each address
+  `place` VARCHAR(1024),
+  CONSTRAINT `org_search_key` PRIMARY KEY ( `org_id` ),
+  CONSTRAINT `org_search_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  FULLTEXT INDEX `org_search_text_idx` ( `name`, `summary`, `contact`, `place` ),
+  FULLTEXT INDEX `org_search_name_idx` ( `name` )
+);
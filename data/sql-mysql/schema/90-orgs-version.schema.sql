@@ -0,0 +1,4 @@
+-- The version is incremented by every write to an Org and backs the ETag (see
+-- 'etag.go'). Unlike 'entities.last_updated', which has second resolution, it
+-- distinguishes writes made in the same second.
+ALTER TABLE `orgs` ADD COLUMN `version` INT(10) NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+-- Org phones are stored in E.164 with an optional 'x' extension, as normalized
+-- by the API (see 'phone.go'). The trigger, which strips everything but the
+-- digits, would mangle both, and the longest such number needs 24 characters.
+DROP TRIGGER IF EXISTS `orgs_phone_format`;
+ALTER TABLE `orgs` MODIFY `phone` VARCHAR(24);
+-- Phones stored before now are ten digit US numbers.
+UPDATE `orgs` SET `phone`=CONCAT('+1', `phone`) WHERE `phone` REGEXP '^[0-9]{10}$';
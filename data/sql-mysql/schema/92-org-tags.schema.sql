@@ -0,0 +1,8 @@
+-- Free-form labels on orgs, normalized by the API (see 'tags.go').
+CREATE TABLE `org_tags` (
+  `org_id` INT(10) NOT NULL,
+  `tag` VARCHAR(64) NOT NULL,
+  CONSTRAINT `org_tags_key` PRIMARY KEY ( `org_id`, `tag` ),
+  CONSTRAINT `org_tags_ref_orgs` FOREIGN KEY ( `org_id` ) REFERENCES `orgs` ( `id` ),
+  INDEX `org_tags_tag_idx` ( `tag` )
+);
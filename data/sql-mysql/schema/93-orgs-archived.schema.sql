@@ -0,0 +1,5 @@
+-- Archived orgs are soft-deleted (see 'ArchiveOrg'). Archiving deactivates the
+-- org's user, so the user's prior 'active' flag is kept for the restore.
+ALTER TABLE `orgs`
+  ADD COLUMN `archived_at` TIMESTAMP NULL,
+  ADD COLUMN `archived_active` BOOLEAN NULL;
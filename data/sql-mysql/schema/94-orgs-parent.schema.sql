@@ -0,0 +1,4 @@
+-- Orgs may be arranged in a hierarchy (see 'hierarchy.go').
+ALTER TABLE `orgs`
+  ADD COLUMN `parent_id` INT(10),
+  ADD CONSTRAINT `orgs_ref_parent` FOREIGN KEY ( `parent_id` ) REFERENCES `orgs` ( `id` );
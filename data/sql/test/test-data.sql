@@ -7,4 +7,10 @@ INSERT INTO entities (pub_id) VALUES ('E9EB036A-0194-4AD4-B598-2412FB9C8F5B');
 -- 4) source template.vars; for $TEMPLATE in ...; do ...; eval "$(cat "$TEMPLATE")" > $SQL_FILE; done
 SET @some_org_id=LAST_INSERT_ID();
 INSERT INTO users (id, auth_id, active) VALUES (@some_org_id,'abcdefg123',0);
-INSERT INTO orgs (id, display_name, summary, phone, email) VALUES (@some_org_id,'Some Org','Builders of things.','5555551111','janedoe@test.com');
+INSERT INTO orgs (id, display_name, summary, phone, email) VALUES (@some_org_id,'Some Org','Builders of things.','+12025551111','janedoe@test.com');
+INSERT INTO entities (pub_id) VALUES ('5B4E9F2C-6D2A-4C41-9A0E-3F5C2D7B8A11');
+SET @some_member_id=LAST_INSERT_ID();
+INSERT INTO users (id, auth_id, active) VALUES (@some_member_id,'hijklmn456',1);
+INSERT INTO entities (pub_id) VALUES ('0C7D3E5A-8B1F-4E6D-A2C9-7F4B1D3E5A60');
+SET @other_member_id=LAST_INSERT_ID();
+INSERT INTO users (id, auth_id, active) VALUES (@other_member_id,'opqrstu789',1);
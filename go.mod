@@ -7,7 +7,9 @@ require (
 	github.com/Liquid-Labs/go-nullable-mysql v1.0.2
 	github.com/Liquid-Labs/go-rest v1.0.0-prototype.2
 	github.com/gorilla/mux v1.7.0
+	github.com/nyaruka/phonenumbers v1.1.1
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/text v0.3.7
 )
 
 replace github.com/Liquid-Labs/catalyst-core-api => /Users/zane/playground/catalyst-core-api
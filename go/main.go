@@ -1,6 +1,10 @@
 package main
 
 import (
+  "context"
+  "log"
+  "os"
+
   "github.com/Liquid-Labs/catalyst-core-api/go/restserv"
   // core resources
   "github.com/Liquid-Labs/catalyst-core-api/go/resources/entities"
@@ -17,6 +21,30 @@ func main() {
   sqldb.RegisterSetup(users.SetupDB)
   sqldb.RegisterSetup(orgs.SetupDB)
   sqldb.InitDB()
+  if restErr := orgs.BackfillVersions(context.Background()); restErr != nil {
+    log.Fatalf("Could not backfill org versions: %s", restErr)
+  }
+  if restErr := orgs.BackfillSearchDocs(context.Background()); restErr != nil {
+    log.Fatalf("Could not backfill org search documents: %s", restErr)
+  }
+  orgs.Subscribe(`webhooks`, orgs.WebhookSink{})
+  go orgs.DefaultDispatcher.Run(context.Background())
+  go orgs.NewWebhookDeliverer().Run(context.Background())
+  go orgs.DefaultEventStream.Run(context.Background())
+  go orgs.NewEventPruner().Run(context.Background())
+  if path := os.Getenv(orgs.SearchIndexPathEnv); path != `` {
+    index, err := orgs.OpenDiskIndex(path)
+    if err != nil {
+      log.Fatalf("Could not open org search index '%s': %s", path, err)
+    }
+    if index.LastEventId() == 0 {
+      if err := orgs.RebuildSearchIndex(index, context.Background()); err != nil {
+        log.Fatalf("Could not build org search index: %s", err)
+      }
+    }
+    orgs.SetSearchIndex(index)
+    go orgs.NewSearchIndexer(index).Run(context.Background())
+  }
   restserv.RegisterResource(orgs.InitAPI)
   restserv.Init()
 }
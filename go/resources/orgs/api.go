@@ -1,47 +1,802 @@
 package orgs
 
 import (
+  "context"
   "fmt"
+  "io"
+  "io/ioutil"
+  "log"
   "net/http"
+  "strconv"
+  "strings"
+  "time"
 
   "github.com/gorilla/mux"
 
   "github.com/Liquid-Labs/catalyst-core-api/go/handlers"
+  "github.com/Liquid-Labs/catalyst-firewrap/go/fireauth"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
 )
 
 func pingHandler(w http.ResponseWriter, r *http.Request) {
   fmt.Fprint(w, "/orgs is alive\n")
 }
 
+// withPrincipal attributes the changes made in handling the request to the
+// Principal, who is also authorized for any other Orgs the changes touch. See
+// WithActor and WithPrincipal.
+func withPrincipal(r *http.Request, principal *Principal) *http.Request {
+  ctx := WithActor(r.Context(), principal.AuthId)
+  return r.WithContext(WithPrincipal(ctx, principal))
+}
+
+// authorizeRequest checks that the Principal making the request may perform
+// the action on the Org. The Org public ID is empty for ActionCreate and
+// ActionList. Any error response is handled.
+func authorizeRequest(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, action Action, pubID string) (*Principal, rest.RestError) {
+  principal, restErr := PrincipalFromClient(authClient)
+  if restErr == nil {
+    restErr = Authorize(principal, pubID, action, r.Context())
+  }
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return nil, restErr
+  }
+
+  return principal, nil
+}
+
 func createHandler(w http.ResponseWriter, r *http.Request) {
+  r = withPhoneRegion(r)
   var org *Org = &Org{}
-  if _, restErr := handlers.CheckAndExtract(w, r, org, `Org`); restErr != nil {
+  if authClient, restErr := handlers.CheckAndExtract(w, r, org, `Org`); restErr != nil {
     return // response handled by CheckAndExtract
+  } else if principal, restErr := authorizeRequest(w, r, authClient, ActionCreate, ``); restErr != nil {
+    return // response handled by authorizeRequest
+  } else if restErr := org.Validate(r.Context()); restErr != nil {
+    rest.HandleError(w, restErr)
+  } else if reveal, restErr := legalIDReveal(w, r, authClient, ``); restErr != nil {
+    return // response handled by legalIDReveal
   } else {
-    handlers.DoCreate(w, r, CreateOrg, org, `Org`)
+    r = withPrincipal(r, principal)
+    create := func(o *Org, ctx context.Context) (*Org, rest.RestError) {
+      org, restErr := CreateOrg(o, ctx)
+      return redactOrg(org, restErr, reveal)
+    }
+    handlers.DoCreate(w, r, create, org, `Org`)
+  }
+}
+
+// legalIDReveal determines whether the response may carry the unmasked legal
+// ID, which is only the case when requested with 'revealLegalID=true' by a
+// Principal authorized for ActionRevealLegalID. Any error response is
+// handled.
+func legalIDReveal(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, pubID string) (bool, rest.RestError) {
+  if r.URL.Query().Get(`revealLegalID`) != `true` {
+    return false, nil
+  }
+  if _, restErr := authorizeRequest(w, r, authClient, ActionRevealLegalID, pubID); restErr != nil {
+    return false, restErr
+  }
+
+  return true, nil
+}
+
+// redactOrg masks the legal ID of a successfully retrieved or updated Org
+// unless it is to be revealed.
+func redactOrg(org *Org, restErr rest.RestError, reveal bool) (*Org, rest.RestError) {
+  if restErr == nil && !reveal {
+    org.RedactLegalID()
+  }
+  return org, restErr
+}
+
+// extractListParams reads the 'sort', 'search', 'searchMode', 'offset',
+// 'limit', 'cursor', 'includeArchived', 'near', 'radius', and 'bbox' query
+// parameters, along with the 'state', 'city', and 'tag' (all of which may be
+// repeated), 'active', and 'hasLogo' filters, the 'filter' expression, and
+// the comma separated 'facets'. The presence of 'cursor', even if empty,
+// selects cursor mode, and 'searchMode=fulltext' selects full-text search.
+func extractListParams(r *http.Request) (*ListParams, rest.RestError) {
+  query := r.URL.Query()
+  params := &ListParams{
+    Sort: query.Get(`sort`),
+    Search: query.Get(`search`),
+    IncludeArchived: includeArchived(r),
+  }
+  switch mode := query.Get(`searchMode`); mode {
+  case ``, `general`:
+  case `fulltext`:
+    params.FullText = true
+  default:
+    return nil, rest.BadRequestError(fmt.Sprintf(`Unknown search mode '%s'.`, mode), nil)
+  }
+  if cursor, ok := query[`cursor`]; ok {
+    params.CursorMode = true
+    params.Cursor = cursor[0]
+  }
+  var err error
+  if offset := query.Get(`offset`); offset != `` {
+    if params.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid offset '%s'.`, offset), err)
+    }
+  }
+  if limit := query.Get(`limit`); limit != `` {
+    if params.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid limit '%s'.`, limit), err)
+    }
+  }
+  if near := query.Get(`near`); near != `` {
+    if params.Near, err = ParseGeoPoint(near); err != nil {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid near point '%s'.`, near), err)
+    }
+  }
+  if radius := query.Get(`radius`); radius != `` {
+    if params.Near == nil {
+      return nil, rest.BadRequestError(`'radius' requires a 'near' point.`, nil)
+    }
+    if params.Radius, err = ParseDistance(radius); err != nil {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid radius '%s'.`, radius), err)
+    }
+  }
+  if bbox := query.Get(`bbox`); bbox != `` {
+    if params.BBox, err = ParseBBox(bbox); err != nil {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid bounding box '%s'.`, bbox), err)
+    }
+  }
+  params.Filters.States, params.Filters.Cities, params.Filters.Tags = query[`state`], query[`city`], query[`tag`]
+  params.Filter = query.Get(`filter`)
+  if params.Filters.Active, err = boolParam(r, `active`); err != nil {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Invalid active filter '%s'.`, query.Get(`active`)), err)
+  }
+  if params.Filters.HasLogo, err = boolParam(r, `hasLogo`); err != nil {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Invalid hasLogo filter '%s'.`, query.Get(`hasLogo`)), err)
+  }
+  if facets := query.Get(`facets`); facets != `` {
+    params.Facets = strings.Split(facets, `,`)
+  }
+
+  return params, nil
+}
+
+// boolParam reads an optional boolean query parameter, which is null when
+// absent or empty.
+func boolParam(r *http.Request, name string) (nulls.Bool, error) {
+  value := r.URL.Query().Get(name)
+  if value == `` {
+    return nulls.NewNullBool(), nil
+  }
+  b, err := strconv.ParseBool(value)
+  if err != nil {
+    return nulls.NewNullBool(), err
+  }
+
+  return nulls.NewBool(b), nil
+}
+
+// includeArchived is true when the request carries 'includeArchived=true'.
+func includeArchived(r *http.Request) bool {
+  return r.URL.Query().Get(`includeArchived`) == `true`
+}
+
+func listHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if _, restErr := authorizeRequest(w, r, authClient, ActionList, ``); restErr != nil {
+    return // response handled by authorizeRequest
+  } else {
+    params, restErr := extractListParams(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    page, restErr := ListOrgs(params, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, page, `Orgs retrieved.`, nil)
   }
 }
 
 func detailHandler(w http.ResponseWriter, r *http.Request) {
-  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
     return // response handled by BasicAuthCheck
   } else {
     vars := mux.Vars(r)
     pubID := vars["pubId"]
+    if _, restErr := authorizeRequest(w, r, authClient, ActionRead, pubID); restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    reveal, restErr := legalIDReveal(w, r, authClient, pubID)
+    if restErr != nil {
+      return // response handled by legalIDReveal
+    }
+    if asOf := r.URL.Query().Get(`asOf`); asOf != `` {
+      detailAsOf(w, r, authClient, pubID, asOf, reveal)
+      return
+    }
+
+    get := GetOrg
+    if includeArchived(r) {
+      get = GetOrgIncludingArchived
+    }
+
+    handlers.DoGetDetail(w, r, getWithETag(w, get, reveal), pubID, `Org`)
+  }
+}
+
+// detailAsOf handles detail requests for a past state of an Org. Past states
+// are part of the Org history and carry no ETag, as they cannot be updated.
+func detailAsOf(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, pubID string, asOf string, reveal bool) {
+  if _, restErr := authorizeRequest(w, r, authClient, ActionReadHistory, pubID); restErr != nil {
+    return // response handled by authorizeRequest
+  }
+  at, err := ParseAsOf(asOf)
+  if err != nil {
+    rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Invalid asOf '%s'.`, asOf), err))
+    return
+  }
+  get := func(id string, ctx context.Context) (*Org, rest.RestError) {
+    org, restErr := GetOrgAsOf(id, at, ctx)
+    return redactOrg(org, restErr, reveal)
+  }
+
+  handlers.DoGetDetail(w, r, get, pubID, `Org`)
+}
 
-    handlers.DoGetDetail(w, r, GetOrg, pubID, `Org`)
+// getWithETag wraps an Org getter so that it sets the ETag header and masks
+// the legal ID unless it is to be revealed.
+func getWithETag(w http.ResponseWriter, get func(string, context.Context) (*Org, rest.RestError), reveal bool) func(string, context.Context) (*Org, rest.RestError) {
+  return func(id string, ctx context.Context) (*Org, rest.RestError) {
+    org, restErr := get(id, ctx)
+    org, restErr = withETag(w, org, restErr, false)
+    return redactOrg(org, restErr, reveal)
+  }
+}
+
+// withETag sets the ETag header for successfully retrieved or updated Orgs.
+// Where the expected version came from an If-Match header, a version conflict
+// is reported as a failed precondition.
+func withETag(w http.ResponseWriter, org *Org, restErr rest.RestError, ifMatch bool) (*Org, rest.RestError) {
+  if restErr != nil {
+    if ifMatch && restErr.Code() == http.StatusConflict {
+      return nil, preconditionFailedError(restErr.Error(), restErr.Cause())
+    }
+    return nil, restErr
+  }
+  w.Header().Set(`ETag`, ETag(&org.OrgSummary))
+
+  return org, nil
+}
+
+// extractIfMatch processes the If-Match header, handling the error response if
+// the header is not understood.
+func extractIfMatch(w http.ResponseWriter, r *http.Request) (nulls.Int64, rest.RestError) {
+  version, err := ParseIfMatch(r.Header.Get(`If-Match`))
+  if err != nil {
+    restErr := preconditionFailedError(`Could not process 'If-Match' header.`, err)
+    rest.HandleError(w, restErr)
+    return version, restErr
+  }
+
+  return version, nil
+}
+
+// archiveStateHandler generates handlers for archiving and restoring Orgs.
+func archiveStateHandler(op func(string, context.Context) (*Org, rest.RestError), msg string) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+      return // response handled by BasicAuthCheck
+    } else {
+      vars := mux.Vars(r)
+      pubID := vars["pubId"]
+      principal, restErr := authorizeRequest(w, r, authClient, ActionDelete, pubID)
+      if restErr != nil {
+        return // response handled by authorizeRequest
+      }
+      r = withPrincipal(r, principal)
+
+      org, restErr := op(pubID, r.Context())
+      if restErr != nil {
+        rest.HandleError(w, restErr)
+        return
+      }
+      org.RedactLegalID()
+
+      rest.StandardResponse(w, org, msg, nil)
+    }
+  }
+}
+
+// maxImportBytes limits the size of a bulk import request body.
+const maxImportBytes = 32 << 20
+
+// importFormat determines the import format from the 'format' query parameter
+// or, failing that, the request content type.
+func importFormat(r *http.Request) (ImportFormat, rest.RestError) {
+  name := r.URL.Query().Get(`format`)
+  if name == `` {
+    switch strings.Split(r.Header.Get(`Content-Type`), `;`)[0] {
+    case `text/csv`:
+      name = string(ImportCSV)
+    case `application/x-ndjson`, `application/ndjson`:
+      name = string(ImportNDJSON)
+    }
+  }
+  format, err := ParseImportFormat(name)
+  if err != nil {
+    return ``, rest.BadRequestError(`Could not determine import format.`, err)
+  }
+
+  return format, nil
+}
+
+func importHandler(w http.ResponseWriter, r *http.Request) {
+  r = withPhoneRegion(r)
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if principal, restErr := authorizeRequest(w, r, authClient, ActionCreate, ``); restErr != nil {
+    return // response handled by authorizeRequest
+  } else {
+    r = withPrincipal(r, principal)
+    format, restErr := importFormat(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+    query := r.URL.Query()
+    opts := &ImportOptions{
+      Format: format,
+      DryRun: query.Get(`dryRun`) == `true`,
+      Atomic: query.Get(`atomic`) == `true`,
+    }
+
+    body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+    defer body.Close()
+    report, restErr := ImportOrgs(body, opts, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, report, fmt.Sprintf(`Imported %d orgs with %d failures.`, report.Created, report.Failed), nil)
+  }
+}
+
+// exportContentTypes maps each export format to its response content type.
+var exportContentTypes = map[ExportFormat]string{
+  ExportCSV: `text/csv; charset=utf-8`,
+  ExportNDJSON: `application/x-ndjson`,
+}
+
+// exportWriter notes whether any of the export has been written.
+type exportWriter struct {
+  w       io.Writer
+  started bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+  ew.started = true
+  return ew.w.Write(p)
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if _, restErr := authorizeRequest(w, r, authClient, ActionExport, ``); restErr != nil {
+    return // response handled by authorizeRequest
+  } else {
+    params, restErr := extractListParams(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+    query := r.URL.Query()
+    opts := &ExportOptions{
+      Format: ExportFormat(strings.ToLower(query.Get(`format`))),
+      ExcelCompatible: query.Get(`excel`) == `true`,
+    }
+    if opts.Format == `` {
+      opts.Format = ExportCSV
+    }
+    if columns := query.Get(`columns`); columns != `` {
+      opts.Columns = strings.Split(columns, `,`)
+    }
+    if err := ValidateExportOptions(opts); err != nil {
+      rest.HandleError(w, rest.BadRequestError(`Invalid export options.`, err))
+      return
+    }
+    for _, column := range opts.Columns {
+      if column == `legalID` {
+        if _, restErr := authorizeRequest(w, r, authClient, ActionRevealLegalID, ``); restErr != nil {
+          return // response handled by authorizeRequest
+        }
+      }
+    }
+
+    w.Header().Set(`Content-Type`, exportContentTypes[opts.Format])
+    w.Header().Set(`Content-Disposition`, fmt.Sprintf(`attachment; filename="orgs.%s"`, opts.Format))
+    out := &exportWriter{w: w}
+    if restErr := ExportOrgs(out, params, opts, r.Context()); restErr != nil {
+      if out.started {
+        // The status has already been sent, so all we can do is log.
+        log.Printf("Export failed mid-stream: %s", restErr)
+      } else {
+        w.Header().Del(`Content-Disposition`)
+        rest.HandleError(w, restErr)
+      }
+    }
+  }
+}
+
+// changesHandler serves the change feed. Summaries are available to anyone
+// who may list Orgs, while 'detail=true', which includes addresses for every
+// Org, requires ActionExport.
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    query := r.URL.Query()
+    detail := query.Get(`detail`) == `true`
+    action := ActionList
+    if detail {
+      action = ActionExport
+    }
+    if _, restErr := authorizeRequest(w, r, authClient, action, ``); restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    params, restErr := extractListParams(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    page, restErr := ListChanges(query.Get(`since`), params.Limit, detail, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, page, `Org changes retrieved.`, nil)
+  }
+}
+
+// StreamHeartbeat is the interval at which idle streams are sent a comment
+// to keep the connection alive.
+var StreamHeartbeat = 15 * time.Second
+
+// streamHandler holds open a Server-Sent Events stream of OrgSummary changes,
+// optionally filtered by 'pubId' (which may be repeated) or 'search'. Clients
+// resume after the event given by the 'Last-Event-ID' header or, as browsers
+// cannot set that on first connection, the 'lastEventId' query parameter.
+// Resuming from before the events pruned from the outbox (see
+// EventRetention) results in a 410 Gone response; the client must reload
+// and reconnect without a last event ID. Should the pruning overtake the
+// replay, the stream is closed so that the client reconnects to that.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if _, restErr := authorizeRequest(w, r, authClient, ActionList, ``); restErr != nil {
+    return // response handled by authorizeRequest
+  } else {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+      rest.HandleError(w, rest.ServerError(`Streaming not supported.`, nil))
+      return
+    }
+    query := r.URL.Query()
+    filter := NewStreamFilter(query[`pubId`], query.Get(`search`))
+    lastEventID := r.Header.Get(`Last-Event-ID`)
+    if lastEventID == `` {
+      lastEventID = query.Get(`lastEventId`)
+    }
+    var lastID int64
+    if lastEventID != `` {
+      var err error
+      if lastID, err = strconv.ParseInt(lastEventID, 10, 64); err != nil {
+        rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Invalid last event ID '%s'.`, lastEventID), err))
+        return
+      }
+      if prunedID, err := prunedEventId(r.Context()); err != nil {
+        rest.HandleError(w, rest.ServerError(`Could not read org events.`, err))
+        return
+      } else if lastID < prunedID {
+        rest.HandleError(w, goneError(`Last event ID has expired; reconnect without it.`, nil))
+        return
+      }
+    }
+
+    // Subscribe before replaying so nothing is missed in between.
+    events, cancel := DefaultEventStream.Subscribe()
+    defer cancel()
+    w.Header().Set(`Content-Type`, `text/event-stream`)
+    w.Header().Set(`Cache-Control`, `no-cache`)
+    w.Header().Set(`X-Accel-Buffering`, `no`)
+    w.WriteHeader(http.StatusOK)
+    send := func(e *Event) bool {
+      if e.Id <= lastID {
+        return true // already sent
+      }
+      lastID = e.Id
+      if !filter.Matches(e) {
+        return true
+      }
+      return WriteStreamEvent(w, e) == nil
+    }
+
+    for replaying := lastEventID != ``; replaying; {
+      fromID := lastID
+      replay, readID, err := ReplayEvents(fromID, MaxListLimit, r.Context())
+      if err != nil {
+        log.Printf("Could not replay org events: %s", err)
+        return
+      }
+      if prunedID, err := prunedEventId(r.Context()); err != nil {
+        log.Printf("Could not replay org events: %s", err)
+        return
+      } else if fromID < prunedID {
+        return // the client reconnects and is told to reload
+      }
+      for _, e := range replay {
+        if !send(e) {
+          return
+        }
+      }
+      // Skipped events move the position on too.
+      if readID > lastID {
+        lastID = readID
+      }
+      replaying = readID > fromID
+    }
+    flusher.Flush()
+
+    heartbeat := time.NewTicker(StreamHeartbeat)
+    defer heartbeat.Stop()
+    for {
+      select {
+      case <-r.Context().Done():
+        return
+      case e, ok := <-events:
+        if !ok || !send(e) {
+          return // dropped for falling behind or disconnected; the client resumes
+        }
+      case <-heartbeat.C:
+        if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+          return
+        }
+      }
+      flusher.Flush()
+    }
+  }
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    if _, restErr := authorizeRequest(w, r, authClient, ActionReadHistory, pubID); restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    params, restErr := extractListParams(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    page, restErr := ListHistory(pubID, params.Offset, params.Limit, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, page, `Org history retrieved.`, nil)
+  }
+}
+
+// hierarchyHandler generates handlers for the Org hierarchy listings.
+func hierarchyHandler(list func(string, context.Context) ([]*OrgSummary, rest.RestError), msg string) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+      return // response handled by BasicAuthCheck
+    } else {
+      vars := mux.Vars(r)
+      pubID := vars["pubId"]
+      if _, restErr := authorizeRequest(w, r, authClient, ActionRead, pubID); restErr != nil {
+        return // response handled by authorizeRequest
+      }
+
+      orgs, restErr := list(pubID, r.Context())
+      if restErr != nil {
+        rest.HandleError(w, restErr)
+        return
+      }
+
+      rest.StandardResponse(w, orgs, msg, nil)
+    }
   }
 }
 
 func updateHandler(w http.ResponseWriter, r *http.Request) {
   var newData *Org = &Org{}
-  if _, restErr := handlers.CheckAndExtract(w, r, newData, `Org`); restErr != nil {
+  if authClient, restErr := handlers.CheckAndExtract(w, r, newData, `Org`); restErr != nil {
+    return // response handled by CheckAndExtract
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    principal, restErr := authorizeRequest(w, r, authClient, ActionUpdate, pubID)
+    if restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    r = withPrincipal(r, principal)
+
+    doUpdate(w, r, authClient, newData, pubID)
+  }
+}
+
+// doUpdate processes the If-Match header and updates the Org, setting the ETag
+// of the updated Org on the response.
+func doUpdate(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, newData *Org, pubID string) {
+  r = withPhoneRegion(r)
+  if restErr := newData.Validate(r.Context()); restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+  ifMatch, restErr := extractIfMatch(w, r)
+  if restErr != nil {
+    return // response handled by extractIfMatch
+  }
+  reveal, restErr := legalIDReveal(w, r, authClient, pubID)
+  if restErr != nil {
+    return // response handled by legalIDReveal
+  }
+  update := func(o *Org, ctx context.Context) (*Org, rest.RestError) {
+    if ifMatch.Valid {
+      o.Version = ifMatch
+    }
+    org, restErr := UpdateOrg(o, ctx)
+    org, restErr = withETag(w, org, restErr, ifMatch.Valid)
+    return redactOrg(org, restErr, reveal)
+  }
+
+  handlers.DoUpdate(w, r, update, newData, pubID, `Org`)
+}
+
+// authorizeSelf resolves the Principal making the request and the Org
+// belonging to them, and checks that they may perform the action on it. Any
+// error response is handled.
+func authorizeSelf(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, action Action) (*Principal, *Org, rest.RestError) {
+  principal, restErr := PrincipalFromClient(authClient)
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return nil, nil, restErr
+  }
+  if principal.IsAnonymous() {
+    restErr = forbiddenError(`Authentication required.`, nil)
+    rest.HandleError(w, restErr)
+    return nil, nil, restErr
+  }
+  self, restErr := GetOrgByAuthId(principal.AuthId, r.Context())
+  if restErr == nil {
+    restErr = Authorize(principal, self.PubId.String, action, r.Context())
+  }
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return nil, nil, restErr
+  }
+
+  return principal, self, nil
+}
+
+func selfDetailHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if _, self, restErr := authorizeSelf(w, r, authClient, ActionRead); restErr != nil {
+    return // response handled by authorizeSelf
+  } else if reveal, restErr := legalIDReveal(w, r, authClient, self.PubId.String); restErr != nil {
+    return // response handled by legalIDReveal
+  } else {
+    handlers.DoGetDetail(w, r, getWithETag(w, GetOrgByAuthId, reveal), self.AuthId.String, `Org`)
+  }
+}
+
+func selfUpdateHandler(w http.ResponseWriter, r *http.Request) {
+  var newData *Org = &Org{}
+  if authClient, restErr := handlers.CheckAndExtract(w, r, newData, `Org`); restErr != nil {
     return // response handled by CheckAndExtract
+  } else if principal, self, restErr := authorizeSelf(w, r, authClient, ActionUpdate); restErr != nil {
+    return // response handled by authorizeSelf
+  } else {
+    r = withPrincipal(r, principal)
+    // The principal may only update their own org, whatever the payload says.
+    newData.PubId = self.PubId
+    doUpdate(w, r, authClient, newData, self.PubId.String)
+  }
+}
+
+func patchHandler(w http.ResponseWriter, r *http.Request) {
+  r = withPhoneRegion(r)
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    principal, restErr := authorizeRequest(w, r, authClient, ActionUpdate, pubID)
+    if restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    r = withPrincipal(r, principal)
+    ifMatch, restErr := extractIfMatch(w, r)
+    if restErr != nil {
+      return // response handled by extractIfMatch
+    }
+    reveal, restErr := legalIDReveal(w, r, authClient, pubID)
+    if restErr != nil {
+      return // response handled by legalIDReveal
+    }
+
+    patch, err := ioutil.ReadAll(r.Body)
+    defer r.Body.Close()
+    if err != nil {
+      rest.HandleError(w, rest.BadRequestError(`Could not read patch.`, err))
+      return
+    }
+
+    org, restErr := PatchOrg(pubID, patch, ifMatch, r.Context())
+    if org, restErr = withETag(w, org, restErr, ifMatch.Valid); restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+    if !reveal {
+      org.RedactLegalID()
+    }
+
+    rest.StandardResponse(w, org, `Org updated.`, nil)
+  }
+}
+
+func revertHandler(w http.ResponseWriter, r *http.Request) {
+  r = withPhoneRegion(r)
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
   } else {
     vars := mux.Vars(r)
     pubID := vars["pubId"]
+    principal, restErr := authorizeRequest(w, r, authClient, ActionUpdate, pubID)
+    if restErr != nil {
+      return // response handled by authorizeRequest
+    }
+    r = withPrincipal(r, principal)
+    asOf := r.URL.Query().Get(`asOf`)
+    at, err := ParseAsOf(asOf)
+    if err != nil {
+      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Invalid asOf '%s'.`, asOf), err))
+      return
+    }
+    ifMatch, restErr := extractIfMatch(w, r)
+    if restErr != nil {
+      return // response handled by extractIfMatch
+    }
+    reveal, restErr := legalIDReveal(w, r, authClient, pubID)
+    if restErr != nil {
+      return // response handled by legalIDReveal
+    }
+
+    org, restErr := RevertOrg(pubID, at, ifMatch, r.Context())
+    if org, restErr = withETag(w, org, restErr, ifMatch.Valid); restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+    if !reveal {
+      org.RedactLegalID()
+    }
 
-    handlers.DoUpdate(w, r, UpdateOrg, newData, pubID, `Org`)
+    rest.StandardResponse(w, org, `Org reverted.`, nil)
   }
 }
 
@@ -50,6 +805,23 @@ const uuidRE = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[1-5][0-9a-fA-F]{3}-[89abAB][0-9a-
 func InitAPI(r *mux.Router) {
   r.HandleFunc("/orgs/", pingHandler).Methods("PING")
   r.HandleFunc("/orgs/", createHandler).Methods("POST")
+  r.HandleFunc("/orgs/", listHandler).Methods("GET")
+  r.HandleFunc("/orgs/import/", importHandler).Methods("POST")
+  r.HandleFunc("/orgs/export/", exportHandler).Methods("GET")
+  r.HandleFunc("/orgs/changes/", changesHandler).Methods("GET")
+  r.HandleFunc("/orgs/stream/", streamHandler).Methods("GET")
+  r.HandleFunc("/orgs/self/", selfDetailHandler).Methods("GET")
+  r.HandleFunc("/orgs/self/", selfUpdateHandler).Methods("PUT")
   r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/", detailHandler).Methods("GET")
   r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/", updateHandler).Methods("PUT")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/", patchHandler).Methods("PATCH")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/", archiveStateHandler(ArchiveOrg, `Org archived.`)).Methods("DELETE")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/restore/", archiveStateHandler(RestoreOrg, `Org restored.`)).Methods("POST")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/history/", historyHandler).Methods("GET")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/revert/", revertHandler).Methods("POST")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/children/", hierarchyHandler(ListChildren, `Org children retrieved.`)).Methods("GET")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/ancestors/", hierarchyHandler(ListAncestors, `Org ancestors retrieved.`)).Methods("GET")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/subtree/", hierarchyHandler(ListSubtree, `Org subtree retrieved.`)).Methods("GET")
+  initMembersAPI(r)
+  initWebhooksAPI(r)
 }
@@ -0,0 +1,221 @@
+package orgs
+
+import (
+  "bytes"
+  "context"
+  "database/sql"
+  "encoding/json"
+  "log"
+  "sort"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// AuditAction identifies the kind of change recorded by an AuditEntry.
+type AuditAction string
+
+const (
+  AuditCreate  AuditAction = `create`
+  AuditUpdate  AuditAction = `update`
+  AuditArchive AuditAction = `archive`
+  AuditRestore AuditAction = `restore`
+)
+
+// FieldChange records the old and new JSON values of a single Org field. A
+// null value indicates the field was unset.
+type FieldChange struct {
+  Field string          `json:"field"`
+  Old   json.RawMessage `json:"old"`
+  New   json.RawMessage `json:"new"`
+}
+
+// AuditEntry records a change to an Org: who made it, when (in Unix seconds),
+// and what changed.
+type AuditEntry struct {
+  Id      int64          `json:"id"`
+  Actor   nulls.String   `json:"actor"`
+  Action  AuditAction    `json:"action"`
+  At      int64          `json:"at"`
+  Changes []*FieldChange `json:"changes"`
+}
+
+// AuditPage is a single page of AuditEntry records, most recent first, along
+// with the total number of entries for the Org.
+type AuditPage struct {
+  Items      []*AuditEntry `json:"items"`
+  TotalCount int64         `json:"totalCount"`
+  Offset     int64         `json:"offset"`
+  Limit      int64         `json:"limit"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context attributing the changes made with it to the
+// actor, identified by auth ID.
+func WithActor(ctx context.Context, actor string) context.Context {
+  return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext retrieves the actor set by WithActor, if any.
+func ActorFromContext(ctx context.Context) string {
+  actor, _ := ctx.Value(actorKey{}).(string)
+  return actor
+}
+
+// auditIgnoredFields change as a side effect of every write.
+var auditIgnoredFields = map[string]bool{
+  `lastUpdated`: true,
+  `version`: true,
+  `changeDesc`: true,
+}
+
+// auditFields renders the Org as a map of JSON field values. Legal IDs are
+// masked so the audit trail never holds them in the clear.
+func auditFields(o *Org) (map[string]json.RawMessage, error) {
+  fields := make(map[string]json.RawMessage)
+  if o == nil {
+    return fields, nil
+  }
+  masked := o.Clone()
+  masked.RedactLegalID()
+  data, err := json.Marshal(masked)
+  if err != nil {
+    return nil, err
+  }
+  if err := json.Unmarshal(data, &fields); err != nil {
+    return nil, err
+  }
+  for field := range auditIgnoredFields {
+    delete(fields, field)
+  }
+
+  return fields, nil
+}
+
+// DiffOrgs lists the fields which differ between the old and new Org, in
+// field name order. A nil Org is treated as having no fields set, so diffing
+// against nil lists all the set fields.
+func DiffOrgs(old *Org, new *Org) ([]*FieldChange, error) {
+  oldFields, err := auditFields(old)
+  if err != nil {
+    return nil, err
+  }
+  newFields, err := auditFields(new)
+  if err != nil {
+    return nil, err
+  }
+
+  names := make([]string, 0, len(newFields))
+  for name := range newFields {
+    names = append(names, name)
+  }
+  for name := range oldFields {
+    if _, ok := newFields[name]; !ok {
+      names = append(names, name)
+    }
+  }
+  sort.Strings(names)
+
+  changes := make([]*FieldChange, 0)
+  for _, name := range names {
+    oldValue, newValue := auditValue(oldFields[name]), auditValue(newFields[name])
+    if !bytes.Equal(oldValue, newValue) {
+      changes = append(changes, &FieldChange{name, oldValue, newValue})
+    }
+  }
+
+  return changes, nil
+}
+
+func auditValue(value json.RawMessage) json.RawMessage {
+  if value == nil {
+    return json.RawMessage(`null`)
+  }
+  return value
+}
+
+// writeAuditInTxn records the change from old to new as part of the
+// transaction, rolling back the transaction on failure.
+func writeAuditInTxn(action AuditAction, old *Org, new *Org, ctx context.Context, txn *sql.Tx) rest.RestError {
+  changes, err := DiffOrgs(old, new)
+  if err == nil {
+    var data []byte
+    if data, err = json.Marshal(changes); err == nil {
+      actor := nulls.NewNullString()
+      if a := ActorFromContext(ctx); a != `` {
+        actor = nulls.NewString(a)
+      }
+      _, err = txn.Stmt(createAuditQuery).ExecContext(ctx, new.Id, actor, action, data)
+    }
+  }
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not record org audit entry.`, err)
+  }
+
+  return nil
+}
+
+const countHistoryStatement = `SELECT COUNT(*) FROM org_audit a JOIN entities e ON a.org_id=e.id WHERE e.pub_id=?`
+const listHistoryStatement = `SELECT a.id, a.actor, a.action, UNIX_TIMESTAMP(a.created_at), a.changes FROM org_audit a JOIN entities e ON a.org_id=e.id WHERE e.pub_id=? ORDER BY a.id DESC LIMIT ? OFFSET ?`
+
+// ListHistory retrieves a page of the Org's audit trail, most recent first.
+// Archived Orgs retain their history. Attempting to retrieve the history of a
+// non-existent Org results in a rest.NotFoundError.
+func ListHistory(pubId string, offset int64, limit int64, ctx context.Context) (*AuditPage, rest.RestError) {
+  if _, restErr := GetOrgIncludingArchived(pubId, ctx); restErr != nil {
+    return nil, restErr
+  }
+  if limit <= 0 {
+    limit = DefaultListLimit
+  } else if limit > MaxListLimit {
+    limit = MaxListLimit
+  }
+  if offset < 0 {
+    offset = 0
+  }
+
+  page := &AuditPage{Items: make([]*AuditEntry, 0), Offset: offset, Limit: limit}
+  if err := countHistoryQuery.QueryRowContext(ctx, pubId).Scan(&page.TotalCount); err != nil {
+    return nil, rest.ServerError(`Could not count org history.`, err)
+  }
+
+  rows, err := listHistoryQuery.QueryContext(ctx, pubId, limit, offset)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve org history.`, err)
+  }
+  defer rows.Close()
+  for rows.Next() {
+    var entry AuditEntry
+    var changes []byte
+    if err := rows.Scan(&entry.Id, &entry.Actor, &entry.Action, &entry.At, &changes); err != nil {
+      return nil, rest.ServerError(`Problem reading org history.`, err)
+    }
+    if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+      return nil, rest.ServerError(`Problem reading org history.`, err)
+    }
+    page.Items = append(page.Items, &entry)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, rest.ServerError(`Problem reading org history.`, err)
+  }
+
+  return page, nil
+}
+
+const createAuditStatement = `INSERT INTO org_audit (org_id, actor, action, changes) VALUES (?,?,?,?)`
+var createAuditQuery, countHistoryQuery, listHistoryQuery *sql.Stmt
+
+func setupAuditDB(db *sql.DB) {
+  var err error
+  if createAuditQuery, err = db.Prepare(createAuditStatement); err != nil {
+    log.Fatalf("mysql: prepare create audit stmt: %v", err)
+  }
+  if countHistoryQuery, err = db.Prepare(countHistoryStatement); err != nil {
+    log.Fatalf("mysql: prepare count history stmt: %v", err)
+  }
+  if listHistoryQuery, err = db.Prepare(listHistoryStatement); err != nil {
+    log.Fatalf("mysql: prepare list history stmt: %v", err)
+  }
+}
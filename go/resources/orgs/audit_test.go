@@ -0,0 +1,88 @@
+package orgs_test
+
+import (
+  "context"
+  "encoding/json"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func changedFields(changes []*FieldChange) map[string]*FieldChange {
+  fields := make(map[string]*FieldChange)
+  for _, change := range changes {
+    fields[change.Field] = change
+  }
+  return fields
+}
+
+func TestDiffOrgs(t *testing.T) {
+  updated := trivialOrg.Clone()
+  updated.SetEmail(`bar@test.com`)
+  updated.Summary = nulls.NewNullString()
+  updated.LegalID = nulls.NewString(`555-55-1234`)
+  updated.LastUpdated = nulls.NewInt64(trivialOrg.LastUpdated.Int64 + 1)
+
+  changes, err := DiffOrgs(trivialOrg, updated)
+  require.NoError(t, err, `Unexpected error diffing Orgs.`)
+  fields := changedFields(changes)
+  assert.Len(t, fields, 3, `Unexpected number of changes.`)
+  require.Contains(t, fields, `email`, `Missing email change.`)
+  assert.JSONEq(t, `"foo@test.com"`, string(fields[`email`].Old), `Unexpected old email.`)
+  assert.JSONEq(t, `"bar@test.com"`, string(fields[`email`].New), `Unexpected new email.`)
+  require.Contains(t, fields, `summary`, `Missing summary change.`)
+  assert.Equal(t, `null`, string(fields[`summary`].New), `Unset field not null.`)
+  require.Contains(t, fields, `legalID`, `Missing legal ID change.`)
+  assert.JSONEq(t, `"***-**-5555"`, string(fields[`legalID`].Old), `Old legal ID not masked.`)
+  assert.JSONEq(t, `"***-**-1234"`, string(fields[`legalID`].New), `New legal ID not masked.`)
+
+  changes, err = DiffOrgs(trivialOrg, trivialOrg.Clone())
+  require.NoError(t, err, `Unexpected error diffing Orgs.`)
+  assert.Empty(t, changes, `Unexpected changes for identical Orgs.`)
+}
+
+func TestDiffOrgsCreate(t *testing.T) {
+  changes, err := DiffOrgs(nil, trivialOrg)
+  require.NoError(t, err, `Unexpected error diffing new Org.`)
+  fields := changedFields(changes)
+  assert.Contains(t, fields, `displayName`, `Missing display name.`)
+  assert.NotContains(t, fields, `lastUpdated`, `Unexpected last updated.`)
+  assert.Equal(t, `null`, string(fields[`displayName`].Old), `Old value not null.`)
+  _, err = json.Marshal(changes)
+  assert.NoError(t, err, `Unexpected error marshalling changes.`)
+}
+
+func TestActorContext(t *testing.T) {
+  ctx := context.Background()
+  assert.Equal(t, ``, ActorFromContext(ctx), `Unexpected actor.`)
+  assert.Equal(t, `abc`, ActorFromContext(WithActor(ctx, `abc`)), `Actor not carried.`)
+}
+
+func testOrgHistory(t *testing.T) {
+  ctx := WithActor(context.Background(), `hijklmn456`)
+  org, restErr := GetOrg(someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error getting Org.`)
+  oldEmail := org.Email.String
+  org.SetEmail(`history@test.com`)
+  _, restErr = UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating Org.`)
+
+  page, restErr := ListHistory(someOrgID, 0, 2, ctx)
+  require.NoError(t, restErr, `Unexpected error listing history.`)
+  assert.True(t, page.TotalCount >= 1, `Unexpected total count.`)
+  require.NotEmpty(t, page.Items, `No history entries.`)
+  entry := page.Items[0]
+  assert.Equal(t, AuditUpdate, entry.Action, `Unexpected action.`)
+  assert.Equal(t, `hijklmn456`, entry.Actor.String, `Unexpected actor.`)
+  assert.NotZero(t, entry.At, `Missing timestamp.`)
+  fields := changedFields(entry.Changes)
+  require.Contains(t, fields, `email`, `Missing email change.`)
+  assert.JSONEq(t, `"` + oldEmail + `"`, string(fields[`email`].Old), `Unexpected old email.`)
+  assert.JSONEq(t, `"history@test.com"`, string(fields[`email`].New), `Unexpected new email.`)
+
+  _, restErr = ListHistory(`00000000-0000-0000-0000-000000000000`, 0, 0, ctx)
+  assert.Error(t, restErr, `Unexpected non-error for unknown Org.`)
+}
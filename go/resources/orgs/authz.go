@@ -0,0 +1,254 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "log"
+  "net/http"
+
+  "github.com/Liquid-Labs/catalyst-firewrap/go/fireauth"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// Action is an operation on an Org subject to authorization.
+type Action string
+
+const (
+  ActionCreate         Action = `create`
+  ActionList           Action = `list`
+  ActionRead           Action = `read`
+  ActionUpdate         Action = `update`
+  ActionDelete         Action = `delete`
+  ActionManageMembers  Action = `manage-members`
+  // ActionManageOwners is granting, changing, or removing the owner role.
+  ActionManageOwners   Action = `manage-owners`
+  ActionExport         Action = `export`
+  // ActionImportAccounts is setting the account fields ('authId', 'active',
+  // and the legal ID) of new Orgs, whether created singly or bulk imported.
+  ActionImportAccounts Action = `import-accounts`
+  ActionRevealLegalID  Action = `reveal-legal-id`
+  ActionReadHistory    Action = `read-history`
+  ActionManageWebhooks Action = `manage-webhooks`
+)
+
+// Relationship describes a Principal's standing relative to a particular Org.
+// Relationships are ordered so that each confers at least the standing of
+// those before it, with the exception of RelPlatformAdmin, which is not tied
+// to any Org.
+type Relationship int
+
+const (
+  RelAnonymous Relationship = iota
+  // RelNone is an authenticated Principal with no tie to the Org.
+  RelNone
+  RelMember
+  RelAdmin
+  // RelOwner is either the Org's own account or a member with the owner role.
+  RelOwner
+  RelPlatformAdmin
+)
+
+// PlatformAdminClaim is the custom auth token claim which, when true, marks a
+// Principal as a platform administrator.
+var PlatformAdminClaim = `admin`
+
+// Principal is the (possibly anonymous) caller of an API request.
+type Principal struct {
+  AuthId        string
+  PlatformAdmin bool
+}
+
+// NewPrincipal creates a Principal from an authentication ID and the custom
+// claims from their auth token. An empty authId creates an anonymous
+// Principal.
+func NewPrincipal(authId string, claims map[string]interface{}) *Principal {
+  admin, _ := claims[PlatformAdminClaim].(bool)
+  return &Principal{authId, authId != `` && admin}
+}
+
+// PrincipalFromClient creates a Principal from the authentication client
+// returned by the core handler auth checks. A nil client is anonymous.
+func PrincipalFromClient(authClient *fireauth.ScopedClient) (*Principal, rest.RestError) {
+  if authClient == nil {
+    return NewPrincipal(``, nil), nil
+  }
+  token, restErr := authClient.GetToken()
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  return NewPrincipal(token.UID, token.Claims), nil
+}
+
+func (p *Principal) IsAnonymous() bool {
+  return p.AuthId == ``
+}
+
+// Authorizer decides whether a Principal, having the given Relationship with
+// an Org, may perform an Action. Denials should be reported with a 403
+// Forbidden rest.RestError. For ActionCreate, ActionList, ActionExport, and
+// ActionImportAccounts, for ActionRevealLegalID when creating an Org, and for
+// ActionManageWebhooks on Webhooks covering all Orgs, there is no particular
+// Org and the Relationship is one of RelAnonymous, RelNone, or
+// RelPlatformAdmin.
+type Authorizer interface {
+  Authorize(p *Principal, rel Relationship, action Action) rest.RestError
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(*Principal, Relationship, Action) rest.RestError
+
+func (f AuthorizerFunc) Authorize(p *Principal, rel Relationship, action Action) rest.RestError {
+  return f(p, rel, action)
+}
+
+// DefaultAuthorizer requires authentication for everything. Any authenticated
+// Principal may create and list Orgs. Reading an Org requires membership,
+// updating it, reading its history, and managing its members and webhooks
+// requires the admin role, and deleting (archiving) it, managing its owners,
+// or seeing its unmasked legal ID requires ownership. Platform admins may do
+// anything, and only platform admins may bulk export Orgs, bulk import their
+// account fields, or manage webhooks for all Orgs.
+var DefaultAuthorizer Authorizer = AuthorizerFunc(defaultAuthorize)
+
+var defaultMinRelationship = map[Action]Relationship{
+  ActionCreate: RelNone,
+  ActionList: RelNone,
+  ActionRead: RelMember,
+  ActionUpdate: RelAdmin,
+  ActionDelete: RelOwner,
+  ActionManageMembers: RelAdmin,
+  ActionManageOwners: RelOwner,
+  ActionExport: RelPlatformAdmin,
+  ActionImportAccounts: RelPlatformAdmin,
+  ActionRevealLegalID: RelOwner,
+  ActionReadHistory: RelAdmin,
+  ActionManageWebhooks: RelAdmin,
+}
+
+func defaultAuthorize(p *Principal, rel Relationship, action Action) rest.RestError {
+  if rel == RelAnonymous {
+    return forbiddenError(`Authentication required.`, nil)
+  }
+  min, ok := defaultMinRelationship[action]
+  if !ok {
+    return forbiddenError(fmt.Sprintf(`Unknown action '%s'.`, action), nil)
+  }
+  if rel < min {
+    return forbiddenError(fmt.Sprintf(`Not authorized to %s org.`, action), nil)
+  }
+
+  return nil
+}
+
+var authorizer Authorizer = DefaultAuthorizer
+
+// SetAuthorizer replaces the Authorizer consulted by the Org API handlers.
+// Passing nil restores the DefaultAuthorizer.
+func SetAuthorizer(a Authorizer) {
+  if a == nil {
+    a = DefaultAuthorizer
+  }
+  authorizer = a
+}
+
+// ResolveRelationship determines the Principal's Relationship with the Org.
+// An empty orgPubId resolves the Principal's general standing. A non-existent
+// Org is treated as having no relationship with the Principal.
+func ResolveRelationship(p *Principal, orgPubId string, ctx context.Context) (Relationship, rest.RestError) {
+  switch {
+  case p.IsAnonymous():
+    return RelAnonymous, nil
+  case p.PlatformAdmin:
+    return RelPlatformAdmin, nil
+  case orgPubId == ``:
+    return RelNone, nil
+  }
+
+  var orgAuthId sql.NullString
+  var role sql.NullString
+  if err := getRelationshipQuery.QueryRowContext(ctx, p.AuthId, orgPubId).Scan(&orgAuthId, &role); err == sql.ErrNoRows {
+    return RelNone, nil
+  } else if err != nil {
+    return RelNone, rest.ServerError(`Could not determine relationship with org.`, err)
+  }
+  if orgAuthId.Valid && orgAuthId.String == p.AuthId {
+    return RelOwner, nil
+  }
+  switch Role(role.String) {
+  case RoleOwner:
+    return RelOwner, nil
+  case RoleAdmin:
+    return RelAdmin, nil
+  case RoleMember:
+    return RelMember, nil
+  default:
+    return RelNone, nil
+  }
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the Principal on whose behalf Orgs
+// are written. The Principal is authorized for any other Org which a write
+// touches; e.g., a new parent (see CreateOrg and UpdateOrg). Without a
+// Principal, writes are assumed to be made by the system and are unchecked.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+  return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext retrieves the Principal set by WithPrincipal, if any.
+func PrincipalFromContext(ctx context.Context) *Principal {
+  p, _ := ctx.Value(principalKey{}).(*Principal)
+  return p
+}
+
+// Authorize resolves the Principal's Relationship with the Org and consults
+// the configured Authorizer.
+func Authorize(p *Principal, orgPubId string, action Action, ctx context.Context) rest.RestError {
+  rel, restErr := ResolveRelationship(p, orgPubId, ctx)
+  if restErr != nil {
+    return restErr
+  }
+
+  return authorizer.Authorize(p, rel, action)
+}
+
+// AuthorizeMemberChange checks that the Principal may give the User the Role
+// within the Org or, where the Role is empty, remove the User from the Org.
+// Any change to the membership requires ActionManageMembers, and granting,
+// changing, or removing the owner role additionally requires
+// ActionManageOwners, so that admins cannot make themselves owners.
+func AuthorizeMemberChange(p *Principal, orgPubId string, userPubId string, role Role, ctx context.Context) rest.RestError {
+  rel, restErr := ResolveRelationship(p, orgPubId, ctx)
+  if restErr != nil {
+    return restErr
+  }
+  if restErr := authorizer.Authorize(p, rel, ActionManageMembers); restErr != nil {
+    return restErr
+  }
+
+  ownerChange := role == RoleOwner
+  if !ownerChange {
+    current, restErr := GetMember(orgPubId, userPubId, ctx)
+    if restErr != nil && restErr.Code() != http.StatusNotFound {
+      return restErr
+    }
+    ownerChange = current != nil && current.Role == RoleOwner
+  }
+  if ownerChange {
+    return authorizer.Authorize(p, rel, ActionManageOwners)
+  }
+
+  return nil
+}
+
+const getRelationshipStatement = `SELECT u.auth_id, m.role FROM orgs o JOIN users u ON o.id=u.id JOIN entities e ON o.id=e.id LEFT JOIN users mu ON mu.auth_id=? LEFT JOIN org_members m ON m.org_id=o.id AND m.user_id=mu.id WHERE e.pub_id=? ORDER BY m.role IS NULL LIMIT 1`
+var getRelationshipQuery *sql.Stmt
+func setupAuthzDB(db *sql.DB) {
+  var err error
+  if getRelationshipQuery, err = db.Prepare(getRelationshipStatement); err != nil {
+    log.Fatalf("mysql: prepare get org relationship stmt: %v", err)
+  }
+}
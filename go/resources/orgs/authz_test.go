@@ -0,0 +1,75 @@
+package orgs_test
+
+import (
+  "context"
+  "net/http"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestNewPrincipal(t *testing.T) {
+  assert.True(t, NewPrincipal(``, nil).IsAnonymous(), `Expected anonymous principal.`)
+  assert.False(t, NewPrincipal(`abc`, nil).PlatformAdmin, `Unexpected platform admin.`)
+  assert.True(t, NewPrincipal(`abc`, map[string]interface{}{PlatformAdminClaim: true}).PlatformAdmin, `Expected platform admin.`)
+  assert.False(t, NewPrincipal(`abc`, map[string]interface{}{PlatformAdminClaim: `true`}).PlatformAdmin, `Unexpected platform admin from non-bool claim.`)
+}
+
+func TestDefaultAuthorizer(t *testing.T) {
+  p := NewPrincipal(`abc`, nil)
+  allowed := map[Relationship][]Action{
+    RelAnonymous: []Action{},
+    RelNone: []Action{ActionCreate, ActionList},
+    RelMember: []Action{ActionCreate, ActionList, ActionRead},
+    RelAdmin: []Action{ActionCreate, ActionList, ActionRead, ActionUpdate, ActionManageMembers, ActionReadHistory, ActionManageWebhooks},
+    RelOwner: []Action{ActionCreate, ActionList, ActionRead, ActionUpdate, ActionManageMembers, ActionReadHistory, ActionManageWebhooks, ActionDelete, ActionManageOwners, ActionRevealLegalID},
+    RelPlatformAdmin: []Action{ActionCreate, ActionList, ActionRead, ActionUpdate, ActionManageMembers, ActionReadHistory, ActionManageWebhooks, ActionDelete, ActionManageOwners, ActionExport, ActionImportAccounts, ActionRevealLegalID},
+  }
+  actions := []Action{ActionCreate, ActionList, ActionRead, ActionUpdate, ActionDelete, ActionManageMembers, ActionManageOwners, ActionExport, ActionImportAccounts, ActionRevealLegalID, ActionReadHistory, ActionManageWebhooks}
+  for rel, relAllowed := range allowed {
+    for _, action := range actions {
+      restErr := DefaultAuthorizer.Authorize(p, rel, action)
+      if contains(relAllowed, action) {
+        assert.NoErrorf(t, restErr, `Relationship %d unexpectedly denied '%s'.`, rel, action)
+      } else if assert.Errorf(t, restErr, `Relationship %d unexpectedly allowed '%s'.`, rel, action) {
+        assert.Equal(t, http.StatusForbidden, restErr.Code(), `Unexpected error code.`)
+      }
+    }
+  }
+}
+
+func contains(actions []Action, action Action) bool {
+  for _, a := range actions {
+    if a == action {
+      return true
+    }
+  }
+  return false
+}
+
+func testOrgRelationships(t *testing.T) {
+  ctx := context.Background()
+  rel, restErr := ResolveRelationship(NewPrincipal(`abcdefg123`, nil), someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error resolving relationship.`)
+  assert.Equal(t, RelOwner, rel, `Org account should own itself.`)
+
+  member := NewPrincipal(`hijklmn456`, nil)
+  rel, restErr = ResolveRelationship(member, someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error resolving relationship.`)
+  assert.Equal(t, RelNone, rel, `Unexpected relationship for non-member.`)
+  _, restErr = AddMember(someOrgID, someMemberID, RoleAdmin, ctx)
+  require.NoError(t, restErr, `Unexpected error adding member.`)
+  rel, restErr = ResolveRelationship(member, someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error resolving relationship.`)
+  assert.Equal(t, RelAdmin, rel, `Unexpected relationship for admin member.`)
+  assert.NoError(t, Authorize(member, someOrgID, ActionUpdate, ctx), `Admin unexpectedly denied update.`)
+  assert.Error(t, Authorize(member, someOrgID, ActionDelete, ctx), `Admin unexpectedly allowed delete.`)
+  require.NoError(t, RemoveMember(someOrgID, someMemberID, ctx), `Unexpected error removing member.`)
+
+  rel, restErr = ResolveRelationship(NewPrincipal(``, nil), someOrgID, ctx)
+  assert.Equal(t, RelAnonymous, rel, `Unexpected relationship for anonymous principal.`)
+  rel, restErr = ResolveRelationship(NewPrincipal(`xyz`, map[string]interface{}{PlatformAdminClaim: true}), someOrgID, ctx)
+  assert.Equal(t, RelPlatformAdmin, rel, `Unexpected relationship for platform admin.`)
+}
@@ -0,0 +1,181 @@
+package orgs
+
+import (
+  "context"
+  "encoding/base64"
+  "encoding/json"
+  "strings"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ChangeToken marks a position in the change feed. The feed follows the
+// outbox in the order the changes committed (see EventGapWindow), so the
+// token names the ID of the last event seen. A first sync scans every Org,
+// by public ID, before following the events since the scan began; until then,
+// Scan is set and PubId names the last Org scanned. Tokens are handed to
+// clients as opaque strings via Encode.
+type ChangeToken struct {
+  EventId int64  `json:"e"`
+  Scan    bool   `json:"s,omitempty"`
+  PubId   string `json:"p,omitempty"`
+}
+
+func (t *ChangeToken) Encode() string {
+  data, _ := json.Marshal(t)
+  return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeChangeToken reverses ChangeToken.Encode.
+func DecodeChangeToken(encoded string) (*ChangeToken, error) {
+  data, err := base64.RawURLEncoding.DecodeString(encoded)
+  if err != nil {
+    return nil, err
+  }
+  var t ChangeToken
+  if err := json.Unmarshal(data, &t); err != nil {
+    return nil, err
+  }
+
+  return &t, nil
+}
+
+// OrgChange reports the current state of a changed Org. Archived Orgs are
+// reported as tombstones, carrying only the public ID and version. Otherwise,
+// either the Summary or the Org (detail) is set, as requested.
+type OrgChange struct {
+  PubId       string      `json:"pubId"`
+  LastUpdated int64       `json:"lastUpdated"`
+  Tombstone   bool        `json:"tombstone"`
+  Summary     *OrgSummary `json:"summary,omitempty"`
+  Org         *Org        `json:"org,omitempty"`
+}
+
+// ChangesPage is a batch of changes in the order they were made. NextToken
+// requests the changes following the batch; where More is set, further
+// changes may be available immediately.
+type ChangesPage struct {
+  Items     []*OrgChange `json:"items"`
+  NextToken string       `json:"nextToken"`
+  More      bool         `json:"more"`
+}
+
+const scanChangesStatement = listOrgsSelect + `WHERE e.pub_id > ? ORDER BY e.pub_id ASC LIMIT ?`
+
+// ListChanges retrieves the Orgs changed since the token, oldest change first.
+// An empty token starts from the beginning, listing every Org. Legal IDs are
+// always masked. An invalid token results in a rest.BadRequestError, and a
+// token from before the events pruned from the outbox (see EventRetention)
+// in a 410 Gone error; the client must then resync with an empty token.
+//
+// Each Org appears at most once per batch, in its current state, however many
+// times it has changed.
+func ListChanges(since string, limit int64, detail bool, ctx context.Context) (*ChangesPage, rest.RestError) {
+  var token *ChangeToken
+  if since == `` {
+    horizon, err := eventHorizon(ctx)
+    if err != nil {
+      return nil, rest.ServerError(`Could not read org changes.`, err)
+    }
+    token = &ChangeToken{EventId: horizon, Scan: true}
+  } else {
+    var err error
+    if token, err = DecodeChangeToken(since); err != nil {
+      return nil, rest.BadRequestError(`Invalid change token.`, err)
+    }
+  }
+  if limit <= 0 {
+    limit = DefaultListLimit
+  } else if limit > MaxListLimit {
+    limit = MaxListLimit
+  }
+
+  page := &ChangesPage{Items: make([]*OrgChange, 0)}
+  next := *token
+  var orgs []*OrgSummary
+  var restErr rest.RestError
+  if token.Scan {
+    if orgs, restErr = queryOrgSummaries(scanChangesStatement, []interface{}{token.PubId, limit + 1}, ctx); restErr != nil {
+      return nil, restErr
+    }
+    if int64(len(orgs)) > limit {
+      orgs = orgs[:limit]
+      next.PubId = orgs[len(orgs) - 1].PubId.String
+    } else {
+      // The scan is complete; what follows are the events since it began.
+      next = ChangeToken{EventId: token.EventId}
+    }
+    page.More = true
+  } else {
+    ids, pubIds, err := readOutboxOrgs(token.EventId, limit + 1, ctx)
+    if err != nil {
+      return nil, rest.ServerError(`Could not read org changes.`, err)
+    }
+    if page.More = int64(len(ids)) > limit; page.More {
+      ids, pubIds = ids[:limit], pubIds[:limit]
+    }
+    if len(ids) > 0 {
+      next.EventId = ids[len(ids) - 1]
+      if orgs, restErr = getChangedOrgs(pubIds, ctx); restErr != nil {
+        return nil, restErr
+      }
+    }
+  }
+  // Checked after reading, as the pruning may have raced the read.
+  if prunedId, err := prunedEventId(ctx); err != nil {
+    return nil, rest.ServerError(`Could not read org changes.`, err)
+  } else if token.EventId < prunedId {
+    return nil, goneError(`Change token has expired; resync with an empty token.`, nil)
+  }
+  for _, summary := range orgs {
+    change := &OrgChange{PubId: summary.PubId.String, LastUpdated: summary.LastUpdated.Int64, Tombstone: summary.IsArchived()}
+    if !change.Tombstone {
+      if detail {
+        if change.Org, restErr = GetOrgIncludingArchived(change.PubId, ctx); restErr != nil {
+          return nil, restErr
+        }
+        change.Org.RedactLegalID()
+      } else {
+        change.Summary = summary
+      }
+    }
+    page.Items = append(page.Items, change)
+  }
+  page.NextToken = next.Encode()
+
+  return page, nil
+}
+
+// getChangedOrgs retrieves the Orgs named by a run of events, each once and
+// ordered by its last event.
+func getChangedOrgs(pubIds []string, ctx context.Context) ([]*OrgSummary, rest.RestError) {
+  last := make(map[string]int)
+  for i, pubId := range pubIds {
+    last[strings.ToLower(pubId)] = i
+  }
+  ordered := make([]string, 0, len(last))
+  params := make([]interface{}, 0, len(last))
+  for i, pubId := range pubIds {
+    if last[strings.ToLower(pubId)] == i {
+      ordered = append(ordered, strings.ToLower(pubId))
+      params = append(params, pubId)
+    }
+  }
+
+  found, restErr := queryOrgSummaries(listOrgsSelect + `WHERE e.pub_id IN (` + placeholders(len(params)) + `)`, params, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  byPubId := make(map[string]*OrgSummary)
+  for _, org := range found {
+    byPubId[strings.ToLower(org.PubId.String)] = org
+  }
+  orgs := make([]*OrgSummary, 0, len(ordered))
+  for _, pubId := range ordered {
+    if org, ok := byPubId[pubId]; ok {
+      orgs = append(orgs, org)
+    }
+  }
+
+  return orgs, nil
+}
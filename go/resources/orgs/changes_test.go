@@ -0,0 +1,133 @@
+package orgs_test
+
+import (
+  "context"
+  "net/http"
+  "testing"
+  "time"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestChangeTokenRoundTrip(t *testing.T) {
+  token := &ChangeToken{12345, true, `a`}
+  decoded, err := DecodeChangeToken(token.Encode())
+  require.NoError(t, err, `Unexpected error decoding token.`)
+  assert.Equal(t, token, decoded, `Decoded token does not match original.`)
+
+  _, err = DecodeChangeToken(`not a token!`)
+  assert.Error(t, err, `Unexpected non-error decoding bad base64.`)
+}
+
+// syncChanges follows the change feed from the token to its end, returning
+// the last change seen for each Org and the final token.
+func syncChanges(t *testing.T, since string, detail bool) (map[string]*OrgChange, string) {
+  changes := make(map[string]*OrgChange)
+  for {
+    page, restErr := ListChanges(since, 2, detail, context.Background())
+    require.NoError(t, restErr, `Unexpected error listing changes.`)
+    for _, change := range page.Items {
+      changes[change.PubId] = change
+    }
+    since = page.NextToken
+    if !page.More {
+      return changes, since
+    }
+  }
+}
+
+func testOrgChanges(t *testing.T) {
+  ctx := context.Background()
+  // Earlier tests leave gaps behind where their transactions rolled back.
+  defer func(window time.Duration) { EventGapWindow = window }(EventGapWindow)
+  EventGapWindow = 0
+  all, token := syncChanges(t, ``, false)
+  require.Contains(t, all, someOrgID, `Initial sync missing org.`)
+  assert.NotNil(t, all[someOrgID].Summary, `Missing summary.`)
+  none, sameToken := syncChanges(t, token, false)
+  assert.Empty(t, none, `Unexpected changes without updates.`)
+  assert.Equal(t, token, sameToken, `Token moved without changes.`)
+
+  changed := someOrg.Clone()
+  changed.SetDisplayName(`Changing Org`)
+  changed, restErr := CreateOrg(changed, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  _, restErr = ArchiveOrg(changed.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error archiving org.`)
+
+  changes, _ := syncChanges(t, token, true)
+  require.Len(t, changes, 1, `Unexpected number of changes.`)
+  require.Contains(t, changes, changed.PubId.String, `Missing changed org.`)
+  assert.True(t, changes[changed.PubId.String].Tombstone, `Archived org not a tombstone.`)
+  assert.Nil(t, changes[changed.PubId.String].Org, `Unexpected tombstone detail.`)
+
+  _, restErr = RestoreOrg(changed.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error restoring org.`)
+  changes, _ = syncChanges(t, token, true)
+  require.Contains(t, changes, changed.PubId.String, `Missing restored org.`)
+  assert.False(t, changes[changed.PubId.String].Tombstone, `Restored org a tombstone.`)
+  require.NotNil(t, changes[changed.PubId.String].Org, `Missing detail.`)
+  assert.Equal(t, `Changing Org`, changes[changed.PubId.String].Org.DisplayName.String, `Unexpected detail.`)
+}
+
+func testOrgChangesUncommitted(t *testing.T) {
+  ctx := context.Background()
+  defer func(window time.Duration) { EventGapWindow = window }(EventGapWindow)
+  EventGapWindow = 0
+  _, token := syncChanges(t, ``, false)
+  EventGapWindow = time.Minute
+
+  // The early change is made first but commits last, within the same second.
+  txn, err := sqldb.DB.Begin()
+  require.NoError(t, err, `Unexpected error beginning transaction.`)
+  defer txn.Rollback()
+  early := someOrg.Clone()
+  early.SetDisplayName(`Early Changing Org`)
+  early, restErr := CreateOrgInTxn(early, ctx, txn)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  late := someOrg.Clone()
+  late.SetDisplayName(`Late Changing Org`)
+  late, restErr = CreateOrg(late, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  changes, sameToken := syncChanges(t, token, false)
+  assert.Empty(t, changes, `Changes read past an uncommitted change.`)
+  assert.Equal(t, token, sameToken, `Token moved past an uncommitted change.`)
+
+  require.NoError(t, txn.Commit(), `Unexpected error committing org.`)
+  changes, _ = syncChanges(t, token, false)
+  assert.Contains(t, changes, early.PubId.String, `Missing late committed change.`)
+  assert.Contains(t, changes, late.PubId.String, `Missing early committed change.`)
+}
+
+func testOrgChangesExpired(t *testing.T) {
+  ctx := context.Background()
+  defer func(window time.Duration) { EventGapWindow = window }(EventGapWindow)
+  defer func(retention time.Duration) { EventRetention = retention }(EventRetention)
+  EventGapWindow, EventRetention = 0, 0
+  _, token := syncChanges(t, ``, false)
+  _, restErr := PatchOrg(someOrgID, []byte(`{"summary": "Pruned."}`), nulls.NewNullInt64(), ctx)
+  require.NoError(t, restErr, `Unexpected error patching org.`)
+
+  // Settle everything so that it may all be pruned.
+  _, err := sqldb.DB.Exec(`UPDATE org_webhook_deliveries SET failed_at=NOW() WHERE delivered_at IS NULL AND failed_at IS NULL`)
+  require.NoError(t, err, `Unexpected error settling webhook deliveries.`)
+  _, err = sqldb.DB.Exec(`UPDATE org_outbox SET delivered_at=NOW() WHERE delivered_at IS NULL AND failed_at IS NULL`)
+  require.NoError(t, err, `Unexpected error settling events.`)
+  pruned, err := PruneEvents(ctx)
+  require.NoError(t, err, `Unexpected error pruning events.`)
+  assert.NotZero(t, pruned, `No events pruned.`)
+
+  _, restErr = ListChanges(token, 2, false, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error listing changes from before the pruning.`) {
+    assert.Equal(t, http.StatusGone, restErr.Code(), `Unexpected error code.`)
+  }
+  all, token := syncChanges(t, ``, false)
+  assert.Contains(t, all, someOrgID, `Resync missing org.`)
+  none, _ := syncChanges(t, token, false)
+  assert.Empty(t, none, `Unexpected changes after resync.`)
+}
@@ -0,0 +1,72 @@
+package orgs
+
+import (
+  "encoding/base64"
+  "encoding/json"
+)
+
+// orgsSortDesc records the direction of each of the OrgsSorts for keyset
+// (cursor) paging. Every sort is keyed on display name with the public ID as
+// a tie breaker so that the key is unique.
+var orgsSortDesc = map[string]bool{
+  "": false,
+  `name-asc`: false,
+  `name-desc`: true,
+}
+
+const keysetName = `COALESCE(o.display_name, '')`
+
+func keysetOrder(desc bool) string {
+  if desc {
+    return keysetName + ` DESC, e.pub_id DESC `
+  } else {
+    return keysetName + ` ASC, e.pub_id ASC `
+  }
+}
+
+// OrgCursor marks a position in an Org list. Cursors are handed to clients
+// as opaque strings via Encode and are only meaningful for the sort they were
+// created under.
+type OrgCursor struct {
+  Sort        string `json:"s"`
+  DisplayName string `json:"n"`
+  PubId       string `json:"p"`
+  // Backward is set for 'previous page' cursors.
+  Backward    bool   `json:"b,omitempty"`
+}
+
+// NewOrgCursor creates a cursor positioned at the given Org.
+func NewOrgCursor(sort string, o *OrgSummary, backward bool) *OrgCursor {
+  return &OrgCursor{sort, o.DisplayName.String, o.PubId.String, backward}
+}
+
+func (c *OrgCursor) Encode() string {
+  // Marshalling a struct of strings and a bool cannot fail.
+  data, _ := json.Marshal(c)
+  return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeOrgCursor reverses OrgCursor.Encode.
+func DecodeOrgCursor(encoded string) (*OrgCursor, error) {
+  data, err := base64.RawURLEncoding.DecodeString(encoded)
+  if err != nil {
+    return nil, err
+  }
+  var c OrgCursor
+  if err := json.Unmarshal(data, &c); err != nil {
+    return nil, err
+  }
+
+  return &c, nil
+}
+
+// whereBit selects the records strictly after the cursor when travelling in
+// the indicated direction.
+func (c *OrgCursor) whereBit(desc bool) (string, []interface{}) {
+  op := `>`
+  if desc {
+    op = `<`
+  }
+  return `AND (` + keysetName + ` ` + op + ` ? OR (` + keysetName + ` = ? AND e.pub_id ` + op + ` ?)) `,
+    []interface{}{c.DisplayName, c.DisplayName, c.PubId}
+}
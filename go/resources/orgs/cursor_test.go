@@ -0,0 +1,25 @@
+package orgs_test
+
+import (
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestOrgCursorRoundTrip(t *testing.T) {
+  cursor := NewOrgCursor(`name-desc`, trivialOrgSummary, true)
+  decoded, err := DecodeOrgCursor(cursor.Encode())
+  require.NoError(t, err, `Unexpected error decoding cursor.`)
+  assert.Equal(t, cursor, decoded, `Decoded cursor does not match original.`)
+  assert.Equal(t, `displayName`, decoded.DisplayName, `Unexpected display name.`)
+  assert.Equal(t, `a`, decoded.PubId, `Unexpected public id.`)
+}
+
+func TestOrgCursorDecodeInvalid(t *testing.T) {
+  _, err := DecodeOrgCursor(`not a cursor!`)
+  assert.Error(t, err, `Unexpected non-error decoding bad base64.`)
+  _, err = DecodeOrgCursor(`bm90IGpzb24`) // 'not json'
+  assert.Error(t, err, `Unexpected non-error decoding bad JSON.`)
+}
@@ -0,0 +1,235 @@
+package orgs
+
+import (
+  "encoding/gob"
+  "io/ioutil"
+  "math"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "sync"
+)
+
+// diskIndexWeights weights each SearchDoc field when scoring a match. As with
+// the database search, the display name counts for more.
+var diskIndexWeights = map[string]float64{
+  `name`: 3,
+  `summary`: 1,
+  `contact`: 1,
+  `place`: 1,
+}
+
+// diskIndexFile is the persisted form of a DiskIndex.
+type diskIndexFile struct {
+  LastEventId int64
+  Docs        []*SearchDoc
+}
+
+// DiskIndex is an embedded SearchIndex persisted to a single file. The
+// inverted index, mapping each word to the weighted number of times it
+// appears in each Org, is held in memory and rebuilt from the persisted docs
+// when the index is opened. Every Update rewrites the file, so updates are
+// best made in batches, as the SearchIndexer does.
+type DiskIndex struct {
+  path        string
+  mu          sync.RWMutex
+  lastEventId int64
+  docs        map[string]*SearchDoc
+  postings    map[string]map[string]float64
+  // words is the sorted vocabulary, for prefix matching. It is set to nil
+  // as docs are added and removed, and rebuilt, under the write lock, once
+  // the batch is done.
+  words       []string
+}
+
+// OpenDiskIndex opens the index persisted at path, creating an empty index if
+// there is no such file.
+func OpenDiskIndex(path string) (*DiskIndex, error) {
+  index := &DiskIndex{path: path}
+  index.clear()
+  f, err := os.Open(path)
+  if os.IsNotExist(err) {
+    return index, nil
+  } else if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  var persisted diskIndexFile
+  if err := gob.NewDecoder(f).Decode(&persisted); err != nil {
+    return nil, err
+  }
+  for _, doc := range persisted.Docs {
+    index.add(doc)
+  }
+  index.updateVocabulary()
+  index.lastEventId = persisted.LastEventId
+
+  return index, nil
+}
+
+func (x *DiskIndex) clear() {
+  x.lastEventId = 0
+  x.docs = make(map[string]*SearchDoc)
+  x.postings = make(map[string]map[string]float64)
+  x.words = nil
+  x.updateVocabulary()
+}
+
+// docWords tallies the weighted occurrences of each word in the doc.
+func docWords(doc *SearchDoc) map[string]float64 {
+  counts := make(map[string]float64)
+  fields := map[string]string{`name`: doc.Name, `summary`: doc.Summary, `contact`: doc.Contact, `place`: doc.Place}
+  for field, text := range fields {
+    for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isSearchRune(r) }) {
+      counts[word] += diskIndexWeights[field]
+    }
+  }
+
+  return counts
+}
+
+func (x *DiskIndex) add(doc *SearchDoc) {
+  x.remove(doc.PubId)
+  x.docs[doc.PubId] = doc
+  for word, count := range docWords(doc) {
+    if x.postings[word] == nil {
+      x.postings[word] = make(map[string]float64)
+      x.words = nil
+    }
+    x.postings[word][doc.PubId] = count
+  }
+}
+
+func (x *DiskIndex) remove(pubId string) {
+  doc, ok := x.docs[pubId]
+  if !ok {
+    return
+  }
+  delete(x.docs, pubId)
+  for word := range docWords(doc) {
+    delete(x.postings[word], pubId)
+    if len(x.postings[word]) == 0 {
+      delete(x.postings, word)
+      x.words = nil
+    }
+  }
+}
+
+// save writes the index to a temporary file which then replaces the index
+// file, so a failed save leaves the previous index intact.
+func (x *DiskIndex) save() error {
+  persisted := diskIndexFile{LastEventId: x.lastEventId, Docs: make([]*SearchDoc, 0, len(x.docs))}
+  for _, doc := range x.docs {
+    persisted.Docs = append(persisted.Docs, doc)
+  }
+  f, err := ioutil.TempFile(filepath.Dir(x.path), filepath.Base(x.path) + `.*.tmp`)
+  if err != nil {
+    return err
+  }
+  defer os.Remove(f.Name())
+  if err := gob.NewEncoder(f).Encode(&persisted); err != nil {
+    f.Close()
+    return err
+  }
+  if err := f.Sync(); err != nil {
+    f.Close()
+    return err
+  }
+  if err := f.Close(); err != nil {
+    return err
+  }
+
+  return os.Rename(f.Name(), x.path)
+}
+
+// updateVocabulary rebuilds the sorted words if they are stale. The caller
+// must hold the write lock.
+func (x *DiskIndex) updateVocabulary() {
+  if x.words == nil {
+    x.words = make([]string, 0, len(x.postings))
+    for word := range x.postings {
+      x.words = append(x.words, word)
+    }
+    sort.Strings(x.words)
+  }
+}
+
+// Search implements SearchIndex. Each term contributes the weighted count of
+// the words it begins, scaled by the rarity of those words.
+func (x *DiskIndex) Search(terms []string, includeArchived bool) ([]*SearchHit, error) {
+  x.mu.RLock()
+  defer x.mu.RUnlock()
+  if len(terms) == 0 {
+    return make([]*SearchHit, 0), nil
+  }
+
+  words := x.words
+  var scores map[string]float64
+  for _, term := range terms {
+    termScores := make(map[string]float64)
+    for i := sort.SearchStrings(words, term); i < len(words) && strings.HasPrefix(words[i], term); i += 1 {
+      postings := x.postings[words[i]]
+      idf := math.Log(1 + float64(len(x.docs)) / float64(len(postings)))
+      for pubId, count := range postings {
+        termScores[pubId] += count * idf
+      }
+    }
+    // Every term must match.
+    if scores == nil {
+      scores = termScores
+    } else {
+      for pubId, score := range scores {
+        if termScore, ok := termScores[pubId]; ok {
+          scores[pubId] = score + termScore
+        } else {
+          delete(scores, pubId)
+        }
+      }
+    }
+  }
+
+  hits := make([]*SearchHit, 0, len(scores))
+  for pubId, score := range scores {
+    if doc := x.docs[pubId]; includeArchived || !doc.Archived {
+      hits = append(hits, &SearchHit{pubId, score, doc.Place})
+    }
+  }
+  sort.Slice(hits, func(i, j int) bool {
+    if hits[i].Score != hits[j].Score {
+      return hits[i].Score > hits[j].Score
+    }
+    return hits[i].PubId < hits[j].PubId
+  })
+
+  return hits, nil
+}
+
+// Update implements SearchIndex, persisting the index before returning.
+func (x *DiskIndex) Update(docs []*SearchDoc, lastEventId int64) error {
+  x.mu.Lock()
+  defer x.mu.Unlock()
+  for _, doc := range docs {
+    x.add(doc)
+  }
+  x.updateVocabulary()
+  x.lastEventId = lastEventId
+
+  return x.save()
+}
+
+func (x *DiskIndex) LastEventId() int64 {
+  x.mu.RLock()
+  defer x.mu.RUnlock()
+  return x.lastEventId
+}
+
+// Reset implements SearchIndex, persisting the empty index before returning.
+func (x *DiskIndex) Reset() error {
+  x.mu.Lock()
+  defer x.mu.Unlock()
+  x.clear()
+
+  return x.save()
+}
@@ -0,0 +1,95 @@
+package orgs_test
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sync"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func hitIds(hits []*SearchHit) []string {
+  ids := make([]string, len(hits))
+  for i, hit := range hits {
+    ids[i] = hit.PubId
+  }
+  return ids
+}
+
+func TestDiskIndex(t *testing.T) {
+  dir, err := ioutil.TempDir(``, `orgs-index`)
+  require.NoError(t, err, `Could not create index directory.`)
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, `orgs.idx`)
+
+  index, err := OpenDiskIndex(path)
+  require.NoError(t, err, `Unexpected error opening new index.`)
+  assert.Equal(t, int64(0), index.LastEventId(), `Unexpected event ID for new index.`)
+  docs := []*SearchDoc{
+    &SearchDoc{PubId: `A`, Name: `Acme Widgets`, Summary: `Widgets and gadgets.`, Contact: `sales@acme.com`, Place: `Dayton OH`},
+    &SearchDoc{PubId: `B`, Name: `Gadget Works`, Summary: `We make acme compatible widgets.`, Place: `Austin TX`},
+    &SearchDoc{PubId: `C`, Name: `Unrelated`, Place: `Dayton OH`},
+  }
+  require.NoError(t, index.Update(docs, 5), `Unexpected error updating index.`)
+
+  hits, err := index.Search([]string{`acm`, `widg`}, false)
+  require.NoError(t, err, `Unexpected error searching index.`)
+  assert.Equal(t, []string{`A`, `B`}, hitIds(hits), `Expected name match to rank first.`)
+  assert.Equal(t, `Dayton OH`, hits[0].Place, `Unexpected hit place.`)
+  hits, _ = index.Search([]string{`dayton`, `gadget`}, false)
+  assert.Equal(t, []string{`A`}, hitIds(hits), `Expected every term to be required.`)
+
+  update := &SearchDoc{PubId: `A`, Name: `Acme Sprockets`, Place: `Dayton OH`}
+  archived := &SearchDoc{PubId: `B`, Name: `Gadget Works`, Summary: `We make acme compatible widgets.`, Place: `Austin TX`, Archived: true}
+  require.NoError(t, index.Update([]*SearchDoc{update, archived}, 7), `Unexpected error updating index.`)
+  hits, _ = index.Search([]string{`widget`}, false)
+  assert.Empty(t, hits, `Replaced or archived docs matched.`)
+  hits, _ = index.Search([]string{`widget`}, true)
+  assert.Equal(t, []string{`B`}, hitIds(hits), `Archived doc not matched on request.`)
+
+  reopened, err := OpenDiskIndex(path)
+  require.NoError(t, err, `Unexpected error reopening index.`)
+  assert.Equal(t, int64(7), reopened.LastEventId(), `Event ID not persisted.`)
+  hits, _ = reopened.Search([]string{`sprocket`}, false)
+  assert.Equal(t, []string{`A`}, hitIds(hits), `Docs not persisted.`)
+  hits, _ = reopened.Search([]string{`gadget`}, true)
+  assert.Equal(t, []string{`B`}, hitIds(hits), `Archived flag not persisted.`)
+
+  require.NoError(t, reopened.Reset(), `Unexpected error resetting index.`)
+  hits, _ = reopened.Search([]string{`dayton`}, true)
+  assert.Empty(t, hits, `Reset index not empty.`)
+  assert.Equal(t, int64(0), reopened.LastEventId(), `Unexpected event ID for reset index.`)
+}
+
+func TestDiskIndexConcurrent(t *testing.T) {
+  dir, err := ioutil.TempDir(``, `orgs-index`)
+  require.NoError(t, err, `Could not create index directory.`)
+  defer os.RemoveAll(dir)
+  index, err := OpenDiskIndex(filepath.Join(dir, `orgs.idx`))
+  require.NoError(t, err, `Unexpected error opening new index.`)
+
+  // Searches run alongside updates adding new words.
+  var wg sync.WaitGroup
+  for i := 0; i < 4; i += 1 {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for j := 0; j < 50; j += 1 {
+        _, err := index.Search([]string{`word`}, false)
+        assert.NoError(t, err, `Unexpected error searching index.`)
+      }
+    }()
+  }
+  for i := 0; i < 20; i += 1 {
+    doc := &SearchDoc{PubId: fmt.Sprintf(`%d`, i), Name: fmt.Sprintf(`word%d`, i)}
+    require.NoError(t, index.Update([]*SearchDoc{doc}, int64(i + 1)), `Unexpected error updating index.`)
+  }
+  wg.Wait()
+  hits, _ := index.Search([]string{`word`}, false)
+  assert.Len(t, hits, 20, `Unexpected number of hits.`)
+}
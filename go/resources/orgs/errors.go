@@ -0,0 +1,68 @@
+package orgs
+
+import (
+  "fmt"
+  "net/http"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// orgsError implements rest.RestError for the HTTP status codes which the
+// go-rest error constructors do not cover.
+type orgsError struct {
+  message string
+  code    int
+  cause   error
+}
+
+func (e orgsError) Error() string {
+  return e.message
+}
+
+func (e orgsError) Code() int {
+  return e.code
+}
+
+func (e orgsError) Cause() error {
+  return e.cause
+}
+
+func forbiddenError(message string, cause error) rest.RestError {
+  return orgsError{message, http.StatusForbidden, cause}
+}
+
+func conflictError(message string, cause error) rest.RestError {
+  return orgsError{message, http.StatusConflict, cause}
+}
+
+func goneError(message string, cause error) rest.RestError {
+  return orgsError{message, http.StatusGone, cause}
+}
+
+func preconditionFailedError(message string, cause error) rest.RestError {
+  return orgsError{message, http.StatusPreconditionFailed, cause}
+}
+
+// FieldError is a 422 Unprocessable Entity rest.RestError identifying the
+// invalid field.
+type FieldError struct {
+  Field   string `json:"field"`
+  Message string `json:"message"`
+}
+
+// NewFieldError creates a FieldError for the named (JSON) field.
+func NewFieldError(field string, message string) *FieldError {
+  return &FieldError{field, message}
+}
+
+func (e *FieldError) Error() string {
+  return fmt.Sprintf(`Invalid '%s': %s`, e.Field, e.Message)
+}
+
+func (e *FieldError) Code() int {
+  return http.StatusUnprocessableEntity
+}
+
+func (e *FieldError) Cause() error {
+  return nil
+}
@@ -0,0 +1,48 @@
+package orgs
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+)
+
+// ETag generates a (strong) entity tag for the Org based on its Version. The
+// LastUpdated time is not used as it only resolves to the second, so writes
+// made in the same second would share a tag.
+func ETag(o *OrgSummary) string {
+  return `"` + strconv.FormatInt(o.Version.Int64, 10) + `"`
+}
+
+// ParseETag extracts the Version from an entity tag generated by
+// ETag. Weak tags are rejected since If-Match requires strong comparison.
+func ParseETag(tag string) (int64, error) {
+  tag = strings.TrimSpace(tag)
+  if len(tag) < 2 || tag[0] != '"' || tag[len(tag) - 1] != '"' {
+    return 0, fmt.Errorf(`malformed entity tag '%s'`, tag)
+  }
+  version, err := strconv.ParseInt(tag[1:len(tag) - 1], 10, 64)
+  if err != nil {
+    return 0, fmt.Errorf(`unrecognized entity tag '%s'`, tag)
+  }
+
+  return version, nil
+}
+
+// ParseIfMatch processes an If-Match header value into the expected Org
+// version. An empty header or '*' yields an invalid (null) version, meaning
+// there is no version to check. We only issue a single ETag per Org, so lists
+// of tags are not supported.
+func ParseIfMatch(header string) (nulls.Int64, error) {
+  header = strings.TrimSpace(header)
+  if header == `` || header == `*` {
+    return nulls.NewNullInt64(), nil
+  }
+  version, err := ParseETag(header)
+  if err != nil {
+    return nulls.NewNullInt64(), err
+  }
+
+  return nulls.NewInt64(version), nil
+}
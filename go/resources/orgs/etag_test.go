@@ -0,0 +1,34 @@
+package orgs_test
+
+import (
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestETagRoundTrip(t *testing.T) {
+  tag := ETag(trivialOrgSummary)
+  assert.Equal(t, `"3"`, tag, `Unexpected ETag.`)
+  version, err := ParseETag(tag)
+  require.NoError(t, err, `Unexpected error parsing ETag.`)
+  assert.Equal(t, trivialOrgSummary.Version.Int64, version, `Unexpected version.`)
+}
+
+func TestParseIfMatch(t *testing.T) {
+  version, err := ParseIfMatch(``)
+  assert.NoError(t, err, `Unexpected error for empty header.`)
+  assert.False(t, version.Valid, `Unexpected version for empty header.`)
+  version, err = ParseIfMatch(`*`)
+  assert.NoError(t, err, `Unexpected error for wildcard header.`)
+  assert.False(t, version.Valid, `Unexpected version for wildcard header.`)
+  version, err = ParseIfMatch(` "12" `)
+  assert.NoError(t, err, `Unexpected error for valid header.`)
+  assert.Equal(t, int64(12), version.Int64, `Unexpected version.`)
+
+  for _, bad := range []string{`12`, `W/"12"`, `"abc"`, `"1", "2"`} {
+    _, err = ParseIfMatch(bad)
+    assert.Errorf(t, err, `Unexpected non-error for header '%s'.`, bad)
+  }
+}
@@ -0,0 +1,578 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "log"
+  "sync"
+  "time"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// EventType identifies an Org lifecycle event.
+type EventType string
+
+const (
+  EventOrgCreated  EventType = `OrgCreated`
+  EventOrgUpdated  EventType = `OrgUpdated`
+  EventOrgArchived EventType = `OrgArchived`
+  EventOrgRestored EventType = `OrgRestored`
+)
+
+// auditEventTypes maps each audited change to the event it raises.
+var auditEventTypes = map[AuditAction]EventType{
+  AuditCreate: EventOrgCreated,
+  AuditUpdate: EventOrgUpdated,
+  AuditArchive: EventOrgArchived,
+  AuditRestore: EventOrgRestored,
+}
+
+// Event is an Org lifecycle event, carrying the Org as it stood after the
+// change (in Unix seconds) with its legal ID masked. Events are delivered at
+// least once and, where a delivery is retried, possibly out of order; the
+// Org's Version may be used to discard stale events.
+type Event struct {
+  Id       int64     `json:"id"`
+  Type     EventType `json:"type"`
+  OrgPubId string    `json:"orgPubId"`
+  At       int64     `json:"at"`
+  Org      *Org      `json:"org"`
+}
+
+// EventSink receives Org lifecycle events from a Dispatcher. An error causes
+// the event to be redelivered later, so sinks should be idempotent.
+type EventSink interface {
+  HandleEvent(e *Event, ctx context.Context) error
+}
+
+// EventSinkFunc adapts a function to the EventSink interface.
+type EventSinkFunc func(*Event, context.Context) error
+
+func (f EventSinkFunc) HandleEvent(e *Event, ctx context.Context) error {
+  return f(e, ctx)
+}
+
+// appendEventInTxn adds the event raised by the change to the outbox as part
+// of the transaction, rolling back the transaction on failure. The event is
+// only visible to the Dispatcher once the transaction commits.
+func appendEventInTxn(action AuditAction, o *Org, ctx context.Context, txn *sql.Tx) rest.RestError {
+  payload := o.Clone()
+  payload.ChangeDesc = nil
+  payload.RedactLegalID()
+  data, err := json.Marshal(payload)
+  if err == nil {
+    _, err = txn.Stmt(createEventQuery).ExecContext(ctx, auditEventTypes[action], o.Id, data)
+  }
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not record org event.`, err)
+  }
+
+  return nil
+}
+
+// EventRetryBaseDelay and EventRetryMaxDelay bound the exponential backoff
+// between delivery attempts. After EventMaxAttempts, the event is
+// dead-lettered: it is set aside, with its last error, and no longer retried.
+var EventRetryBaseDelay = 5 * time.Second
+var EventRetryMaxDelay = time.Hour
+var EventMaxAttempts = 12
+
+// EventRetryDelay is the delay before retrying an event which has failed the
+// given number of delivery attempts.
+func EventRetryDelay(attempts int) time.Duration {
+  return retryDelay(EventRetryBaseDelay, EventRetryMaxDelay, attempts)
+}
+
+// retryDelay doubles the base delay for each failed attempt after the first,
+// up to the max delay.
+func retryDelay(base time.Duration, max time.Duration, attempts int) time.Duration {
+  delay := base
+  for i := 1; i < attempts && delay < max; i += 1 {
+    delay *= 2
+  }
+  if delay > max {
+    delay = max
+  }
+
+  return delay
+}
+
+// eventLease is how long a Dispatcher has to deliver a claimed event before
+// it may be claimed by another.
+const eventLease = time.Minute
+
+// maxSinkNameLength is the longest name under which a sink may subscribe.
+const maxSinkNameLength = 64
+
+// Dispatcher delivers the events in the outbox to the subscribed EventSinks.
+// Several Dispatchers, in one or many processes, may work the same outbox;
+// each event is claimed by one Dispatcher at a time.
+type Dispatcher struct {
+  // Interval is the time between polls of the outbox.
+  Interval  time.Duration
+  // BatchSize limits the number of events claimed per poll.
+  BatchSize int
+  mu        sync.RWMutex
+  sinks     []namedSink
+}
+
+type namedSink struct {
+  name string
+  sink EventSink
+}
+
+// NewDispatcher creates a Dispatcher with no subscribers, polling every
+// second.
+func NewDispatcher() *Dispatcher {
+  return &Dispatcher{Interval: time.Second, BatchSize: 100}
+}
+
+// Subscribe adds the sink to those receiving events. Deliveries are tracked
+// per sink under the name, so the name must be stable across restarts and
+// may be at most 64 characters. Subscribing a second sink under the same name
+// panics.
+func (d *Dispatcher) Subscribe(name string, sink EventSink) {
+  if name == `` || len(name) > maxSinkNameLength {
+    panic(fmt.Sprintf(`orgs: invalid event sink name '%s'`, name))
+  }
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  for _, s := range d.sinks {
+    if s.name == name {
+      panic(fmt.Sprintf(`orgs: event sink '%s' already subscribed`, name))
+    }
+  }
+  d.sinks = append(d.sinks, namedSink{name, sink})
+}
+
+// claimedEvent is an event leased by a Dispatcher along with its delivery
+// state.
+type claimedEvent struct {
+  event    *Event
+  attempts int
+  // accepted holds the names of the sinks which have already accepted the
+  // event.
+  accepted map[string]bool
+}
+
+// deliver hands the event to each sink which has yet to accept it, recording
+// each acceptance. A sink failing does not keep the event from the others,
+// and when the event is retried only the sinks which failed see it again.
+func (d *Dispatcher) deliver(c *claimedEvent, ctx context.Context) error {
+  d.mu.RLock()
+  sinks := d.sinks
+  d.mu.RUnlock()
+  var failure error
+  for _, s := range sinks {
+    if c.accepted[s.name] {
+      continue
+    }
+    if err := s.sink.HandleEvent(c.event, ctx); err != nil {
+      if failure == nil {
+        failure = fmt.Errorf(`sink '%s': %s`, s.name, err)
+      }
+      continue
+    }
+    if _, err := acceptEventQuery.ExecContext(ctx, c.event.Id, s.name); err != nil {
+      return err
+    }
+  }
+
+  return failure
+}
+
+// DispatchPending delivers a batch of the events which are due, returning the
+// number delivered. Failed deliveries are rescheduled according to
+// EventRetryDelay until EventMaxAttempts is reached, when the event is
+// dead-lettered. Events whose payload cannot be read are dead-lettered
+// immediately. The sinks are called outside of any transaction; the events
+// are merely leased while they are delivered.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+  claimed, err := claimEvents(d.BatchSize, ctx)
+  if err != nil {
+    return 0, err
+  }
+  delivered := 0
+  for _, c := range claimed {
+    e := c.event
+    deliverErr := d.deliver(c, ctx)
+    switch {
+    case deliverErr == nil:
+      delivered += 1
+      _, err = deliverEventQuery.ExecContext(ctx, e.Id)
+    case c.attempts + 1 >= EventMaxAttempts:
+      log.Printf("Dead-lettering org event %d (%s) after %d attempts: %s", e.Id, e.Type, c.attempts + 1, deliverErr)
+      _, err = failEventQuery.ExecContext(ctx, lastError(deliverErr), e.Id)
+    default:
+      delay := EventRetryDelay(c.attempts + 1)
+      log.Printf("Delivery of org event %d (%s) failed; retrying in %s: %s", e.Id, e.Type, delay, deliverErr)
+      _, err = retryEventQuery.ExecContext(ctx, int64(delay / time.Second), lastError(deliverErr), e.Id)
+    }
+    if err != nil {
+      return delivered, err
+    }
+  }
+
+  return delivered, nil
+}
+
+// Run polls the outbox, dispatching events, until the context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+  ticker := time.NewTicker(d.Interval)
+  defer ticker.Stop()
+  for {
+    // Keep going while there's a backlog.
+    for {
+      count, err := d.DispatchPending(ctx)
+      if err != nil {
+        log.Printf("Could not dispatch org events: %s", err)
+      }
+      if err != nil || count < d.BatchSize {
+        break
+      }
+    }
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// claimEvents leases a batch of due events, dead-lettering any whose payload
+// cannot be read.
+func claimEvents(limit int, ctx context.Context) ([]*claimedEvent, error) {
+  txn, err := sqldb.DB.BeginTx(ctx, nil)
+  if err != nil {
+    return nil, err
+  }
+  defer txn.Rollback()
+
+  rows, err := txn.Stmt(claimEventsQuery).QueryContext(ctx, limit)
+  if err != nil {
+    return nil, err
+  }
+  candidates := make([]*claimedEvent, 0)
+  payloads := make([][]byte, 0)
+  for rows.Next() {
+    c := &claimedEvent{event: &Event{}, accepted: make(map[string]bool)}
+    var payload []byte
+    if err := rows.Scan(&c.event.Id, &c.event.Type, &c.event.OrgPubId, &c.event.At, &c.attempts, &payload); err != nil {
+      rows.Close()
+      return nil, err
+    }
+    candidates = append(candidates, c)
+    payloads = append(payloads, payload)
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+
+  claimed := make([]*claimedEvent, 0, len(candidates))
+  for i, c := range candidates {
+    if err := json.Unmarshal(payloads[i], &c.event.Org); err != nil {
+      log.Printf("Dead-lettering org event %d (%s) with malformed payload: %s", c.event.Id, c.event.Type, err)
+      if _, err := txn.Stmt(failEventQuery).ExecContext(ctx, lastError(fmt.Errorf(`malformed payload: %s`, err)), c.event.Id); err != nil {
+        return nil, err
+      }
+      continue
+    }
+    if _, err := txn.Stmt(leaseEventQuery).ExecContext(ctx, int64(eventLease / time.Second), c.event.Id); err != nil {
+      return nil, err
+    }
+    if err := loadAcceptedSinksInTxn(c, ctx, txn); err != nil {
+      return nil, err
+    }
+    claimed = append(claimed, c)
+  }
+
+  return claimed, txn.Commit()
+}
+
+func loadAcceptedSinksInTxn(c *claimedEvent, ctx context.Context, txn *sql.Tx) error {
+  rows, err := txn.Stmt(listAcceptedSinksQuery).QueryContext(ctx, c.event.Id)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    var name string
+    if err := rows.Scan(&name); err != nil {
+      return err
+    }
+    c.accepted[name] = true
+  }
+
+  return rows.Err()
+}
+
+// maxLastErrorLength is the length of the 'last_error' columns.
+const maxLastErrorLength = 1024
+
+// lastError renders the error for the 'last_error' columns.
+func lastError(err error) string {
+  msg := err.Error()
+  if len(msg) > maxLastErrorLength {
+    msg = msg[:maxLastErrorLength]
+  }
+  return msg
+}
+
+// EventGapWindow bounds the time a transaction is expected to take to commit
+// once it has added an event to the outbox. Event IDs are allocated as events
+// are added but only become visible as their transactions commit, so readers
+// following the outbox by ID (ListChanges, EventStream, and SearchIndexer)
+// hold back at a gap in the IDs which is followed by an event added within
+// the window, as the missing event may yet commit. Older gaps are taken to be
+// rolled back transactions and passed over. This relies on the database
+// allocating IDs one apart.
+var EventGapWindow = 10 * time.Second
+
+func gapWindowSeconds() int64 {
+  return int64(EventGapWindow / time.Second)
+}
+
+// committedPrefix returns the number of the events, read in ID order after
+// afterId, which may safely be consumed: those before the first gap in the
+// IDs which may yet be filled. recent flags the events added within the
+// EventGapWindow.
+func committedPrefix(afterId int64, ids []int64, recent []bool) int {
+  next := afterId + 1
+  for i, id := range ids {
+    if id != next && recent[i] {
+      return i
+    }
+    next = id + 1
+  }
+  return len(ids)
+}
+
+// readOutboxOrgs reads the IDs of up to limit committed events following
+// afterId, along with the public IDs of their Orgs. See EventGapWindow.
+func readOutboxOrgs(afterId int64, limit int64, ctx context.Context) ([]int64, []string, error) {
+  rows, err := readOutboxOrgsQuery.QueryContext(ctx, gapWindowSeconds(), afterId, limit)
+  if err != nil {
+    return nil, nil, err
+  }
+  defer rows.Close()
+
+  ids := make([]int64, 0)
+  pubIds := make([]string, 0)
+  recent := make([]bool, 0)
+  for rows.Next() {
+    var id int64
+    var pubId string
+    var isRecent bool
+    if err := rows.Scan(&id, &pubId, &isRecent); err != nil {
+      return nil, nil, err
+    }
+    ids, pubIds, recent = append(ids, id), append(pubIds, pubId), append(recent, isRecent)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, nil, err
+  }
+  count := committedPrefix(afterId, ids, recent)
+
+  return ids[:count], pubIds[:count], nil
+}
+
+// eventHorizon finds the ID of the last event before which every event has
+// committed (see EventGapWindow), or 0 if there are none. The horizon is never
+// before the pruned events (see EventRetention).
+func eventHorizon(ctx context.Context) (int64, error) {
+  var horizon int64
+  if err := settledEventIdQuery.QueryRowContext(ctx, gapWindowSeconds()).Scan(&horizon); err != nil && err != sql.ErrNoRows {
+    return 0, err
+  }
+  prunedId, err := prunedEventId(ctx)
+  if err != nil {
+    return 0, err
+  }
+  if horizon < prunedId {
+    horizon = prunedId
+  }
+  for {
+    ids, _, err := readOutboxOrgs(horizon, MaxListLimit, ctx)
+    if err != nil {
+      return 0, err
+    }
+    if len(ids) == 0 {
+      return horizon, nil
+    }
+    horizon = ids[len(ids) - 1]
+  }
+}
+
+// EventRetention is how long settled events are kept in the outbox: those
+// delivered or dead-lettered, along with their webhook deliveries. Older
+// events are pruned by PruneEvents, oldest first, stopping at the first event
+// which is yet to settle or which has a webhook delivery pending. Readers
+// following the outbox must therefore keep up within the retention; a
+// ChangeToken or 'Last-Event-ID' from before the pruned horizon is rejected
+// as expired, and a SearchIndex behind it is rebuilt. Retention shorter than
+// the EventGapWindow is taken as the window.
+var EventRetention = 30 * 24 * time.Hour
+
+// PruneEvents deletes the settled events older than the EventRetention,
+// returning the number deleted, and advances the pruned horizon.
+func PruneEvents(ctx context.Context) (int64, error) {
+  retention := EventRetention
+  if retention < EventGapWindow {
+    retention = EventGapWindow
+  }
+  txn, err := sqldb.DB.BeginTx(ctx, nil)
+  if err != nil {
+    return 0, err
+  }
+  defer txn.Rollback()
+
+  // The first event to keep; every event before it is pruned.
+  var keepId int64
+  if err := txn.Stmt(firstRetainedEventIdQuery).QueryRowContext(ctx, int64(retention / time.Second)).Scan(&keepId); err != nil {
+    return 0, err
+  }
+  for _, stmt := range []*sql.Stmt{pruneEventSinksQuery, pruneEventDeliveriesQuery} {
+    if _, err := txn.Stmt(stmt).ExecContext(ctx, keepId); err != nil {
+      return 0, err
+    }
+  }
+  res, err := txn.Stmt(pruneEventsQuery).ExecContext(ctx, keepId)
+  if err != nil {
+    return 0, err
+  }
+  pruned, err := res.RowsAffected()
+  if err != nil {
+    return 0, err
+  }
+  if _, err := txn.Stmt(advancePrunedEventIdQuery).ExecContext(ctx, keepId - 1); err != nil {
+    return 0, err
+  }
+
+  return pruned, txn.Commit()
+}
+
+// prunedEventId returns the ID through which events have been pruned, or 0
+// if none have been. Following the outbox from before this ID would miss
+// events.
+func prunedEventId(ctx context.Context) (int64, error) {
+  var prunedId int64
+  if err := prunedEventIdQuery.QueryRowContext(ctx).Scan(&prunedId); err != nil && err != sql.ErrNoRows {
+    return 0, err
+  }
+
+  return prunedId, nil
+}
+
+// EventPruner periodically prunes the outbox; see EventRetention. Several
+// EventPruners may run at once.
+type EventPruner struct {
+  // Interval is the time between prunings.
+  Interval time.Duration
+}
+
+// NewEventPruner creates an EventPruner pruning every hour.
+func NewEventPruner() *EventPruner {
+  return &EventPruner{Interval: time.Hour}
+}
+
+// Run prunes the outbox, starting immediately, until the context is done.
+func (p *EventPruner) Run(ctx context.Context) {
+  ticker := time.NewTicker(p.Interval)
+  defer ticker.Stop()
+  for {
+    if _, err := PruneEvents(ctx); err != nil {
+      log.Printf("Could not prune org events: %s", err)
+    }
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// DefaultDispatcher is the Dispatcher used by Subscribe.
+var DefaultDispatcher = NewDispatcher()
+
+// Subscribe adds the sink to those receiving events from the
+// DefaultDispatcher under the name. See Dispatcher.Subscribe.
+func Subscribe(name string, sink EventSink) {
+  DefaultDispatcher.Subscribe(name, sink)
+}
+
+const createEventStatement = `INSERT INTO org_outbox (event_type, org_id, payload) VALUES (?,?,?)`
+const claimEventsStatement = `SELECT ob.id, ob.event_type, e.pub_id, UNIX_TIMESTAMP(ob.created_at), ob.attempts, ob.payload FROM org_outbox ob JOIN entities e ON ob.org_id=e.id WHERE ob.delivered_at IS NULL AND ob.failed_at IS NULL AND ob.next_attempt_at <= NOW() ORDER BY ob.id LIMIT ? FOR UPDATE SKIP LOCKED`
+const leaseEventStatement = `UPDATE org_outbox SET next_attempt_at=NOW() + INTERVAL ? SECOND WHERE id=?`
+const listAcceptedSinksStatement = `SELECT sink FROM org_outbox_sinks WHERE event_id=?`
+const acceptEventStatement = `INSERT IGNORE INTO org_outbox_sinks (event_id, sink) VALUES (?,?)`
+const deliverEventStatement = `UPDATE org_outbox SET delivered_at=NOW(), attempts=attempts+1, last_error=NULL WHERE id=?`
+const retryEventStatement = `UPDATE org_outbox SET attempts=attempts+1, next_attempt_at=NOW() + INTERVAL ? SECOND, last_error=? WHERE id=?`
+const failEventStatement = `UPDATE org_outbox SET attempts=attempts+1, failed_at=NOW(), last_error=? WHERE id=?`
+const readOutboxOrgsStatement = `SELECT ob.id, e.pub_id, ob.created_at > NOW() - INTERVAL ? SECOND FROM org_outbox ob JOIN entities e ON ob.org_id=e.id WHERE ob.id > ? ORDER BY ob.id LIMIT ?`
+const settledEventIdStatement = `SELECT id FROM org_outbox WHERE created_at <= NOW() - INTERVAL ? SECOND ORDER BY id DESC LIMIT 1`
+const firstRetainedEventIdStatement = `SELECT COALESCE(MIN(ob.id), (SELECT COALESCE(MAX(id), 0) + 1 FROM org_outbox)) FROM org_outbox ob WHERE ob.created_at > NOW() - INTERVAL ? SECOND OR (ob.delivered_at IS NULL AND ob.failed_at IS NULL) OR EXISTS (SELECT 1 FROM org_webhook_deliveries d WHERE d.event_id=ob.id AND d.delivered_at IS NULL AND d.failed_at IS NULL)`
+const pruneEventSinksStatement = `DELETE FROM org_outbox_sinks WHERE event_id < ?`
+const pruneEventDeliveriesStatement = `DELETE FROM org_webhook_deliveries WHERE event_id < ?`
+const pruneEventsStatement = `DELETE FROM org_outbox WHERE id < ?`
+const advancePrunedEventIdStatement = `INSERT INTO org_outbox_pruned (id, through_id) VALUES (1, ?) ON DUPLICATE KEY UPDATE through_id=GREATEST(through_id, VALUES(through_id))`
+const prunedEventIdStatement = `SELECT through_id FROM org_outbox_pruned WHERE id=1`
+var createEventQuery, claimEventsQuery, leaseEventQuery, listAcceptedSinksQuery, acceptEventQuery, deliverEventQuery, retryEventQuery, failEventQuery, readOutboxOrgsQuery, settledEventIdQuery *sql.Stmt
+var firstRetainedEventIdQuery, pruneEventSinksQuery, pruneEventDeliveriesQuery, pruneEventsQuery, advancePrunedEventIdQuery, prunedEventIdQuery *sql.Stmt
+
+func setupEventsDB(db *sql.DB) {
+  var err error
+  if createEventQuery, err = db.Prepare(createEventStatement); err != nil {
+    log.Fatalf("mysql: prepare create event stmt: %v", err)
+  }
+  if claimEventsQuery, err = db.Prepare(claimEventsStatement); err != nil {
+    log.Fatalf("mysql: prepare claim events stmt: %v", err)
+  }
+  if leaseEventQuery, err = db.Prepare(leaseEventStatement); err != nil {
+    log.Fatalf("mysql: prepare lease event stmt: %v", err)
+  }
+  if listAcceptedSinksQuery, err = db.Prepare(listAcceptedSinksStatement); err != nil {
+    log.Fatalf("mysql: prepare list accepted sinks stmt: %v", err)
+  }
+  if acceptEventQuery, err = db.Prepare(acceptEventStatement); err != nil {
+    log.Fatalf("mysql: prepare accept event stmt: %v", err)
+  }
+  if deliverEventQuery, err = db.Prepare(deliverEventStatement); err != nil {
+    log.Fatalf("mysql: prepare deliver event stmt: %v", err)
+  }
+  if retryEventQuery, err = db.Prepare(retryEventStatement); err != nil {
+    log.Fatalf("mysql: prepare retry event stmt: %v", err)
+  }
+  if failEventQuery, err = db.Prepare(failEventStatement); err != nil {
+    log.Fatalf("mysql: prepare fail event stmt: %v", err)
+  }
+  if readOutboxOrgsQuery, err = db.Prepare(readOutboxOrgsStatement); err != nil {
+    log.Fatalf("mysql: prepare read outbox orgs stmt: %v", err)
+  }
+  if settledEventIdQuery, err = db.Prepare(settledEventIdStatement); err != nil {
+    log.Fatalf("mysql: prepare settled event ID stmt: %v", err)
+  }
+  if firstRetainedEventIdQuery, err = db.Prepare(firstRetainedEventIdStatement); err != nil {
+    log.Fatalf("mysql: prepare first retained event ID stmt: %v", err)
+  }
+  if pruneEventSinksQuery, err = db.Prepare(pruneEventSinksStatement); err != nil {
+    log.Fatalf("mysql: prepare prune event sinks stmt: %v", err)
+  }
+  if pruneEventDeliveriesQuery, err = db.Prepare(pruneEventDeliveriesStatement); err != nil {
+    log.Fatalf("mysql: prepare prune event deliveries stmt: %v", err)
+  }
+  if pruneEventsQuery, err = db.Prepare(pruneEventsStatement); err != nil {
+    log.Fatalf("mysql: prepare prune events stmt: %v", err)
+  }
+  if advancePrunedEventIdQuery, err = db.Prepare(advancePrunedEventIdStatement); err != nil {
+    log.Fatalf("mysql: prepare advance pruned event ID stmt: %v", err)
+  }
+  if prunedEventIdQuery, err = db.Prepare(prunedEventIdStatement); err != nil {
+    log.Fatalf("mysql: prepare pruned event ID stmt: %v", err)
+  }
+}
@@ -0,0 +1,150 @@
+package orgs_test
+
+import (
+  "context"
+  "fmt"
+  "testing"
+  "time"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestEventRetryDelay(t *testing.T) {
+  assert.Equal(t, EventRetryBaseDelay, EventRetryDelay(1), `Unexpected first retry delay.`)
+  assert.Equal(t, 2 * EventRetryBaseDelay, EventRetryDelay(2), `Unexpected second retry delay.`)
+  assert.Equal(t, 8 * EventRetryBaseDelay, EventRetryDelay(4), `Unexpected fourth retry delay.`)
+  assert.Equal(t, EventRetryMaxDelay, EventRetryDelay(100), `Delay not capped.`)
+}
+
+// recordingSink records the events for a single Org.
+type recordingSink struct {
+  pubId  string
+  events []*Event
+}
+
+func (s *recordingSink) HandleEvent(e *Event, ctx context.Context) error {
+  if e.OrgPubId == s.pubId {
+    s.events = append(s.events, e)
+  }
+  return nil
+}
+
+func testOrgEvents(t *testing.T) {
+  ctx := context.Background()
+  eventful := someOrg.Clone()
+  eventful.SetDisplayName(`Eventful Org`)
+  eventful, restErr := CreateOrg(eventful, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  failing := NewDispatcher()
+  failing.BatchSize = 1000
+  failing.Subscribe(`failing`, EventSinkFunc(func(e *Event, ctx context.Context) error {
+    return fmt.Errorf(`unavailable`)
+  }))
+  count, err := failing.DispatchPending(ctx)
+  require.NoError(t, err, `Unexpected error dispatching events.`)
+  assert.Equal(t, 0, count, `Unexpected deliveries to failing sink.`)
+
+  // The failed creation event is held back for the retry delay.
+  _, err = ArchiveOrg(eventful.PubId.String, ctx)
+  require.NoError(t, err, `Unexpected error archiving org.`)
+
+  sink := &recordingSink{pubId: eventful.PubId.String}
+  dispatcher := NewDispatcher()
+  dispatcher.BatchSize = 1000
+  dispatcher.Subscribe(`recording`, sink)
+  _, err = dispatcher.DispatchPending(ctx)
+  require.NoError(t, err, `Unexpected error dispatching events.`)
+  require.Len(t, sink.events, 1, `Unexpected number of events.`)
+  assert.Equal(t, EventOrgArchived, sink.events[0].Type, `Unexpected event type.`)
+  assert.True(t, sink.events[0].Org.IsArchived(), `Event org not archived.`)
+}
+
+// dispatchAll dispatches the due events with the sinks, each subscribed under
+// its key.
+func dispatchAll(t *testing.T, sinks map[string]EventSink, ctx context.Context) int {
+  dispatcher := NewDispatcher()
+  dispatcher.BatchSize = 1000
+  for name, sink := range sinks {
+    dispatcher.Subscribe(name, sink)
+  }
+  count, err := dispatcher.DispatchPending(ctx)
+  require.NoError(t, err, `Unexpected error dispatching events.`)
+  return count
+}
+
+func eventFailed(t *testing.T, id int64) bool {
+  var failed bool
+  require.NoError(t, sqldb.DB.QueryRow(`SELECT failed_at IS NOT NULL FROM org_outbox WHERE id=?`, id).Scan(&failed), `Unexpected error checking event.`)
+  return failed
+}
+
+func testOrgEventsPerSink(t *testing.T) {
+  ctx := context.Background()
+  defer func(delay time.Duration) { EventRetryBaseDelay = delay }(EventRetryBaseDelay)
+  EventRetryBaseDelay = 0
+  eventful := someOrg.Clone()
+  eventful.SetDisplayName(`Eventful Sinks Org`)
+  eventful, restErr := CreateOrg(eventful, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  steady := &recordingSink{pubId: eventful.PubId.String}
+  flaky := &recordingSink{pubId: eventful.PubId.String}
+  fail := true
+  flakySink := EventSinkFunc(func(e *Event, ctx context.Context) error {
+    if fail && e.OrgPubId == eventful.PubId.String {
+      return fmt.Errorf(`unavailable`)
+    }
+    return flaky.HandleEvent(e, ctx)
+  })
+  sinks := map[string]EventSink{`steady`: steady, `flaky`: flakySink}
+  dispatchAll(t, sinks, ctx)
+  require.Len(t, steady.events, 1, `Failing sink kept the event from the steady sink.`)
+  assert.Empty(t, flaky.events, `Unexpected delivery to failing sink.`)
+
+  fail = false
+  dispatchAll(t, sinks, ctx)
+  assert.Len(t, steady.events, 1, `Event redelivered to the sink which accepted it.`)
+  require.Len(t, flaky.events, 1, `Event not redelivered to the failed sink.`)
+  assert.Equal(t, steady.events[0].Id, flaky.events[0].Id, `Unexpected redelivered event.`)
+}
+
+func testOrgEventsDeadLetter(t *testing.T) {
+  ctx := context.Background()
+  defer func(attempts int) { EventMaxAttempts = attempts }(EventMaxAttempts)
+  EventMaxAttempts = 1
+  eventful := someOrg.Clone()
+  eventful.SetDisplayName(`Eventful Dead Org`)
+  eventful, restErr := CreateOrg(eventful, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  // A malformed payload does not hold up the rest of the batch.
+  res, err := sqldb.DB.Exec(`INSERT INTO org_outbox (event_type, org_id, payload) VALUES (?,?,?)`, EventOrgUpdated, eventful.Id, `{`)
+  require.NoError(t, err, `Unexpected error adding malformed event.`)
+  malformedId, err := res.LastInsertId()
+  require.NoError(t, err, `Unexpected error adding malformed event.`)
+  defer sqldb.DB.Exec(`DELETE FROM org_outbox WHERE id=?`, malformedId)
+  _, restErr = ArchiveOrg(eventful.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error archiving org.`)
+
+  var attempted []*Event
+  sinks := map[string]EventSink{`failing`: EventSinkFunc(func(e *Event, ctx context.Context) error {
+    if e.OrgPubId == eventful.PubId.String {
+      attempted = append(attempted, e)
+      return fmt.Errorf(`unavailable`)
+    }
+    return nil
+  })}
+  dispatchAll(t, sinks, ctx)
+  require.Len(t, attempted, 2, `Unexpected number of attempted events.`)
+  assert.True(t, eventFailed(t, malformedId), `Malformed event not dead-lettered.`)
+  for _, e := range attempted {
+    assert.True(t, eventFailed(t, e.Id), `Event not dead-lettered after max attempts.`)
+  }
+
+  dispatchAll(t, sinks, ctx)
+  assert.Len(t, attempted, 2, `Dead-lettered events retried.`)
+}
@@ -0,0 +1,299 @@
+package orgs
+
+import (
+  "bytes"
+  "context"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "regexp"
+  "strconv"
+  "strings"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ExportFormat identifies the encoding of a bulk export.
+type ExportFormat string
+
+const (
+  ExportCSV    ExportFormat = `csv`
+  ExportNDJSON ExportFormat = `ndjson`
+)
+
+// ParseExportFormat validates a format name.
+func ParseExportFormat(name string) (ExportFormat, error) {
+  switch format := ExportFormat(strings.ToLower(name)); format {
+  case ExportCSV, ExportNDJSON:
+    return format, nil
+  default:
+    return ``, fmt.Errorf(`unknown export format '%s'`, name)
+  }
+}
+
+// ExportOptions control a bulk export. Columns selects and orders the exported
+// fields; see DefaultExportColumns. For NDJSON, the address columns all select
+// the 'addresses' field. ExcelCompatible CSV output begins with a UTF-8 byte
+// order mark, uses CRLF line endings, and defuses values which spreadsheets
+// would interpret as formulas.
+type ExportOptions struct {
+  Format          ExportFormat
+  Columns         []string
+  ExcelCompatible bool
+}
+
+// DefaultExportColumns are exported when no columns are specified. Column
+// names follow those accepted by ReadImportRows.
+var DefaultExportColumns = []string{
+  `pubId`, `displayName`, `summary`, `email`, `phone`, `homepage`, `logoURL`,
+  `parentPubId`, `active`, `label`, `address1`, `address2`, `city`, `state`,
+  `zip`,
+}
+
+func nullString(s nulls.String) string {
+  if !s.Valid {
+    return ``
+  }
+  return s.String
+}
+
+func nullInt64(i nulls.Int64) string {
+  if !i.Valid {
+    return ``
+  }
+  return strconv.FormatInt(i.Int64, 10)
+}
+
+func nullFloat64(f nulls.Float64) string {
+  if !f.Valid {
+    return ``
+  }
+  return strconv.FormatFloat(f.Float64, 'f', -1, 64)
+}
+
+// exportColumns extract the CSV value of each exportable column. The address
+// columns are taken from the first address.
+var exportColumns = map[string]func(*Org) string{
+  `pubId`: func(o *Org) string { return nullString(o.PubId) },
+  `lastUpdated`: func(o *Org) string { return nullInt64(o.LastUpdated) },
+  `displayName`: func(o *Org) string { return nullString(o.DisplayName) },
+  `summary`: func(o *Org) string { return nullString(o.Summary) },
+  `email`: func(o *Org) string { return nullString(o.Email) },
+  `phone`: func(o *Org) string { return nullString(o.Phone) },
+  `homepage`: func(o *Org) string { return nullString(o.Homepage) },
+  `logoURL`: func(o *Org) string { return nullString(o.LogoURL) },
+  `parentPubId`: func(o *Org) string { return nullString(o.ParentPubId) },
+  `archivedAt`: func(o *Org) string { return nullInt64(o.ArchivedAt) },
+  `authId`: func(o *Org) string { return nullString(o.AuthId) },
+  `legalID`: func(o *Org) string { return nullString(o.LegalID) },
+  `legalIDType`: func(o *Org) string { return nullString(o.LegalIDType) },
+  `active`: func(o *Org) string {
+    if !o.Active.Valid {
+      return ``
+    }
+    return strconv.FormatBool(o.Active.Bool)
+  },
+  `label`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.Label) }) },
+  `address1`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.Address1) }) },
+  `address2`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.Address2) }) },
+  `city`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.City) }) },
+  `state`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.State) }) },
+  `zip`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullString(a.Zip) }) },
+  `lat`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullFloat64(a.Lat) }) },
+  `lng`: func(o *Org) string { return firstAddress(o, func(a *locations.Address) string { return nullFloat64(a.Lng) }) },
+}
+
+func firstAddress(o *Org, get func(*locations.Address) string) string {
+  if len(o.Addresses) == 0 {
+    return ``
+  }
+  return get(o.Addresses[0])
+}
+
+// isExportAddressColumn identifies the columns drawn from the Org addresses.
+func isExportAddressColumn(column string) bool {
+  return importAddressColumns[column] || column == `lat` || column == `lng`
+}
+
+// orgExporter writes a single Org in the chosen format.
+type orgExporter func(*Org) error
+
+func newCSVExporter(w io.Writer, columns []string, excel bool) (orgExporter, func() error, error) {
+  if excel {
+    if _, err := w.Write([]byte("\uFEFF")); err != nil {
+      return nil, nil, err
+    }
+  }
+  writer := csv.NewWriter(w)
+  writer.UseCRLF = excel
+  if err := writer.Write(columns); err != nil {
+    return nil, nil, err
+  }
+
+  record := make([]string, len(columns))
+  export := func(o *Org) error {
+    for i, column := range columns {
+      record[i] = exportColumns[column](o)
+      if excel {
+        record[i] = defuseFormula(record[i])
+      }
+    }
+    return writer.Write(record)
+  }
+  flush := func() error {
+    writer.Flush()
+    return writer.Error()
+  }
+
+  return export, flush, nil
+}
+
+// exportPhoneMatcher matches international phone numbers (see FormatPhone),
+// which can call nothing.
+var exportPhoneMatcher = regexp.MustCompile(`^\+\d[\d\s().\-/]*( ext\. \d{1,7})?$`)
+
+// defuseFormula prefixes values which a spreadsheet would treat as a formula
+// with a single quote, which spreadsheets treat as a text marker. A leading
+// tab or carriage return is no defense, as spreadsheets skip over them, but
+// phone numbers are left as is.
+func defuseFormula(value string) string {
+  if value == `` || exportPhoneMatcher.MatchString(value) {
+    return value
+  }
+  if strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+    return `'` + value
+  }
+  return value
+}
+
+func newNDJSONExporter(w io.Writer, columns []string) (orgExporter, func() error) {
+  fields := make(map[string]bool, len(columns))
+  for _, column := range columns {
+    if isExportAddressColumn(column) {
+      fields[`addresses`] = true
+    } else {
+      fields[column] = true
+    }
+  }
+
+  export := func(o *Org) error {
+    data, err := json.Marshal(o)
+    if err != nil {
+      return err
+    }
+    var full map[string]json.RawMessage
+    if err := json.Unmarshal(data, &full); err != nil {
+      return err
+    }
+    selected := make(map[string]json.RawMessage, len(fields))
+    for field := range fields {
+      if value, ok := full[field]; ok {
+        selected[field] = value
+      }
+    }
+    var line bytes.Buffer
+    if err := json.NewEncoder(&line).Encode(selected); err != nil {
+      return err
+    }
+    _, err = w.Write(line.Bytes())
+    return err
+  }
+
+  return export, func() error { return nil }
+}
+
+// ValidateExportOptions checks the export format and columns, filling in the
+// default columns if none are specified.
+func ValidateExportOptions(opts *ExportOptions) error {
+  if _, err := ParseExportFormat(string(opts.Format)); err != nil {
+    return err
+  }
+  if len(opts.Columns) == 0 {
+    opts.Columns = DefaultExportColumns
+  }
+  for _, column := range opts.Columns {
+    if _, ok := exportColumns[column]; !ok {
+      return fmt.Errorf(`unknown export column '%s'`, column)
+    }
+  }
+
+  return nil
+}
+
+// ExportOrgs streams the Orgs matching the list parameters (ignoring paging),
+// along with their addresses, to the writer. Records are written as they are
+// read from the database, so memory use does not grow with the number of
+// Orgs. Invalid options result in a rest.BadRequestError before anything is
+// written.
+func ExportOrgs(w io.Writer, params *ListParams, opts *ExportOptions, ctx context.Context) rest.RestError {
+  if err := ValidateExportOptions(opts); err != nil {
+    return rest.BadRequestError(`Invalid export options.`, err)
+  }
+  sort, ok := OrgsSorts[params.Sort]
+  if !ok {
+    return rest.BadRequestError(fmt.Sprintf(`Unknown sort '%s'.`, params.Sort), nil)
+  }
+  whereBit, whereParams, restErr := listWhereBit(params)
+  if restErr != nil {
+    return restErr
+  }
+
+  // Addresses for each Org must arrive together, hence the pub_id tiebreak.
+  query := CommonOrgGet + whereBit + `ORDER BY ` + sort + `, e.pub_id ASC, ea.idx ASC`
+  rows, err := sqldb.DB.QueryContext(ctx, query, whereParams...)
+  if err != nil {
+    return rest.ServerError(`Could not retrieve orgs for export.`, err)
+  }
+  defer rows.Close()
+
+  var export orgExporter
+  var flush func() error
+  if opts.Format == ExportCSV {
+    if export, flush, err = newCSVExporter(w, opts.Columns, opts.ExcelCompatible); err != nil {
+      return rest.ServerError(`Could not write export.`, err)
+    }
+  } else {
+    export, flush = newNDJSONExporter(w, opts.Columns)
+  }
+
+  var current *Org
+  emit := func() error {
+    current.FormatOut()
+    return export(current)
+  }
+  for rows.Next() {
+    org, address, err := ScanOrgDetail(rows)
+    if err != nil {
+      return rest.ServerError(`Problem reading orgs for export.`, err)
+    }
+    if current == nil || current.PubId != org.PubId {
+      if current != nil {
+        if err := emit(); err != nil {
+          return rest.ServerError(`Could not write export.`, err)
+        }
+      }
+      current = org
+      current.Addresses = make(locations.Addresses, 0)
+    }
+    if address.LocationId.Valid {
+      current.Addresses = append(current.Addresses, address)
+    }
+  }
+  if err := rows.Err(); err != nil {
+    return rest.ServerError(`Problem reading orgs for export.`, err)
+  }
+  if current != nil {
+    if err := emit(); err != nil {
+      return rest.ServerError(`Could not write export.`, err)
+    }
+  }
+  if err := flush(); err != nil {
+    return rest.ServerError(`Could not write export.`, err)
+  }
+
+  return nil
+}
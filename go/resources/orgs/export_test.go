@@ -0,0 +1,78 @@
+package orgs_test
+
+import (
+  "bytes"
+  "context"
+  "encoding/json"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestParseExportFormat(t *testing.T) {
+  format, err := ParseExportFormat(`CSV`)
+  require.NoError(t, err, `Unexpected error parsing format.`)
+  assert.Equal(t, ExportCSV, format, `Unexpected format.`)
+
+  _, err = ParseExportFormat(`xlsx`)
+  assert.Error(t, err, `Unexpected non-error for unknown format.`)
+}
+
+func TestValidateExportOptions(t *testing.T) {
+  opts := &ExportOptions{Format: ExportNDJSON}
+  require.NoError(t, ValidateExportOptions(opts), `Unexpected error validating default options.`)
+  assert.Equal(t, DefaultExportColumns, opts.Columns, `Default columns not set.`)
+
+  opts = &ExportOptions{Format: ExportCSV, Columns: []string{`displayName`, `legalID`, `lat`}}
+  assert.NoError(t, ValidateExportOptions(opts), `Unexpected error for valid columns.`)
+
+  opts = &ExportOptions{Format: ExportCSV, Columns: []string{`displayName`, `foo`}}
+  assert.Error(t, ValidateExportOptions(opts), `Unexpected non-error for unknown column.`)
+
+  assert.Error(t, ValidateExportOptions(&ExportOptions{Format: `xml`}), `Unexpected non-error for unknown format.`)
+}
+
+func testOrgExport(t *testing.T) {
+  ctx := context.Background()
+  params := &ListParams{Sort: `name-asc`, Search: `CSV Org A`}
+
+  var out bytes.Buffer
+  opts := &ExportOptions{Format: ExportCSV, Columns: []string{`displayName`, `email`, `city`}}
+  require.NoError(t, ExportOrgs(&out, params, opts, ctx), `Unexpected error exporting CSV.`)
+  assert.Equal(t, "displayName,email,city\nCSV Org A,a@test.com,Dayton\n", out.String(), `Unexpected CSV export.`)
+
+  out.Reset()
+  opts.ExcelCompatible = true
+  require.NoError(t, ExportOrgs(&out, params, opts, ctx), `Unexpected error exporting Excel CSV.`)
+  assert.True(t, strings.HasPrefix(out.String(), "\uFEFFdisplayName,"), `Missing byte order mark.`)
+  assert.Contains(t, out.String(), "Dayton\r\n", `Missing CRLF line ending.`)
+
+  risky := someOrg.Clone()
+  risky.SetDisplayName(`Risky Export Org`)
+  risky.SetSummary("\t=HYPERLINK(\"http://evil.test\")")
+  risky.SetPhone(`+44 20 7946 0958`)
+  _, restErr := CreateOrg(risky, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  out.Reset()
+  riskyParams := &ListParams{Sort: `name-asc`, Search: `Risky Export Org`}
+  riskyOpts := &ExportOptions{Format: ExportCSV, Columns: []string{`summary`, `phone`}, ExcelCompatible: true}
+  require.NoError(t, ExportOrgs(&out, riskyParams, riskyOpts, ctx), `Unexpected error exporting Excel CSV.`)
+  assert.Contains(t, out.String(), "\"'\t=HYPERLINK(\"\"http://evil.test\"\")\",+44 20 7946 0958\r\n", `Unexpected defusing.`)
+
+  out.Reset()
+  opts = &ExportOptions{Format: ExportNDJSON, Columns: []string{`displayName`, `city`}}
+  require.NoError(t, ExportOrgs(&out, params, opts, ctx), `Unexpected error exporting NDJSON.`)
+  lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+  require.Len(t, lines, 1, `Unexpected number of NDJSON records.`)
+  var record map[string]interface{}
+  require.NoError(t, json.Unmarshal([]byte(lines[0]), &record), `Could not decode NDJSON record.`)
+  assert.Len(t, record, 2, `Unexpected fields in NDJSON record.`)
+  assert.Equal(t, `CSV Org A`, record[`displayName`], `Unexpected display name.`)
+  assert.Contains(t, record, `addresses`, `Missing addresses.`)
+
+  err := ExportOrgs(&out, params, &ExportOptions{Format: ExportCSV, Columns: []string{`foo`}}, ctx)
+  assert.Error(t, err, `Unexpected non-error for unknown column.`)
+}
@@ -0,0 +1,155 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "strconv"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ListFilters narrows an Org list to the Orgs with the given attributes. Empty
+// (or null) filters are ignored.
+type ListFilters struct {
+  // States and Cities match Orgs with an address in any of the states or
+  // cities. When both are given, the same address must match both.
+  States  []string
+  Cities  []string
+  // Tags matches Orgs with any of the tags (see NormalizeTag).
+  Tags    []string
+  Active  nulls.Bool
+  HasLogo nulls.Bool
+}
+
+// hasLogoExpr is true for Orgs with a logo.
+const hasLogoExpr = `(o.logo_url IS NOT NULL AND o.logo_url <> '')`
+
+// whereBit generates the 'AND' clauses applying the filters.
+func (f *ListFilters) whereBit() (string, []interface{}) {
+  whereBit, whereParams := ``, make([]interface{}, 0)
+  if len(f.States) > 0 || len(f.Cities) > 0 {
+    whereBit += `AND EXISTS (SELECT 1 FROM entity_addresses fa JOIN locations fl ON fa.location_id=fl.id WHERE fa.entity_id=o.id AND fa.idx >= 0 `
+    if len(f.States) > 0 {
+      whereBit += `AND fl.state IN (` + placeholders(len(f.States)) + `) `
+      for _, state := range f.States {
+        whereParams = append(whereParams, state)
+      }
+    }
+    if len(f.Cities) > 0 {
+      whereBit += `AND fl.city IN (` + placeholders(len(f.Cities)) + `) `
+      for _, city := range f.Cities {
+        whereParams = append(whereParams, city)
+      }
+    }
+    whereBit += `) `
+  }
+  if len(f.Tags) > 0 {
+    whereBit += `AND EXISTS (SELECT 1 FROM org_tags ft WHERE ft.org_id=o.id AND ft.tag IN (` + placeholders(len(f.Tags)) + `)) `
+    for _, tag := range f.Tags {
+      whereParams = append(whereParams, NormalizeTag(tag))
+    }
+  }
+  if f.Active.Valid {
+    whereBit += `AND u.active=? `
+    whereParams = append(whereParams, f.Active.Bool)
+  }
+  if f.HasLogo.Valid {
+    if f.HasLogo.Bool {
+      whereBit += `AND ` + hasLogoExpr + ` `
+    } else {
+      whereBit += `AND NOT ` + hasLogoExpr + ` `
+    }
+  }
+
+  return whereBit, whereParams
+}
+
+// placeholders renders the parameter placeholders for an 'IN' list of the
+// given length.
+func placeholders(count int) string {
+  return strings.TrimSuffix(strings.Repeat(`?,`, count), `,`)
+}
+
+// FacetBucket counts the Orgs sharing a facet value.
+type FacetBucket struct {
+  Value string `json:"value"`
+  Count int64  `json:"count"`
+}
+
+// orgFacet describes how a facet is counted: the expression giving each Org's
+// value(s) and any join required by the expression.
+type orgFacet struct {
+  join    string
+  value   string
+  boolean bool
+}
+
+const facetAddressJoin = `JOIN entity_addresses fea ON o.id=fea.entity_id AND fea.idx >= 0 JOIN locations floc ON fea.location_id=floc.id `
+
+// orgFacets names the facets which may be requested with a list. An Org with
+// addresses in several states or cities, or with several tags, is counted
+// once under each.
+var orgFacets = map[string]orgFacet{
+  `state`: {facetAddressJoin, `floc.state`, false},
+  `city`: {facetAddressJoin, `floc.city`, false},
+  `tag`: {`JOIN org_tags ftag ON o.id=ftag.org_id `, `ftag.tag`, false},
+  `active`: {``, `u.active`, true},
+  `hasLogo`: {``, hasLogoExpr, true},
+}
+
+// MaxFacetBuckets caps the number of buckets returned per facet; the most
+// populous buckets are kept.
+const MaxFacetBuckets int64 = 100
+
+// checkFacets verifies that each of the requested facets is known.
+func checkFacets(facets []string) rest.RestError {
+  for _, facet := range facets {
+    if _, ok := orgFacets[facet]; !ok {
+      return rest.BadRequestError(fmt.Sprintf(`Unknown facet '%s'.`, facet), nil)
+    }
+  }
+
+  return nil
+}
+
+// countFacets counts the Orgs selected by the list where-bit under each value
+// of the requested facets, most populous first.
+func countFacets(facets []string, whereBit string, whereParams []interface{}, ctx context.Context) (map[string][]*FacetBucket, rest.RestError) {
+  counts := make(map[string][]*FacetBucket, len(facets))
+  for _, name := range facets {
+    facet := orgFacets[name]
+    query := `SELECT ` + facet.value + `, COUNT(DISTINCT o.id) ` + CommonOrgsFrom + facet.join + whereBit + `AND ` + facet.value + ` IS NOT NULL GROUP BY 1 ORDER BY 2 DESC, 1 ASC LIMIT ?`
+    rows, err := sqldb.DB.QueryContext(ctx, query, append(whereParams, MaxFacetBuckets)...)
+    if err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Could not count '%s' facet.`, name), err)
+    }
+    buckets, err := scanFacetBuckets(rows, facet.boolean)
+    if err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Problem reading '%s' facet.`, name), err)
+    }
+    counts[name] = buckets
+  }
+
+  return counts, nil
+}
+
+func scanFacetBuckets(rows *sql.Rows, boolean bool) ([]*FacetBucket, error) {
+  defer rows.Close()
+  buckets := make([]*FacetBucket, 0)
+  for rows.Next() {
+    var bucket FacetBucket
+    if err := rows.Scan(&bucket.Value, &bucket.Count); err != nil {
+      return nil, err
+    }
+    if boolean {
+      bucket.Value = strconv.FormatBool(bucket.Value == `1`)
+    }
+    buckets = append(buckets, &bucket)
+  }
+
+  return buckets, rows.Err()
+}
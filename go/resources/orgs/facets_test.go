@@ -0,0 +1,88 @@
+package orgs_test
+
+import (
+  "context"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func facetOrg(t *testing.T, name string, city string, logo bool, tags ...string) *Org {
+  org := someOrg.Clone()
+  org.Tags = tags
+  org.SetDisplayName(name)
+  org.LogoURL = nulls.NewNullString()
+  if logo {
+    org.SetLogoURL(`http://test.com/logo.png`)
+  }
+  org.Addresses = locations.Addresses{
+    &locations.Address{
+      locations.Location{
+        nulls.NewNullInt64(),
+        nulls.NewString(`1 Main St`),
+        nulls.NewNullString(),
+        nulls.NewString(city),
+        nulls.NewString(`OH`),
+        nulls.NewNullString(),
+        nulls.NewNullFloat64(),
+        nulls.NewNullFloat64(),
+        nil,
+      },
+      nulls.NewInt64(0),
+      nulls.NewString(`main`),
+    },
+  }
+  org, restErr := CreateOrg(org, context.Background())
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  return org
+}
+
+func bucketCounts(buckets []*FacetBucket) map[string]int64 {
+  counts := make(map[string]int64, len(buckets))
+  for _, bucket := range buckets {
+    counts[bucket.Value] = bucket.Count
+  }
+  return counts
+}
+
+func testOrgFacets(t *testing.T) {
+  ctx := context.Background()
+  facetOrg(t, `Faceted Org Dayton`, `Dayton`, true, `arts`)
+  facetOrg(t, `Faceted Org Columbus`, `Columbus`, false, `arts`, `music`)
+  facetOrg(t, `Faceted Org Columbus Too`, `Columbus`, false)
+
+  params := &ListParams{Search: `Faceted Org`, Facets: []string{`state`, `city`, `tag`, `active`, `hasLogo`}}
+  page, restErr := ListOrgs(params, ctx)
+  require.NoError(t, restErr, `Unexpected error listing facets.`)
+  assert.Equal(t, int64(3), page.TotalCount, `Unexpected number of orgs.`)
+  assert.Equal(t, map[string]int64{`OH`: 3}, bucketCounts(page.Facets[`state`]), `Unexpected state facet.`)
+  assert.Equal(t, map[string]int64{`Columbus`: 2, `Dayton`: 1}, bucketCounts(page.Facets[`city`]), `Unexpected city facet.`)
+  require.NotEmpty(t, page.Facets[`city`], `Missing city buckets.`)
+  assert.Equal(t, `Columbus`, page.Facets[`city`][0].Value, `Expected most populous bucket first.`)
+  assert.Equal(t, map[string]int64{`arts`: 2, `music`: 1}, bucketCounts(page.Facets[`tag`]), `Unexpected tag facet.`)
+  assert.Equal(t, map[string]int64{`true`: 1, `false`: 2}, bucketCounts(page.Facets[`hasLogo`]), `Unexpected logo facet.`)
+
+  params.Filters = ListFilters{Cities: []string{`Columbus`}, HasLogo: nulls.NewBool(false)}
+  page, restErr = ListOrgs(params, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered facets.`)
+  assert.Equal(t, int64(2), page.TotalCount, `Unexpected number of filtered orgs.`)
+  assert.Equal(t, map[string]int64{`Columbus`: 2}, bucketCounts(page.Facets[`city`]), `Facets not counted over filtered orgs.`)
+
+  params.Filters = ListFilters{Tags: []string{`Music`}}
+  page, restErr = ListOrgs(params, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered facets.`)
+  assert.Equal(t, int64(1), page.TotalCount, `Unexpected number of tagged orgs.`)
+  assert.Equal(t, map[string]int64{`arts`: 1, `music`: 1}, bucketCounts(page.Facets[`tag`]), `Tag facet not counted over filtered orgs.`)
+
+  params.Filters = ListFilters{States: []string{`OH`}, Cities: []string{`Cleveland`}}
+  page, restErr = ListOrgs(params, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered facets.`)
+  assert.Equal(t, int64(0), page.TotalCount, `Unexpected orgs for unmatched city.`)
+
+  _, restErr = ListOrgs(&ListParams{Facets: []string{`color`}}, ctx)
+  assert.Error(t, restErr, `Unexpected non-error for unknown facet.`)
+}
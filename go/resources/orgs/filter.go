@@ -0,0 +1,396 @@
+package orgs
+
+import (
+  "fmt"
+  "strings"
+  "unicode"
+)
+
+// A filter expression combines comparisons of Org fields with 'and', 'or',
+// 'not', and parentheses; for example:
+//
+//   active eq true and address.state eq 'CA' and email endswith '@example.com'
+//
+// The comparison operators are 'eq', 'ne', 'gt', 'ge', 'lt', and 'le', the
+// string operators 'contains', 'startswith', and 'endswith', and 'in', which
+// takes a parenthesized, comma separated list. Strings are single quoted,
+// with '' standing for a quote. Time fields take either Unix seconds or a
+// quoted RFC 3339 timestamp. Comparing with 'null' using 'eq' or 'ne' tests
+// for the absence or presence of a value. Keywords are case insensitive;
+// field names are not.
+
+// MaxFilterLength caps the length of a filter expression.
+const MaxFilterLength = 2048
+
+type filterFieldType string
+
+const (
+  filterString filterFieldType = `string`
+  filterBool   filterFieldType = `boolean`
+  filterTime   filterFieldType = `time`
+)
+
+// filterField maps a filterable field to its column. Address fields match
+// when any of the Org's addresses satisfies the comparison.
+type filterField struct {
+  column  string
+  kind    filterFieldType
+  address bool
+}
+
+// filterFields is the whitelist of fields which may be used in a filter.
+var filterFields = map[string]filterField{
+  `pubId`: {`e.pub_id`, filterString, false},
+  `displayName`: {`o.display_name`, filterString, false},
+  `summary`: {`o.summary`, filterString, false},
+  `email`: {`o.email`, filterString, false},
+  `phone`: {`o.phone`, filterString, false},
+  `homepage`: {`o.homepage`, filterString, false},
+  `logoURL`: {`o.logo_url`, filterString, false},
+  `parentPubId`: {`pe.pub_id`, filterString, false},
+  `active`: {`u.active`, filterBool, false},
+  `archivedAt`: {`o.archived_at`, filterTime, false},
+  // updatedAt is the entity's last update, which is held in Unix seconds.
+  `updatedAt`: {`FROM_UNIXTIME(e.last_updated)`, filterTime, false},
+  `address.label`: {`xa.label`, filterString, true},
+  `address.city`: {`xl.city`, filterString, true},
+  `address.state`: {`xl.state`, filterString, true},
+  `address.zip`: {`xl.zip`, filterString, true},
+}
+
+var filterComparisons = map[string]string{
+  `eq`: `=`,
+  `ne`: `<>`,
+  `gt`: `>`,
+  `ge`: `>=`,
+  `lt`: `<`,
+  `le`: `<=`,
+}
+
+// filterLikes gives the LIKE pattern for each string operator, with '%s'
+// standing for the escaped value.
+var filterLikes = map[string]string{
+  `contains`: `%%%s%%`,
+  `startswith`: `%s%%`,
+  `endswith`: `%%%s`,
+}
+
+// FilterError reports a problem with a filter expression and the position
+// (counting from 1) at which it was found.
+type FilterError struct {
+  Pos int
+  Msg string
+}
+
+func (e *FilterError) Error() string {
+  return fmt.Sprintf(`%s at position %d`, e.Msg, e.Pos)
+}
+
+type filterTokenKind int
+
+const (
+  tokenEOF filterTokenKind = iota
+  tokenWord
+  tokenString
+  tokenNumber
+  tokenLParen
+  tokenRParen
+  tokenComma
+)
+
+type filterToken struct {
+  kind filterTokenKind
+  text string
+  pos  int
+}
+
+func (t *filterToken) String() string {
+  switch t.kind {
+  case tokenEOF:
+    return `end of filter`
+  case tokenString:
+    return fmt.Sprintf(`'%s'`, strings.Replace(t.text, `'`, `''`, -1))
+  default:
+    return fmt.Sprintf(`'%s'`, t.text)
+  }
+}
+
+// is tests for a (case insensitive) keyword.
+func (t *filterToken) is(keyword string) bool {
+  return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func isFilterWordRune(r rune) bool {
+  return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+func tokenizeFilter(filter string) ([]*filterToken, error) {
+  runes := []rune(filter)
+  tokens := make([]*filterToken, 0)
+  for i := 0; i < len(runes); {
+    r, pos := runes[i], i + 1
+    switch {
+    case unicode.IsSpace(r):
+      i += 1
+    case r == '(':
+      tokens, i = append(tokens, &filterToken{tokenLParen, `(`, pos}), i + 1
+    case r == ')':
+      tokens, i = append(tokens, &filterToken{tokenRParen, `)`, pos}), i + 1
+    case r == ',':
+      tokens, i = append(tokens, &filterToken{tokenComma, `,`, pos}), i + 1
+    case r == '\'':
+      var text strings.Builder
+      for i += 1; ; i += 1 {
+        if i >= len(runes) {
+          return nil, &FilterError{pos, `unterminated string`}
+        }
+        if runes[i] == '\'' {
+          if i + 1 < len(runes) && runes[i + 1] == '\'' {
+            i += 1
+          } else {
+            break
+          }
+        }
+        text.WriteRune(runes[i])
+      }
+      tokens, i = append(tokens, &filterToken{tokenString, text.String(), pos}), i + 1
+    case r == '-' || unicode.IsDigit(r):
+      end := i + 1
+      for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+        end += 1
+      }
+      tokens, i = append(tokens, &filterToken{tokenNumber, string(runes[i:end]), pos}), end
+    case isFilterWordRune(r):
+      end := i + 1
+      for end < len(runes) && isFilterWordRune(runes[end]) {
+        end += 1
+      }
+      tokens, i = append(tokens, &filterToken{tokenWord, string(runes[i:end]), pos}), end
+    default:
+      return nil, &FilterError{pos, fmt.Sprintf(`unexpected character '%c'`, r)}
+    }
+  }
+
+  return append(tokens, &filterToken{tokenEOF, ``, len(runes) + 1}), nil
+}
+
+// filterParser is a recursive descent parser rendering a filter expression
+// as SQL as it goes.
+type filterParser struct {
+  tokens []*filterToken
+  next   int
+  params []interface{}
+}
+
+func (p *filterParser) peek() *filterToken {
+  return p.tokens[p.next]
+}
+
+func (p *filterParser) take() *filterToken {
+  t := p.tokens[p.next]
+  if t.kind != tokenEOF {
+    p.next += 1
+  }
+  return t
+}
+
+func (p *filterParser) expect(kind filterTokenKind, what string) error {
+  if t := p.take(); t.kind != kind {
+    return &FilterError{t.pos, fmt.Sprintf(`expected %s but found %s`, what, t)}
+  }
+  return nil
+}
+
+// parseOr handles: and-expr ('or' and-expr)*
+func (p *filterParser) parseOr() (string, error) {
+  return p.parseJoined(`or`, p.parseAnd)
+}
+
+// parseAnd handles: unary ('and' unary)*
+func (p *filterParser) parseAnd() (string, error) {
+  return p.parseJoined(`and`, p.parseUnary)
+}
+
+func (p *filterParser) parseJoined(keyword string, parseTerm func() (string, error)) (string, error) {
+  terms := make([]string, 0, 1)
+  for {
+    term, err := parseTerm()
+    if err != nil {
+      return ``, err
+    }
+    terms = append(terms, term)
+    if !p.peek().is(keyword) {
+      break
+    }
+    p.take()
+  }
+  if len(terms) == 1 {
+    return terms[0], nil
+  }
+
+  return `(` + strings.Join(terms, ` ` + strings.ToUpper(keyword) + ` `) + `)`, nil
+}
+
+// parseUnary handles: 'not' unary | '(' or-expr ')' | comparison
+func (p *filterParser) parseUnary() (string, error) {
+  if p.peek().is(`not`) {
+    p.take()
+    sql, err := p.parseUnary()
+    if err != nil {
+      return ``, err
+    }
+    return `NOT (` + sql + `)`, nil
+  }
+  if p.peek().kind == tokenLParen {
+    p.take()
+    sql, err := p.parseOr()
+    if err != nil {
+      return ``, err
+    }
+    if err := p.expect(tokenRParen, `')'`); err != nil {
+      return ``, err
+    }
+    return sql, nil
+  }
+
+  return p.parseComparison()
+}
+
+// parseComparison handles: field op value | field 'in' '(' value (',' value)* ')'
+func (p *filterParser) parseComparison() (string, error) {
+  fieldToken := p.take()
+  if fieldToken.kind != tokenWord {
+    return ``, &FilterError{fieldToken.pos, fmt.Sprintf(`expected a field but found %s`, fieldToken)}
+  }
+  field, ok := filterFields[fieldToken.text]
+  if !ok {
+    return ``, &FilterError{fieldToken.pos, fmt.Sprintf(`unknown field '%s'`, fieldToken.text)}
+  }
+
+  opToken := p.take()
+  op := strings.ToLower(opToken.text)
+  var cond string
+  if opToken.kind != tokenWord {
+    return ``, &FilterError{opToken.pos, fmt.Sprintf(`expected an operator but found %s`, opToken)}
+  } else if sqlOp, ok := filterComparisons[op]; ok {
+    valueToken := p.peek()
+    if valueToken.is(`null`) {
+      p.take()
+      if op != `eq` && op != `ne` {
+        return ``, &FilterError{valueToken.pos, fmt.Sprintf(`'%s' cannot be used with null`, op)}
+      }
+      cond = field.column + ` IS NULL`
+      if op == `ne` {
+        cond = field.column + ` IS NOT NULL`
+      }
+    } else {
+      if field.kind == filterBool && op != `eq` && op != `ne` {
+        return ``, &FilterError{opToken.pos, fmt.Sprintf(`'%s' cannot be used with boolean field '%s'`, op, fieldToken.text)}
+      }
+      placeholder, err := p.parseValue(fieldToken.text, field)
+      if err != nil {
+        return ``, err
+      }
+      cond = field.column + ` ` + sqlOp + ` ` + placeholder
+    }
+  } else if pattern, ok := filterLikes[op]; ok {
+    if field.kind != filterString {
+      return ``, &FilterError{opToken.pos, fmt.Sprintf(`'%s' cannot be used with %s field '%s'`, op, field.kind, fieldToken.text)}
+    }
+    valueToken := p.take()
+    if valueToken.kind != tokenString {
+      return ``, &FilterError{valueToken.pos, fmt.Sprintf(`expected a string but found %s`, valueToken)}
+    }
+    p.params = append(p.params, fmt.Sprintf(pattern, escapeLike(valueToken.text)))
+    cond = field.column + ` LIKE ?`
+  } else if op == `in` {
+    if err := p.expect(tokenLParen, `'('`); err != nil {
+      return ``, err
+    }
+    placeholders := make([]string, 0)
+    for {
+      placeholder, err := p.parseValue(fieldToken.text, field)
+      if err != nil {
+        return ``, err
+      }
+      placeholders = append(placeholders, placeholder)
+      if p.peek().kind != tokenComma {
+        break
+      }
+      p.take()
+    }
+    if err := p.expect(tokenRParen, `',' or ')'`); err != nil {
+      return ``, err
+    }
+    cond = field.column + ` IN (` + strings.Join(placeholders, `, `) + `)`
+  } else {
+    return ``, &FilterError{opToken.pos, fmt.Sprintf(`unknown operator '%s'`, opToken.text)}
+  }
+
+  if field.address {
+    return `EXISTS (SELECT 1 FROM entity_addresses xa JOIN locations xl ON xa.location_id=xl.id WHERE xa.entity_id=o.id AND xa.idx >= 0 AND ` + cond + `)`, nil
+  }
+  return cond, nil
+}
+
+// parseValue reads a literal of the field's type, adding it to the params and
+// returning the placeholder.
+func (p *filterParser) parseValue(name string, field filterField) (string, error) {
+  t := p.take()
+  switch field.kind {
+  case filterString:
+    if t.kind == tokenString {
+      p.params = append(p.params, t.text)
+      return `?`, nil
+    }
+  case filterBool:
+    if t.is(`true`) || t.is(`false`) {
+      p.params = append(p.params, t.is(`true`))
+      return `?`, nil
+    }
+  case filterTime:
+    if t.kind == tokenString || t.kind == tokenNumber {
+      at, err := ParseAsOf(t.text)
+      if err != nil {
+        return ``, &FilterError{t.pos, err.Error()}
+      }
+      p.params = append(p.params, at.Unix())
+      return `FROM_UNIXTIME(?)`, nil
+    }
+  }
+
+  return ``, &FilterError{t.pos, fmt.Sprintf(`expected a %s for '%s' but found %s`, field.kind, name, t)}
+}
+
+// escapeLike escapes the LIKE wildcards in a value to be matched literally.
+func escapeLike(value string) string {
+  return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// OrgsFilterWhereGenerator parses a filter expression, appending the
+// equivalent 'AND' clause to be applied to the CommonOrgsFrom joins, and its
+// params, to those given. Only the filterFields may be referenced and every
+// value is passed as a param. Problems with the expression are reported as a
+// FilterError.
+func OrgsFilterWhereGenerator(filter string, params []interface{}) (string, []interface{}, error) {
+  if len(filter) > MaxFilterLength {
+    return ``, nil, &FilterError{MaxFilterLength + 1, fmt.Sprintf(`filter exceeds %d characters`, MaxFilterLength)}
+  }
+  tokens, err := tokenizeFilter(filter)
+  if err != nil {
+    return ``, nil, err
+  }
+  parser := &filterParser{tokens: tokens, params: params}
+  if parser.peek().kind == tokenEOF {
+    return ``, nil, &FilterError{1, `empty filter`}
+  }
+  sql, err := parser.parseOr()
+  if err != nil {
+    return ``, nil, err
+  }
+  if t := parser.peek(); t.kind != tokenEOF {
+    return ``, nil, &FilterError{t.pos, fmt.Sprintf(`expected 'and', 'or', or end of filter but found %s`, t)}
+  }
+
+  return `AND ` + sql + ` `, parser.params, nil
+}
@@ -0,0 +1,76 @@
+package orgs_test
+
+import (
+  "context"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestOrgsFilterWhereGenerator(t *testing.T) {
+  whereBit, params, err := OrgsFilterWhereGenerator(`active eq true and address.state eq 'CA'`, []interface{}{`prior`})
+  require.NoError(t, err, `Unexpected error parsing filter.`)
+  assert.Equal(t, `AND (u.active = ? AND EXISTS (SELECT 1 FROM entity_addresses xa JOIN locations xl ON xa.location_id=xl.id WHERE xa.entity_id=o.id AND xa.idx >= 0 AND xl.state = ?)) `, whereBit, `Unexpected where bit.`)
+  assert.Equal(t, []interface{}{`prior`, true, `CA`}, params, `Unexpected params.`)
+
+  whereBit, params, err = OrgsFilterWhereGenerator(`NOT (email endswith '@example.com' OR displayName contains '50%') and summary ne null`, nil)
+  require.NoError(t, err, `Unexpected error parsing filter.`)
+  assert.Equal(t, `AND (NOT ((o.email LIKE ? OR o.display_name LIKE ?)) AND o.summary IS NOT NULL) `, whereBit, `Unexpected where bit.`)
+  assert.Equal(t, []interface{}{`%@example.com`, `%50\%%`}, params, `Unexpected params.`)
+
+  whereBit, params, err = OrgsFilterWhereGenerator(`updatedAt ge '2019-01-01T00:00:00Z' and displayName in ('O''Brien', 'Acme')`, nil)
+  require.NoError(t, err, `Unexpected error parsing filter.`)
+  assert.Equal(t, `AND (FROM_UNIXTIME(e.last_updated) >= FROM_UNIXTIME(?) AND o.display_name IN (?, ?)) `, whereBit, `Unexpected where bit.`)
+  assert.Equal(t, []interface{}{int64(1546300800), `O'Brien`, `Acme`}, params, `Unexpected params.`)
+
+  errors := map[string]string{
+    ``: `empty filter at position 1`,
+    `legalId eq '123'`: `unknown field 'legalId' at position 1`,
+    `active eq 'yes'`: `expected a boolean for 'active' but found 'yes' at position 11`,
+    `active gt true`: `'gt' cannot be used with boolean field 'active' at position 8`,
+    `email like 'a'`: `unknown operator 'like' at position 7`,
+    `email eq 'a' active eq true`: `expected 'and', 'or', or end of filter but found 'active' at position 14`,
+    `(email eq 'a'`: `expected ')' but found end of filter at position 14`,
+    `email eq 'a`: `unterminated string at position 10`,
+    `email eq "a"`: `unexpected character '"' at position 10`,
+    `archivedAt lt 'soon'`: `'soon' is neither Unix seconds nor an RFC 3339 timestamp at position 15`,
+  }
+  for filter, expected := range errors {
+    _, _, err := OrgsFilterWhereGenerator(filter, nil)
+    if assert.Errorf(t, err, `Unexpected non-error for '%s'.`, filter) {
+      assert.Equal(t, expected, err.Error(), `Unexpected error for '%s'.`, filter)
+    }
+  }
+}
+
+func testOrgFilter(t *testing.T) {
+  ctx := context.Background()
+  filtered := someOrg.Clone()
+  filtered.SetDisplayName(`Filtered Org`)
+  filtered.SetEmail(`info@filtered.example.com`)
+  filtered.LogoURL = nulls.NewNullString()
+  filtered, restErr := CreateOrg(filtered, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  page, restErr := ListOrgs(&ListParams{Filter: `email endswith '@filtered.example.com' and logoURL eq null`}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered orgs.`)
+  require.Len(t, page.Items, 1, `Unexpected number of filtered orgs.`)
+  assert.Equal(t, filtered.PubId.String, page.Items[0].PubId.String, `Unexpected filtered org.`)
+
+  page, restErr = ListOrgs(&ListParams{Filter: `email endswith '@filtered.example.com' and not displayName startswith 'Filtered'`}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered orgs.`)
+  assert.Len(t, page.Items, 0, `Unexpected orgs for negated filter.`)
+
+  page, restErr = ListOrgs(&ListParams{Filter: `pubId eq '` + filtered.PubId.String + `' and updatedAt ge 0`}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered orgs.`)
+  assert.Len(t, page.Items, 1, `Expected org updated since the epoch.`)
+  page, restErr = ListOrgs(&ListParams{Filter: `pubId eq '` + filtered.PubId.String + `' and updatedAt gt '2999-01-01T00:00:00Z'`}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing filtered orgs.`)
+  assert.Len(t, page.Items, 0, `Unexpected org updated in the future.`)
+
+  _, restErr = ListOrgs(&ListParams{Filter: `bogus eq 1`}, ctx)
+  assert.Error(t, restErr, `Unexpected non-error for invalid filter.`)
+}
@@ -0,0 +1,203 @@
+package orgs
+
+import (
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+// DefaultNearRadius is the search radius (in meters) used when a 'near'
+// search does not specify one.
+var DefaultNearRadius float64 = 10000
+
+// GeoPoint is a point given in decimal degrees.
+type GeoPoint struct {
+  Lat float64
+  Lng float64
+}
+
+// ParseGeoPoint parses a 'lat,lng' pair.
+func ParseGeoPoint(value string) (*GeoPoint, error) {
+  coords, err := parseCoords(value, 2)
+  if err != nil {
+    return nil, err
+  }
+  p := &GeoPoint{coords[0], coords[1]}
+  if err := checkLatLng(p.Lat, p.Lng); err != nil {
+    return nil, err
+  }
+
+  return p, nil
+}
+
+// BBox is a bounding box given by its south-west and north-east corners. A
+// box whose West edge lies east of its East edge crosses the antimeridian.
+type BBox struct {
+  South float64
+  West  float64
+  North float64
+  East  float64
+}
+
+// ParseBBox parses a 'south,west,north,east' box; that is, the 'lat,lng' of
+// the south-west corner followed by that of the north-east corner.
+func ParseBBox(value string) (*BBox, error) {
+  coords, err := parseCoords(value, 4)
+  if err != nil {
+    return nil, err
+  }
+  b := &BBox{coords[0], coords[1], coords[2], coords[3]}
+  if err := checkLatLng(b.South, b.West); err != nil {
+    return nil, err
+  }
+  if err := checkLatLng(b.North, b.East); err != nil {
+    return nil, err
+  }
+  if b.South > b.North {
+    return nil, fmt.Errorf(`south edge %g lies north of north edge %g`, b.South, b.North)
+  }
+
+  return b, nil
+}
+
+func parseCoords(value string, count int) ([]float64, error) {
+  parts := strings.Split(value, `,`)
+  if len(parts) != count {
+    return nil, fmt.Errorf(`expected %d comma separated coordinates, got %d`, count, len(parts))
+  }
+  coords := make([]float64, count)
+  for i, part := range parts {
+    var err error
+    if coords[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+      return nil, fmt.Errorf(`invalid coordinate '%s'`, part)
+    }
+  }
+
+  return coords, nil
+}
+
+func checkLatLng(lat float64, lng float64) error {
+  if lat < -90 || lat > 90 {
+    return fmt.Errorf(`latitude %g out of range`, lat)
+  }
+  if lng < -180 || lng > 180 {
+    return fmt.Errorf(`longitude %g out of range`, lng)
+  }
+
+  return nil
+}
+
+// distanceUnits maps the recognized distance suffixes to meters.
+var distanceUnits = []struct {
+  suffix string
+  meters float64
+}{
+  // 'km' must be checked before 'm'.
+  {`km`, 1000},
+  {`mi`, 1609.344},
+  {`m`, 1},
+}
+
+// ParseDistance parses a distance such as '10km', '500m', or '5mi', returning
+// the distance in meters. A bare number is taken to be in meters.
+func ParseDistance(value string) (float64, error) {
+  number, scale := strings.ToLower(strings.TrimSpace(value)), 1.0
+  for _, unit := range distanceUnits {
+    if strings.HasSuffix(number, unit.suffix) {
+      number, scale = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.meters
+      break
+    }
+  }
+  distance, err := strconv.ParseFloat(number, 64)
+  if err != nil {
+    return 0, fmt.Errorf(`invalid distance '%s'`, value)
+  }
+  if distance <= 0 {
+    return 0, fmt.Errorf(`distance '%s' must be positive`, value)
+  }
+
+  return distance * scale, nil
+}
+
+// earthRadius is the mean radius of the Earth (in meters) assumed by
+// 'ST_Distance_Sphere'.
+const earthRadius = 6370986
+
+// nearBox returns a box bounding the circle of the radius (in meters) about
+// the point, padded slightly against rounding. Where the circle takes in a
+// pole, the box spans every longitude.
+func nearBox(p *GeoPoint, radius float64) *BBox {
+  angle := radius / earthRadius * 1.001
+  dLat := angle * 180 / math.Pi
+  south, north := p.Lat - dLat, p.Lat + dLat
+  if south <= -90 || north >= 90 {
+    return &BBox{math.Max(south, -90), -180, math.Min(north, 90), 180}
+  }
+  dLng := math.Asin(math.Sin(angle) / math.Cos(p.Lat * math.Pi / 180)) * 180 / math.Pi
+  west, east := p.Lng - dLng, p.Lng + dLng
+  if west < -180 {
+    west += 360
+  }
+  if east > 180 {
+    east -= 360
+  }
+
+  return &BBox{south, west, north, east}
+}
+
+// boxBit generates the conditions limiting the locations to those within the
+// box.
+func boxBit(b *BBox) (string, []interface{}) {
+  bit := `AND loc.lat BETWEEN ? AND ? `
+  if b.West <= b.East {
+    bit += `AND loc.lng BETWEEN ? AND ? `
+  } else {
+    bit += `AND (loc.lng >= ? OR loc.lng <= ?) `
+  }
+
+  return bit, []interface{}{b.South, b.North, b.West, b.East}
+}
+
+// geoJoinBit generates a join limiting the Orgs to those with an address
+// within the list parameters' bounding box and/or radius of the 'near' point.
+// The join, aliased 'geo', provides the distance of each Org's nearest
+// matching address, or null when there is no 'near' point. Addresses which
+// have not been geocoded never match. The radius is first applied as a box
+// (see nearBox), so that distances are only computed for nearby addresses.
+func geoJoinBit(params *ListParams) (string, []interface{}) {
+  if params.Near == nil && params.BBox == nil {
+    return ``, nil
+  }
+
+  radius := params.Radius
+  if radius <= 0 {
+    radius = DefaultNearRadius
+  }
+  joinParams := make([]interface{}, 0)
+  distance := `NULL`
+  if params.Near != nil {
+    distance = `MIN(ST_Distance_Sphere(POINT(loc.lng, loc.lat), POINT(?, ?)))`
+    joinParams = append(joinParams, params.Near.Lng, params.Near.Lat)
+  }
+  joinBit := `JOIN (SELECT ea.entity_id, ` + distance + ` AS distance FROM entity_addresses ea JOIN locations loc ON ea.location_id=loc.id WHERE ea.idx >= 0 AND loc.lat IS NOT NULL AND loc.lng IS NOT NULL `
+  boxes := []*BBox{params.BBox}
+  if params.Near != nil {
+    boxes = append(boxes, nearBox(params.Near, radius))
+  }
+  for _, b := range boxes {
+    if b != nil {
+      bit, bitParams := boxBit(b)
+      joinBit += bit
+      joinParams = append(joinParams, bitParams...)
+    }
+  }
+  joinBit += `GROUP BY ea.entity_id `
+  if params.Near != nil {
+    joinBit += `HAVING distance <= ? `
+    joinParams = append(joinParams, radius)
+  }
+  joinBit += `) geo ON o.id=geo.entity_id `
+
+  return joinBit, joinParams
+}
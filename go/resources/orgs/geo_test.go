@@ -0,0 +1,118 @@
+package orgs_test
+
+import (
+  "context"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestParseGeoPoint(t *testing.T) {
+  p, err := ParseGeoPoint(`39.7589, -84.1916`)
+  require.NoError(t, err, `Unexpected error parsing point.`)
+  assert.Equal(t, &GeoPoint{39.7589, -84.1916}, p, `Unexpected point.`)
+  _, err = ParseGeoPoint(`39.7589`)
+  assert.Error(t, err, `Unexpected non-error for missing longitude.`)
+  _, err = ParseGeoPoint(`91,0`)
+  assert.Error(t, err, `Unexpected non-error for out of range latitude.`)
+  _, err = ParseGeoPoint(`north,west`)
+  assert.Error(t, err, `Unexpected non-error for non-numeric point.`)
+}
+
+func TestParseBBox(t *testing.T) {
+  b, err := ParseBBox(`39,-85,40,-84`)
+  require.NoError(t, err, `Unexpected error parsing box.`)
+  assert.Equal(t, &BBox{39, -85, 40, -84}, b, `Unexpected box.`)
+  b, err = ParseBBox(`-20,170,-10,-170`)
+  require.NoError(t, err, `Unexpected error parsing box crossing the antimeridian.`)
+  assert.Equal(t, &BBox{-20, 170, -10, -170}, b, `Unexpected antimeridian box.`)
+  _, err = ParseBBox(`40,-85,39,-84`)
+  assert.Error(t, err, `Unexpected non-error for inverted box.`)
+  _, err = ParseBBox(`39,-85,40`)
+  assert.Error(t, err, `Unexpected non-error for missing coordinate.`)
+}
+
+func TestParseDistance(t *testing.T) {
+  distances := map[string]float64{
+    `10km`: 10000,
+    `500m`: 500,
+    `2 mi`: 3218.688,
+    `250`: 250,
+    `1.5KM`: 1500,
+  }
+  for value, expected := range distances {
+    distance, err := ParseDistance(value)
+    if assert.NoErrorf(t, err, `Unexpected error parsing '%s'.`, value) {
+      assert.InDeltaf(t, expected, distance, 0.001, `Unexpected distance for '%s'.`, value)
+    }
+  }
+  for _, value := range []string{``, `km`, `ten km`, `-5km`, `0m`, `5 furlongs`} {
+    _, err := ParseDistance(value)
+    assert.Errorf(t, err, `Unexpected non-error for '%s'.`, value)
+  }
+}
+
+func testOrgNear(t *testing.T) {
+  ctx := context.Background()
+  located := someOrg.Clone()
+  located.SetDisplayName(`Located Org`)
+  located.Addresses = locations.Addresses{
+    &locations.Address{
+      locations.Location{
+        nulls.NewNullInt64(),
+        nulls.NewString(`1600 Amphitheatre Pkwy`),
+        nulls.NewNullString(),
+        nulls.NewString(`Mountain View`),
+        nulls.NewString(`CA`),
+        nulls.NewString(`94043`),
+        nulls.NewFloat64(37.4220),
+        nulls.NewFloat64(-122.0841),
+        nil,
+      },
+      nulls.NewInt64(0),
+      nulls.NewString(`HQ`),
+    },
+  }
+  located, restErr := CreateOrg(located, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  findIn := func(page *OrgsPage) *OrgListItem {
+    for _, org := range page.Items {
+      if org.PubId.String == located.PubId.String {
+        return org
+      }
+    }
+    return nil
+  }
+
+  page, restErr := ListOrgs(&ListParams{Near: &GeoPoint{37.4275, -122.1697}, Radius: 25000}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing orgs near point.`)
+  found := findIn(page)
+  require.NotNil(t, found, `Located org not found near point.`)
+  require.True(t, found.Distance.Valid, `Expected distance for near search.`)
+  assert.InDelta(t, 7500, found.Distance.Float64, 2000, `Unexpected distance.`)
+  for i := 1; i < len(page.Items); i++ {
+    assert.True(t, page.Items[i - 1].Distance.Float64 <= page.Items[i].Distance.Float64, `Orgs not ordered by distance.`)
+  }
+
+  page, restErr = ListOrgs(&ListParams{Near: &GeoPoint{37.4275, -122.1697}, Radius: 1000}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing orgs near point.`)
+  assert.Nil(t, findIn(page), `Unexpected org outside radius.`)
+
+  page, restErr = ListOrgs(&ListParams{BBox: &BBox{37, -123, 38, -122}}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing orgs in box.`)
+  found = findIn(page)
+  require.NotNil(t, found, `Located org not found in box.`)
+  assert.False(t, found.Distance.Valid, `Unexpected distance for box search.`)
+
+  page, restErr = ListOrgs(&ListParams{BBox: &BBox{39, -85, 40, -84}}, ctx)
+  require.NoError(t, restErr, `Unexpected error listing orgs in box.`)
+  assert.Nil(t, findIn(page), `Unexpected org outside box.`)
+
+  _, restErr = ListOrgs(&ListParams{Near: &GeoPoint{37.4275, -122.1697}, CursorMode: true}, ctx)
+  assert.Error(t, restErr, `Unexpected non-error for near search in cursor mode.`)
+}
@@ -0,0 +1,286 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "log"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// MaxOrgDepth limits how deep an Org hierarchy may grow. It also bounds the
+// hierarchy walks should the data somehow contain a cycle.
+const MaxOrgDepth = 32
+
+// resolveParentIdInTxn looks up the internal ID of the Org's parent. The
+// parent is only checked where it changes from that of the oldOrg, which is
+// nil for a new Org, so the children of an archived Org may still be updated.
+// A new parent must exist and be live, or the result is a
+// rest.UnprocessableEntityError, and must not create a cycle or exceed
+// MaxOrgDepth (see checkHierarchyInTxn). As the Org will appear among the
+// parent's children, a Principal carried by the context (see WithPrincipal)
+// must also be authorized to update the new parent.
+func resolveParentIdInTxn(o *Org, oldOrg *Org, ctx context.Context, txn *sql.Tx) (nulls.Int64, rest.RestError) {
+  if !o.ParentPubId.Valid || o.ParentPubId.String == `` {
+    return nulls.NewNullInt64(), nil
+  }
+  if oldOrg != nil && strings.EqualFold(o.ParentPubId.String, oldOrg.ParentPubId.String) {
+    var parentId sql.NullInt64
+    if err := txn.Stmt(getParentIdQuery).QueryRowContext(ctx, oldOrg.Id.Int64).Scan(&parentId); err != nil {
+      return nulls.NewNullInt64(), rest.ServerError(`Could not resolve parent org.`, err)
+    }
+    return nulls.NewInt64(parentId.Int64), nil
+  }
+
+  var parentId int64
+  if err := txn.Stmt(getOrgIdQuery).QueryRowContext(ctx, o.ParentPubId.String).Scan(&parentId); err == sql.ErrNoRows {
+    return nulls.NewNullInt64(), rest.UnprocessableEntityError(fmt.Sprintf(`Parent org '%s' not found.`, o.ParentPubId.String), nil)
+  } else if err != nil {
+    return nulls.NewNullInt64(), rest.ServerError(`Could not resolve parent org.`, err)
+  }
+  if p := PrincipalFromContext(ctx); p != nil {
+    if restErr := Authorize(p, o.ParentPubId.String, ActionUpdate, ctx); restErr != nil {
+      return nulls.NewNullInt64(), restErr
+    }
+  }
+  var orgId int64 // zero for a new Org
+  if oldOrg != nil {
+    orgId = oldOrg.Id.Int64
+  }
+  if restErr := checkHierarchyInTxn(o.PubId.String, orgId, parentId, ctx, txn); restErr != nil {
+    return nulls.NewNullInt64(), restErr
+  }
+
+  return nulls.NewInt64(parentId), nil
+}
+
+// checkHierarchyInTxn verifies that making parentId the parent of the Org
+// would not create a cycle; i.e., that the Org is neither the proposed parent
+// nor one of its ancestors. The check also enforces MaxOrgDepth, taking into
+// account the descendants which move with the Org. An orgId of zero denotes
+// a new Org, which has neither.
+//
+// The Org and the ancestors walked are locked for the remainder of the
+// transaction, so concurrent moves through the same Orgs are serialized and
+// each sees the other's result rather than a stale snapshot.
+func checkHierarchyInTxn(pubId string, orgId int64, parentId int64, ctx context.Context, txn *sql.Tx) rest.RestError {
+  lockParentIdStmt := txn.Stmt(lockParentIdQuery)
+  if orgId != 0 {
+    var ignored sql.NullInt64
+    if err := lockParentIdStmt.QueryRowContext(ctx, orgId).Scan(&ignored); err != nil {
+      return rest.ServerError(`Could not check org hierarchy.`, err)
+    }
+  }
+  ancestors, err := ancestorIds(parentId, lockParentIdStmt, ctx)
+  if err != nil {
+    return rest.ServerError(`Could not check org hierarchy.`, err)
+  }
+  height := 0
+  if orgId != 0 {
+    for _, id := range append([]int64{parentId}, ancestors...) {
+      if id == orgId {
+        return rest.UnprocessableEntityError(fmt.Sprintf(`Org '%s' cannot be its own ancestor.`, pubId), nil)
+      }
+    }
+    if height, err = subtreeHeightInTxn(orgId, ctx, txn); err != nil {
+      return rest.ServerError(`Could not check org hierarchy.`, err)
+    }
+  }
+  // The parent's ancestors and the parent, the Org, and its descendants.
+  if len(ancestors) + 2 + height > MaxOrgDepth {
+    return rest.UnprocessableEntityError(fmt.Sprintf(`Org hierarchy may not exceed %d levels.`, MaxOrgDepth), nil)
+  }
+
+  return nil
+}
+
+// subtreeHeightInTxn counts the levels of descendants, archived or not, below
+// the Org; zero for an Org without children.
+func subtreeHeightInTxn(orgId int64, ctx context.Context, txn *sql.Tx) (int, error) {
+  height := 0
+  level := []interface{}{orgId}
+  for ; height <= MaxOrgDepth; height++ {
+    query := `SELECT id FROM orgs WHERE parent_id IN (` + placeholders(len(level)) + `)`
+    rows, err := txn.QueryContext(ctx, query, level...)
+    if err != nil {
+      return 0, err
+    }
+    children := make([]interface{}, 0)
+    for rows.Next() {
+      var id int64
+      if err := rows.Scan(&id); err != nil {
+        rows.Close()
+        return 0, err
+      }
+      children = append(children, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+      return 0, err
+    }
+    if len(children) == 0 {
+      break
+    }
+    level = children
+  }
+
+  return height, nil
+}
+
+// ancestorIds walks up from the given Org, returning the internal IDs of its
+// ancestors, nearest first.
+func ancestorIds(id int64, stmt *sql.Stmt, ctx context.Context) ([]int64, error) {
+  ancestors := make([]int64, 0)
+  for len(ancestors) < MaxOrgDepth {
+    var parentId sql.NullInt64
+    if err := stmt.QueryRowContext(ctx, id).Scan(&parentId); err == sql.ErrNoRows {
+      break
+    } else if err != nil {
+      return nil, err
+    }
+    if !parentId.Valid {
+      break
+    }
+    ancestors = append(ancestors, parentId.Int64)
+    id = parentId.Int64
+  }
+
+  return ancestors, nil
+}
+
+// ListChildren retrieves summaries of the Org's direct (live) children, ordered
+// by display name. Attempting to list the children of a non-existent Org
+// results in a rest.NotFoundError.
+func ListChildren(pubId string, ctx context.Context) ([]*OrgSummary, rest.RestError) {
+  orgId, restErr := getOrgId(pubId, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  children, _, restErr := getOrgSummariesById([]int64{orgId}, `o.parent_id`, false, ctx)
+  return children, restErr
+}
+
+// ListAncestors retrieves summaries of the Org's ancestors, starting with its
+// parent and ending with the root of the hierarchy. Archived ancestors are
+// included so that the chain is unbroken. Attempting to list the ancestors of
+// a non-existent Org results in a rest.NotFoundError.
+func ListAncestors(pubId string, ctx context.Context) ([]*OrgSummary, rest.RestError) {
+  orgId, restErr := getOrgId(pubId, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  ids, err := ancestorIds(orgId, getParentIdQuery, ctx)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve org ancestors.`, err)
+  }
+  if len(ids) == 0 {
+    return make([]*OrgSummary, 0), nil
+  }
+  orgs, orgIds, restErr := getOrgSummariesById(ids, `o.id`, true, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  // Restore the ancestor order.
+  byId := make(map[int64]*OrgSummary, len(orgs))
+  for i, org := range orgs {
+    byId[orgIds[i]] = org
+  }
+  ancestors := make([]*OrgSummary, 0, len(ids))
+  for _, id := range ids {
+    if org, ok := byId[id]; ok {
+      ancestors = append(ancestors, org)
+    }
+  }
+
+  return ancestors, nil
+}
+
+// ListSubtree retrieves summaries of all the (live) descendants of the Org,
+// breadth first; each level is ordered by display name. Attempting to list
+// the subtree of a non-existent Org results in a rest.NotFoundError.
+func ListSubtree(pubId string, ctx context.Context) ([]*OrgSummary, rest.RestError) {
+  orgId, restErr := getOrgId(pubId, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  subtree := make([]*OrgSummary, 0)
+  level := []int64{orgId}
+  for depth := 0; len(level) > 0 && depth < MaxOrgDepth; depth++ {
+    children, childIds, restErr := getOrgSummariesById(level, `o.parent_id`, false, ctx)
+    if restErr != nil {
+      return nil, restErr
+    }
+    subtree = append(subtree, children...)
+    level = childIds
+  }
+
+  return subtree, nil
+}
+
+func getOrgId(pubId string, ctx context.Context) (int64, rest.RestError) {
+  var orgId int64
+  if err := getOrgIdQuery.QueryRowContext(ctx, pubId).Scan(&orgId); err == sql.ErrNoRows {
+    return 0, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, pubId), nil)
+  } else if err != nil {
+    return 0, rest.ServerError(`Could not resolve org.`, err)
+  }
+
+  return orgId, nil
+}
+
+// getOrgSummariesById retrieves the summaries of Orgs where the indicated
+// column matches one of the given internal IDs. The internal IDs of the
+// retrieved Orgs are returned separately for use by the hierarchy walks.
+func getOrgSummariesById(ids []int64, column string, includeArchived bool, ctx context.Context) ([]*OrgSummary, []int64, rest.RestError) {
+  params := make([]interface{}, len(ids))
+  for i, id := range ids {
+    params[i] = id
+  }
+  query := `SELECT ` + CommonOrgSummaryFields + `, o.id ` + CommonOrgsFrom +
+    `WHERE ` + column + ` IN (` + placeholders(len(ids)) + `) `
+  if !includeArchived {
+    query += `AND o.archived_at IS NULL `
+  }
+  query += `ORDER BY o.display_name ASC, e.pub_id ASC`
+
+  rows, err := sqldb.DB.QueryContext(ctx, query, params...)
+  if err != nil {
+    return nil, nil, rest.ServerError(`Could not retrieve orgs.`, err)
+  }
+  defer rows.Close()
+
+  orgs := make([]*OrgSummary, 0)
+  orgIds := make([]int64, 0)
+  for rows.Next() {
+    var o OrgSummary
+    var id int64
+    if err := rows.Scan(&o.PubId, &o.LastUpdated, &o.DisplayName, &o.Summary, &o.Phone, &o.Email, &o.Homepage, &o.LogoURL, &o.ArchivedAt, &o.ParentPubId, &o.Version, &id); err != nil {
+      return nil, nil, rest.ServerError(`Problem reading orgs.`, err)
+    }
+    o.FormatOut()
+    orgs = append(orgs, &o)
+    orgIds = append(orgIds, id)
+  }
+
+  return orgs, orgIds, nil
+}
+
+const getParentIdStatement = `SELECT parent_id FROM orgs WHERE id=?`
+const lockParentIdStatement = getParentIdStatement + ` FOR UPDATE`
+var getParentIdQuery, lockParentIdQuery *sql.Stmt
+func setupHierarchyDB(db *sql.DB) {
+  var err error
+  if getParentIdQuery, err = db.Prepare(getParentIdStatement); err != nil {
+    log.Fatalf("mysql: prepare get parent ID stmt: %v", err)
+  }
+  if lockParentIdQuery, err = db.Prepare(lockParentIdStatement); err != nil {
+    log.Fatalf("mysql: prepare lock parent ID stmt: %v", err)
+  }
+}
@@ -0,0 +1,186 @@
+package orgs_test
+
+import (
+  "context"
+  "fmt"
+  "net/http"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func testOrgHierarchy(t *testing.T) {
+  ctx := context.Background()
+  root := someOrg.Clone()
+  root.SetDisplayName(`Root Org`)
+  root, restErr := CreateOrg(root, ctx)
+  require.NoError(t, restErr, `Unexpected error creating root org.`)
+
+  child := someOrg.Clone()
+  child.SetDisplayName(`Child Org`)
+  child.SetParentPubId(root.PubId.String)
+  child, restErr = CreateOrg(child, ctx)
+  require.NoError(t, restErr, `Unexpected error creating child org.`)
+  assert.Equal(t, root.PubId, child.ParentPubId, `Unexpected parent.`)
+
+  grandchild := someOrg.Clone()
+  grandchild.SetDisplayName(`Grandchild Org`)
+  grandchild.SetParentPubId(child.PubId.String)
+  grandchild, restErr = CreateOrg(grandchild, ctx)
+  require.NoError(t, restErr, `Unexpected error creating grandchild org.`)
+
+  children, restErr := ListChildren(root.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error listing children.`)
+  require.Len(t, children, 1, `Unexpected number of children.`)
+  assert.Equal(t, child.PubId, children[0].PubId, `Unexpected child.`)
+
+  ancestors, restErr := ListAncestors(grandchild.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error listing ancestors.`)
+  require.Len(t, ancestors, 2, `Unexpected number of ancestors.`)
+  assert.Equal(t, child.PubId, ancestors[0].PubId, `Unexpected parent.`)
+  assert.Equal(t, root.PubId, ancestors[1].PubId, `Unexpected grandparent.`)
+
+  subtree, restErr := ListSubtree(root.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error listing subtree.`)
+  require.Len(t, subtree, 2, `Unexpected subtree size.`)
+  assert.Equal(t, child.PubId, subtree[0].PubId, `Unexpected first descendant.`)
+  assert.Equal(t, grandchild.PubId, subtree[1].PubId, `Unexpected second descendant.`)
+
+  root.SetParentPubId(grandchild.PubId.String)
+  _, restErr = UpdateOrg(root, ctx)
+  assert.Error(t, restErr, `Unexpected non-error creating hierarchy cycle.`)
+  child.SetParentPubId(child.PubId.String)
+  _, restErr = UpdateOrg(child, ctx)
+  assert.Error(t, restErr, `Unexpected non-error making org its own parent.`)
+
+  orphan := someOrg.Clone()
+  orphan.SetParentPubId(`00000000-0000-4000-8000-000000000000`)
+  _, restErr = CreateOrg(orphan, ctx)
+  assert.Error(t, restErr, `Unexpected non-error creating org with non-existent parent.`)
+}
+
+func testOrgHierarchyMoves(t *testing.T) {
+  ctx := context.Background()
+  parent := someOrg.Clone()
+  parent.SetDisplayName(`Parent Org`)
+  parent, restErr := CreateOrg(parent, ctx)
+  require.NoError(t, restErr, `Unexpected error creating parent org.`)
+  child := someOrg.Clone()
+  child.SetDisplayName(`Child Org`)
+  child.SetParentPubId(parent.PubId.String)
+  child, restErr = CreateOrg(child, ctx)
+  require.NoError(t, restErr, `Unexpected error creating child org.`)
+
+  // An archived parent blocks new children, but not updates to existing ones.
+  _, restErr = ArchiveOrg(parent.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error archiving parent org.`)
+  child.SetDisplayName(`Orphaned Child Org`)
+  child, restErr = UpdateOrg(child, ctx)
+  require.NoError(t, restErr, `Unexpected error updating child of archived org.`)
+  assert.Equal(t, parent.PubId, child.ParentPubId, `Unexpected parent.`)
+  sibling := someOrg.Clone()
+  sibling.SetParentPubId(parent.PubId.String)
+  _, restErr = CreateOrg(sibling, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error creating child of archived org.`) {
+    assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  }
+
+  // A principal must be able to update the new parent, but not the old.
+  member := NewPrincipal(`opqrstu789`, nil)
+  memberCtx := WithPrincipal(ctx, member)
+  other := someOrg.Clone()
+  other.SetDisplayName(`Other Org`)
+  other, restErr = CreateOrg(other, ctx)
+  require.NoError(t, restErr, `Unexpected error creating other org.`)
+  child.SetParentPubId(other.PubId.String)
+  _, restErr = UpdateOrg(child, memberCtx)
+  if assert.Error(t, restErr, `Unexpected non-error moving org under unrelated parent.`) {
+    assert.Equal(t, http.StatusForbidden, restErr.Code(), `Unexpected error code.`)
+  }
+  _, restErr = AddMember(other.PubId.String, otherMemberID, RoleAdmin, ctx)
+  require.NoError(t, restErr, `Unexpected error adding admin.`)
+  child, restErr = UpdateOrg(child, memberCtx)
+  require.NoError(t, restErr, `Unexpected error moving org under administered parent.`)
+  assert.Equal(t, other.PubId, child.ParentPubId, `Unexpected parent.`)
+  require.NoError(t, RemoveMember(other.PubId.String, otherMemberID, ctx), `Unexpected error removing admin.`)
+
+  // The depth limit counts the descendants moving with an Org.
+  var deepest *Org
+  for i := 0; i < MaxOrgDepth - 1; i++ {
+    link := someOrg.Clone()
+    link.SetDisplayName(fmt.Sprintf(`Chain Org %d`, i))
+    if deepest != nil {
+      link.SetParentPubId(deepest.PubId.String)
+    }
+    deepest, restErr = CreateOrg(link, ctx)
+    require.NoError(t, restErr, `Unexpected error creating chain org.`)
+  }
+  moved := someOrg.Clone()
+  moved.SetDisplayName(`Moved Org`)
+  moved, restErr = CreateOrg(moved, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org to move.`)
+  below := someOrg.Clone()
+  below.SetParentPubId(moved.PubId.String)
+  _, restErr = CreateOrg(below, ctx)
+  require.NoError(t, restErr, `Unexpected error creating child of org to move.`)
+
+  moved.SetParentPubId(deepest.PubId.String)
+  _, restErr = UpdateOrg(moved, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error moving subtree beyond max depth.`) {
+    assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  }
+  moved.SetParentPubId(deepest.ParentPubId.String)
+  _, restErr = UpdateOrg(moved, ctx)
+  assert.NoError(t, restErr, `Unexpected error moving subtree to max depth.`)
+}
+
+func testOrgHierarchyConcurrentMoves(t *testing.T) {
+  ctx := context.Background()
+  x := someOrg.Clone()
+  x.SetDisplayName(`Concurrent Org X`)
+  x, restErr := CreateOrg(x, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  y := someOrg.Clone()
+  y.SetDisplayName(`Concurrent Org Y`)
+  y, restErr = CreateOrg(y, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  // Y's transaction takes its snapshot before X moves under Y.
+  txnX, err := sqldb.DB.Begin()
+  require.NoError(t, err, `Unexpected error beginning transaction.`)
+  txnY, err := sqldb.DB.Begin()
+  require.NoError(t, err, `Unexpected error beginning transaction.`)
+  _, restErr = GetOrgInTxn(y.PubId.String, ctx, txnY)
+  require.NoError(t, restErr, `Unexpected error reading org.`)
+
+  x.SetParentPubId(y.PubId.String)
+  x.Version = nulls.NewNullInt64()
+  _, restErr = UpdateOrgInTxn(x, ctx, txnX)
+  require.NoError(t, restErr, `Unexpected error moving X under Y.`)
+
+  // Moving Y under X waits on X's transaction, then sees the move.
+  done := make(chan rest.RestError)
+  go func() {
+    y.SetParentPubId(x.PubId.String)
+    y.Version = nulls.NewNullInt64()
+    _, restErr := UpdateOrgInTxn(y, ctx, txnY)
+    if restErr == nil {
+      txnY.Commit()
+    }
+    done <- restErr
+  }()
+  require.NoError(t, txnX.Commit(), `Unexpected error committing move.`)
+  restErr = <-done
+  if assert.Error(t, restErr, `Unexpected non-error creating cycle concurrently.`) {
+    assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  }
+
+  y, restErr = GetOrg(y.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error retrieving org.`)
+  assert.False(t, y.ParentPubId.Valid, `Unexpected parent for Y.`)
+}
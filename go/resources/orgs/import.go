@@ -0,0 +1,372 @@
+package orgs
+
+import (
+  "bufio"
+  "context"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net/http"
+  "strconv"
+  "strings"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ImportFormat identifies the encoding of a bulk import.
+type ImportFormat string
+
+const (
+  ImportCSV    ImportFormat = `csv`
+  ImportNDJSON ImportFormat = `ndjson`
+)
+
+// ParseImportFormat validates a format name.
+func ParseImportFormat(name string) (ImportFormat, error) {
+  switch format := ImportFormat(strings.ToLower(name)); format {
+  case ImportCSV, ImportNDJSON:
+    return format, nil
+  default:
+    return ``, fmt.Errorf(`unknown import format '%s'`, name)
+  }
+}
+
+// ImportOptions control a bulk import. In DryRun mode, each row is fully
+// processed (including the database insert) and then rolled back; DryRun
+// takes precedence over Atomic. In Atomic mode, all rows are created in a
+// single transaction and any failure causes the whole import to be rolled
+// back.
+type ImportOptions struct {
+  Format ImportFormat
+  DryRun bool
+  Atomic bool
+}
+
+// ImportStatus describes the outcome for a single import row.
+type ImportStatus string
+
+const (
+  ImportCreated    ImportStatus = `created`
+  ImportValid      ImportStatus = `valid`
+  ImportFailed     ImportStatus = `failed`
+  ImportRolledBack ImportStatus = `rolled-back`
+  ImportSkipped    ImportStatus = `skipped`
+)
+
+// ImportRowResult reports the outcome for a single import row. Rows are
+// numbered from 1, not counting any CSV header.
+type ImportRowResult struct {
+  Row    int          `json:"row"`
+  Status ImportStatus `json:"status"`
+  PubId  string       `json:"pubId,omitempty"`
+  Error  string       `json:"error,omitempty"`
+}
+
+// ImportReport summarizes a bulk import.
+type ImportReport struct {
+  DryRun  bool               `json:"dryRun"`
+  Atomic  bool               `json:"atomic"`
+  Created int                `json:"created"`
+  Failed  int                `json:"failed"`
+  Rows    []*ImportRowResult `json:"rows"`
+}
+
+// ImportRow is a single decoded import record. Err is set if the row could not
+// be decoded.
+type ImportRow struct {
+  Row int
+  Org *Org
+  Err error
+}
+
+// importAddressColumns are the CSV columns which make up the (single) Org
+// address. All other columns are named for the Org JSON fields.
+var importAddressColumns = map[string]bool{
+  `label`: true,
+  `address1`: true,
+  `address2`: true,
+  `city`: true,
+  `state`: true,
+  `zip`: true,
+}
+
+var importOrgColumns = map[string]bool{
+  `displayName`: true,
+  `summary`: true,
+  `email`: true,
+  `phone`: true,
+  `homepage`: true,
+  `logoURL`: true,
+  `parentPubId`: true,
+  `active`: true,
+  `authId`: true,
+  `legalID`: true,
+  `legalIDType`: true,
+}
+
+// ReadImportRows decodes the Orgs to import. CSV input must begin with a
+// header row naming the Org JSON fields (e.g., 'displayName', 'email') and,
+// optionally, the address fields 'label', 'address1', 'address2', 'city',
+// 'state', and 'zip'. Empty CSV values are treated as null. NDJSON input
+// carries one Org JSON object per line; blank lines are ignored.
+//
+// Problems with individual rows are reported on the row, while problems with
+// the input as a whole (e.g., an unknown CSV column) result in an error.
+func ReadImportRows(r io.Reader, format ImportFormat) ([]*ImportRow, error) {
+  switch format {
+  case ImportCSV:
+    return readCSVImportRows(r)
+  case ImportNDJSON:
+    return readNDJSONImportRows(r)
+  default:
+    return nil, fmt.Errorf(`unknown import format '%s'`, format)
+  }
+}
+
+func readCSVImportRows(r io.Reader) ([]*ImportRow, error) {
+  reader := csv.NewReader(r)
+  reader.TrimLeadingSpace = true
+  header, err := reader.Read()
+  if err == io.EOF {
+    return make([]*ImportRow, 0), nil
+  } else if err != nil {
+    return nil, fmt.Errorf(`could not read CSV header: %s`, err)
+  }
+  for _, column := range header {
+    if !importOrgColumns[column] && !importAddressColumns[column] {
+      return nil, fmt.Errorf(`unknown import column '%s'`, column)
+    }
+  }
+  // Allow short rows; we check the field count ourselves for better errors.
+  reader.FieldsPerRecord = -1
+
+  rows := make([]*ImportRow, 0)
+  for rowNum := 1; ; rowNum++ {
+    record, err := reader.Read()
+    if err == io.EOF {
+      break
+    }
+    row := &ImportRow{Row: rowNum}
+    rows = append(rows, row)
+    if err != nil {
+      row.Err = err
+      continue
+    }
+    if len(record) != len(header) {
+      row.Err = fmt.Errorf(`expected %d fields, found %d`, len(header), len(record))
+      continue
+    }
+    row.Org, row.Err = csvRecordToOrg(header, record)
+  }
+
+  return rows, nil
+}
+
+func csvRecordToOrg(header []string, record []string) (*Org, error) {
+  orgData := make(map[string]interface{})
+  addressData := make(map[string]interface{})
+  for i, column := range header {
+    value := strings.TrimSpace(record[i])
+    if value == `` {
+      continue
+    }
+    if importAddressColumns[column] {
+      addressData[column] = value
+    } else if column == `active` {
+      active, err := strconv.ParseBool(value)
+      if err != nil {
+        return nil, fmt.Errorf(`invalid 'active' value '%s'`, value)
+      }
+      orgData[column] = active
+    } else {
+      orgData[column] = value
+    }
+  }
+  addresses := make([]interface{}, 0)
+  if len(addressData) > 0 {
+    addressData[`idx`] = 0
+    addresses = append(addresses, addressData)
+  }
+  orgData[`addresses`] = addresses
+
+  data, err := json.Marshal(orgData)
+  if err != nil {
+    return nil, err
+  }
+  org := &Org{}
+  if err := json.Unmarshal(data, org); err != nil {
+    return nil, err
+  }
+
+  return org, nil
+}
+
+// maxNDJSONLine bounds the size of a single NDJSON record.
+const maxNDJSONLine = 1024 * 1024
+
+func readNDJSONImportRows(r io.Reader) ([]*ImportRow, error) {
+  scanner := bufio.NewScanner(r)
+  scanner.Buffer(make([]byte, 64 * 1024), maxNDJSONLine)
+
+  rows := make([]*ImportRow, 0)
+  for rowNum := 1; scanner.Scan(); {
+    line := strings.TrimSpace(scanner.Text())
+    if line == `` {
+      continue
+    }
+    row := &ImportRow{Row: rowNum}
+    rows = append(rows, row)
+    rowNum++
+
+    org := &Org{}
+    if err := json.Unmarshal([]byte(line), org); err != nil {
+      row.Err = err
+      continue
+    }
+    if org.Addresses == nil {
+      org.Addresses = make([]*locations.Address, 0)
+    }
+    row.Org = org
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, fmt.Errorf(`could not read NDJSON: %s`, err)
+  }
+
+  return rows, nil
+}
+
+// ImportOrgs bulk creates Orgs from CSV or NDJSON input (see ReadImportRows)
+// using CreateOrgInTxn, returning a per-row report. Malformed input as a whole
+// results in a rest.BadRequestError, while individual row failures are
+// recorded in the report. See ImportOptions for the dry-run and atomic modes.
+//
+// Where the context carries a Principal (see WithPrincipal), rows setting the
+// account fields fail unless the Principal is authorized for
+// ActionImportAccounts, and rows naming a parent are authorized as any other
+// new child (see CreateOrg).
+func ImportOrgs(r io.Reader, opts *ImportOptions, ctx context.Context) (*ImportReport, rest.RestError) {
+  rows, err := ReadImportRows(r, opts.Format)
+  if err != nil {
+    return nil, rest.BadRequestError(`Could not read import.`, err)
+  }
+  var accountsErr rest.RestError
+  if p := PrincipalFromContext(ctx); p != nil {
+    accountsErr = Authorize(p, ``, ActionImportAccounts, ctx)
+    if accountsErr != nil && accountsErr.Code() != http.StatusForbidden {
+      return nil, accountsErr
+    }
+  }
+
+  report := &ImportReport{DryRun: opts.DryRun, Atomic: opts.Atomic, Rows: make([]*ImportRowResult, len(rows))}
+  for i, row := range rows {
+    report.Rows[i] = &ImportRowResult{Row: row.Row}
+    if row.Err == nil && accountsErr != nil && hasAccountFields(row.Org) {
+      row.Err = accountsErr
+    }
+    if row.Err == nil {
+      if restErr := row.Org.Validate(ctx); restErr != nil {
+        row.Err = restErr
+      }
+    }
+  }
+
+  if opts.Atomic && !opts.DryRun {
+    if restErr := importAtomic(rows, report, ctx); restErr != nil {
+      return nil, restErr
+    }
+    return report, nil
+  }
+
+  for i, row := range rows {
+    result := report.Rows[i]
+    if row.Err != nil {
+      result.Status, result.Error = ImportFailed, row.Err.Error()
+      continue
+    }
+    txn, err := sqldb.DB.Begin()
+    if err != nil {
+      return nil, rest.ServerError(`Could not import orgs. (txn error)`, err)
+    }
+    // CreateOrgInTxn rolls back the txn on failure.
+    if org, restErr := CreateOrgInTxn(row.Org, ctx, txn); restErr != nil {
+      result.Status, result.Error = ImportFailed, restErr.Error()
+    } else if opts.DryRun {
+      txn.Rollback()
+      result.Status = ImportValid
+    } else if err := txn.Commit(); err != nil {
+      result.Status, result.Error = ImportFailed, err.Error()
+    } else {
+      result.Status, result.PubId = ImportCreated, org.PubId.String
+    }
+  }
+  report.tally()
+
+  return report, nil
+}
+
+// importAtomic creates all the rows in a single transaction. Once a row fails,
+// the transaction is rolled back; earlier rows are marked as rolled back and
+// the remaining rows are only checked for decoding errors.
+func importAtomic(rows []*ImportRow, report *ImportReport, ctx context.Context) rest.RestError {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return rest.ServerError(`Could not import orgs. (txn error)`, err)
+  }
+
+  failed := false
+  for i, row := range rows {
+    result := report.Rows[i]
+    if row.Err != nil {
+      if !failed {
+        txn.Rollback()
+        failed = true
+      }
+      result.Status, result.Error = ImportFailed, row.Err.Error()
+    } else if failed {
+      result.Status = ImportSkipped
+    } else if org, restErr := CreateOrgInTxn(row.Org, ctx, txn); restErr != nil {
+      // CreateOrgInTxn rolls back the txn on failure.
+      failed = true
+      result.Status, result.Error = ImportFailed, restErr.Error()
+    } else {
+      result.Status, result.PubId = ImportCreated, org.PubId.String
+    }
+  }
+
+  if !failed {
+    if err := txn.Commit(); err != nil {
+      failed = true
+    }
+  }
+  if failed {
+    for _, result := range report.Rows {
+      if result.Status == ImportCreated {
+        result.Status, result.PubId = ImportRolledBack, ``
+      }
+    }
+  }
+  report.tally()
+
+  return nil
+}
+
+// hasAccountFields reports whether the new Org sets any of the account fields
+// guarded by ActionImportAccounts.
+func hasAccountFields(o *Org) bool {
+  return o.AuthId.Valid || o.Active.Valid || o.LegalID.Valid || o.LegalIDType.Valid
+}
+
+func (r *ImportReport) tally() {
+  r.Created, r.Failed = 0, 0
+  for _, result := range r.Rows {
+    switch result.Status {
+    case ImportCreated:
+      r.Created++
+    case ImportFailed:
+      r.Failed++
+    }
+  }
+}
@@ -0,0 +1,111 @@
+package orgs_test
+
+import (
+  "context"
+  "fmt"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+const importCSV = `displayName,email,phone,active,city,state
+CSV Org A,a@test.com,202-555-0101,true,Dayton,OH
+CSV Org B,,,false,,
+CSV Org C,c@test.com,,maybe,,
+`
+
+func TestReadImportRowsCSV(t *testing.T) {
+  rows, err := ReadImportRows(strings.NewReader(importCSV), ImportCSV)
+  require.NoError(t, err, `Unexpected error reading CSV.`)
+  require.Len(t, rows, 3, `Unexpected number of rows.`)
+
+  a := rows[0]
+  require.NoError(t, a.Err, `Unexpected row error.`)
+  assert.Equal(t, 1, a.Row, `Unexpected row number.`)
+  assert.Equal(t, `CSV Org A`, a.Org.DisplayName.String, `Unexpected display name.`)
+  assert.Equal(t, `a@test.com`, a.Org.Email.String, `Unexpected email.`)
+  assert.True(t, a.Org.Active.Bool, `Unexpected active value.`)
+  require.Len(t, a.Org.Addresses, 1, `Unexpected number of addresses.`)
+  assert.Equal(t, `Dayton`, a.Org.Addresses[0].City.String, `Unexpected city.`)
+
+  b := rows[1]
+  require.NoError(t, b.Err, `Unexpected row error.`)
+  assert.False(t, b.Org.Email.Valid, `Empty value not treated as null.`)
+  assert.Len(t, b.Org.Addresses, 0, `Unexpected address for empty address fields.`)
+
+  assert.Error(t, rows[2].Err, `Unexpected non-error for bad 'active' value.`)
+
+  _, err = ReadImportRows(strings.NewReader("displayName,foo\nx,y\n"), ImportCSV)
+  assert.Error(t, err, `Unexpected non-error for unknown column.`)
+}
+
+func TestReadImportRowsNDJSON(t *testing.T) {
+  input := `{"displayName": "JSON Org A", "email": "a@test.com"}
+
+not json
+{"displayName": "JSON Org C", "addresses": [{"city": "Dayton", "idx": 0}]}
+`
+  rows, err := ReadImportRows(strings.NewReader(input), ImportNDJSON)
+  require.NoError(t, err, `Unexpected error reading NDJSON.`)
+  require.Len(t, rows, 3, `Unexpected number of rows.`)
+  assert.NoError(t, rows[0].Err, `Unexpected row error.`)
+  assert.Equal(t, `JSON Org A`, rows[0].Org.DisplayName.String, `Unexpected display name.`)
+  assert.NotNil(t, rows[0].Org.Addresses, `Expected empty, non-nil addresses.`)
+  assert.Equal(t, 2, rows[1].Row, `Blank line unexpectedly counted.`)
+  assert.Error(t, rows[1].Err, `Unexpected non-error for bad JSON.`)
+  require.NoError(t, rows[2].Err, `Unexpected row error.`)
+  assert.Equal(t, `Dayton`, rows[2].Org.Addresses[0].City.String, `Unexpected city.`)
+}
+
+func TestParseImportFormat(t *testing.T) {
+  format, err := ParseImportFormat(`CSV`)
+  assert.NoError(t, err, `Unexpected error parsing format.`)
+  assert.Equal(t, ImportCSV, format, `Unexpected format.`)
+  _, err = ParseImportFormat(`xml`)
+  assert.Error(t, err, `Unexpected non-error parsing unknown format.`)
+}
+
+func testOrgImport(t *testing.T) {
+  ctx := context.Background()
+  report, restErr := ImportOrgs(strings.NewReader(importCSV), &ImportOptions{Format: ImportCSV, DryRun: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error on dry run.`)
+  assert.Equal(t, ImportValid, report.Rows[0].Status, `Unexpected status for valid row.`)
+  assert.Equal(t, ImportFailed, report.Rows[1].Status, `Unexpected status for row missing email.`)
+  assert.Equal(t, ImportFailed, report.Rows[2].Status, `Unexpected status for bad row.`)
+  assert.Equal(t, 0, report.Created, `Unexpected creations on dry run.`)
+  assert.Equal(t, 2, report.Failed, `Unexpected failure count.`)
+
+  report, restErr = ImportOrgs(strings.NewReader(importCSV), &ImportOptions{Format: ImportCSV, Atomic: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error on atomic import.`)
+  assert.Equal(t, ImportRolledBack, report.Rows[0].Status, `Unexpected status for rolled back row.`)
+  assert.Equal(t, 0, report.Created, `Unexpected creations on failed atomic import.`)
+
+  report, restErr = ImportOrgs(strings.NewReader(importCSV), &ImportOptions{Format: ImportCSV}, ctx)
+  require.NoError(t, restErr, `Unexpected error on import.`)
+  assert.Equal(t, 1, report.Created, `Unexpected creation count.`)
+  require.Equal(t, ImportCreated, report.Rows[0].Status, `Unexpected status for created row.`)
+  org, restErr := GetOrg(report.Rows[0].PubId, ctx)
+  require.NoError(t, restErr, `Unexpected error retrieving imported org.`)
+  assert.Equal(t, `CSV Org A`, org.DisplayName.String, `Unexpected display name.`)
+
+  // Without platform admin standing, the account fields are off limits and any
+  // parent must be one the principal may update.
+  memberCtx := WithPrincipal(ctx, NewPrincipal(`opqrstu789`, nil))
+  input := fmt.Sprintf(`{"displayName": "Member Org A", "email": "a@test.com", "authId": "zyxwvut000"}
+{"displayName": "Member Org B", "email": "b@test.com", "parentPubId": "%s"}
+{"displayName": "Member Org C", "email": "c@test.com"}
+`, org.PubId.String)
+  report, restErr = ImportOrgs(strings.NewReader(input), &ImportOptions{Format: ImportNDJSON, DryRun: true}, memberCtx)
+  require.NoError(t, restErr, `Unexpected error on member import.`)
+  assert.Equal(t, ImportFailed, report.Rows[0].Status, `Unexpected status for row setting account fields.`)
+  assert.Equal(t, ImportFailed, report.Rows[1].Status, `Unexpected status for row with unauthorized parent.`)
+  assert.Equal(t, ImportValid, report.Rows[2].Status, `Unexpected status for plain row.`)
+
+  adminCtx := WithPrincipal(ctx, NewPrincipal(`opqrstu789`, map[string]interface{}{PlatformAdminClaim: true}))
+  report, restErr = ImportOrgs(strings.NewReader(input), &ImportOptions{Format: ImportNDJSON, DryRun: true}, adminCtx)
+  require.NoError(t, restErr, `Unexpected error on platform admin import.`)
+  assert.Equal(t, 0, report.Failed, `Unexpected failures for platform admin.`)
+}
@@ -0,0 +1,311 @@
+package orgs
+
+import (
+  "context"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "database/sql"
+  "encoding/base64"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "strings"
+  "sync"
+  "unicode"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// KeyProvider supplies the AES-256 keys used to encrypt legal IDs and webhook
+// secrets at rest; both share the one key set, and so the LegalIDKeysEnv
+// configuration. Keys are identified so they can be rotated: new values are
+// encrypted with the current key, while stored values name the key needed to
+// decrypt them. Retire a key only once no legal ID or webhook secret names it.
+type KeyProvider interface {
+  // CurrentKey returns the ID and value of the key to encrypt with.
+  CurrentKey() (string, []byte, error)
+  // Key returns the identified key.
+  Key(id string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider over a fixed set of keys.
+type StaticKeyProvider struct {
+  current string
+  keys    map[string][]byte
+}
+
+// NewStaticKeyProvider creates a StaticKeyProvider encrypting with the key
+// identified by 'current'. Key IDs may not contain ':'.
+func NewStaticKeyProvider(current string, keys map[string][]byte) *StaticKeyProvider {
+  return &StaticKeyProvider{current, keys}
+}
+
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+  key, err := p.Key(p.current)
+  return p.current, key, err
+}
+
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+  key, ok := p.keys[id]
+  if !ok {
+    return nil, fmt.Errorf(`unknown legal ID key '%s'`, id)
+  }
+  return key, nil
+}
+
+// LegalIDKeysEnv names the environment variable read by EnvKeyProvider. The
+// value is a comma separated list of '<key ID>:<base64 key>' entries, the
+// first of which is the current key. Despite the name, the keys also encrypt
+// webhook secrets.
+const LegalIDKeysEnv = `LEGAL_ID_KEYS`
+
+// EnvKeyProvider is a KeyProvider reading its keys from the LegalIDKeysEnv
+// environment variable. It is the default KeyProvider. The keys are parsed on
+// first use and kept; after rotating the keys in the environment, call Reload.
+// The zero value is ready for use.
+type EnvKeyProvider struct {
+  mu       sync.Mutex
+  provider *StaticKeyProvider
+}
+
+// Reload re-reads the keys from the environment.
+func (p *EnvKeyProvider) Reload() error {
+  provider, err := loadEnvKeys()
+  if err != nil {
+    return err
+  }
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  p.provider = provider
+
+  return nil
+}
+
+// load returns the parsed keys, reading them on first use. A missing or
+// malformed configuration is not kept, so it may be corrected in place.
+func (p *EnvKeyProvider) load() (*StaticKeyProvider, error) {
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  if p.provider == nil {
+    provider, err := loadEnvKeys()
+    if err != nil {
+      return nil, err
+    }
+    p.provider = provider
+  }
+
+  return p.provider, nil
+}
+
+func loadEnvKeys() (*StaticKeyProvider, error) {
+  value := os.Getenv(LegalIDKeysEnv)
+  if value == `` {
+    return nil, fmt.Errorf(`no legal ID keys configured; set '%s'`, LegalIDKeysEnv)
+  }
+  provider := NewStaticKeyProvider(``, make(map[string][]byte))
+  for i, entry := range strings.Split(value, `,`) {
+    bits := strings.SplitN(strings.TrimSpace(entry), `:`, 2)
+    if len(bits) != 2 {
+      return nil, fmt.Errorf(`malformed legal ID key entry %d`, i + 1)
+    }
+    key, err := base64.StdEncoding.DecodeString(bits[1])
+    if err != nil {
+      return nil, fmt.Errorf(`could not decode legal ID key '%s': %s`, bits[0], err)
+    }
+    if i == 0 {
+      provider.current = bits[0]
+    }
+    provider.keys[bits[0]] = key
+  }
+
+  return provider, nil
+}
+
+func (p *EnvKeyProvider) CurrentKey() (string, []byte, error) {
+  provider, err := p.load()
+  if err != nil {
+    return ``, nil, err
+  }
+  return provider.CurrentKey()
+}
+
+func (p *EnvKeyProvider) Key(id string) ([]byte, error) {
+  provider, err := p.load()
+  if err != nil {
+    return nil, err
+  }
+  return provider.Key(id)
+}
+
+var keyProvider KeyProvider = &EnvKeyProvider{}
+
+// SetKeyProvider replaces the KeyProvider used to encrypt and decrypt legal
+// IDs and webhook secrets.
+func SetKeyProvider(p KeyProvider) {
+  keyProvider = p
+}
+
+// Encrypted values are stored as '<prefix><key ID>:<base64 nonce+sealed>'.
+// Stored values without the prefix are treated as legacy plaintext.
+const cipherPrefix = `enc:v1:`
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  return cipher.NewGCM(block)
+}
+
+// encryptAtRest encrypts a value with AES-GCM under the current key.
+func encryptAtRest(plain string) (string, error) {
+  id, key, err := keyProvider.CurrentKey()
+  if err != nil {
+    return ``, err
+  }
+  gcm, err := newCipher(key)
+  if err != nil {
+    return ``, err
+  }
+  nonce := make([]byte, gcm.NonceSize())
+  if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+    return ``, err
+  }
+  sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+
+  return cipherPrefix + id + `:` + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptAtRest reverses encryptAtRest. Legacy plaintext values are returned
+// as is.
+func decryptAtRest(stored string) (string, error) {
+  if !strings.HasPrefix(stored, cipherPrefix) {
+    return stored, nil
+  }
+  bits := strings.SplitN(strings.TrimPrefix(stored, cipherPrefix), `:`, 2)
+  if len(bits) != 2 {
+    return ``, fmt.Errorf(`malformed encrypted value`)
+  }
+  key, err := keyProvider.Key(bits[0])
+  if err != nil {
+    return ``, err
+  }
+  sealed, err := base64.StdEncoding.DecodeString(bits[1])
+  if err != nil {
+    return ``, err
+  }
+  gcm, err := newCipher(key)
+  if err != nil {
+    return ``, err
+  }
+  if len(sealed) < gcm.NonceSize() {
+    return ``, fmt.Errorf(`malformed encrypted value`)
+  }
+  plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+  if err != nil {
+    return ``, err
+  }
+
+  return string(plain), nil
+}
+
+// EncryptLegalID encrypts a legal ID with AES-GCM under the current key.
+func EncryptLegalID(plain string) (string, error) {
+  return encryptAtRest(plain)
+}
+
+// DecryptLegalID reverses EncryptLegalID. Legacy plaintext values are
+// returned as is.
+func DecryptLegalID(stored string) (string, error) {
+  return decryptAtRest(stored)
+}
+
+// MaskLegalID replaces all but the last four letters and digits of a legal ID
+// with '*', preserving any separators; e.g., '555-55-5555' becomes
+// '***-**-5555'. IDs of four or fewer letters and digits are masked entirely.
+func MaskLegalID(id string) string {
+  runes := []rune(id)
+  visible := 0
+  for _, r := range runes {
+    if unicode.IsLetter(r) || unicode.IsDigit(r) {
+      visible += 1
+    }
+  }
+  if visible > 4 {
+    visible = 4
+  } else {
+    visible = 0
+  }
+  for i := len(runes) - 1; i >= 0; i -= 1 {
+    if unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) {
+      if visible > 0 {
+        visible -= 1
+      } else {
+        runes[i] = '*'
+      }
+    }
+  }
+  return string(runes)
+}
+
+// IsMaskedLegalID is true if the legal ID is the masked form of the stored
+// legal ID, as returned to clients which may not see the full legal ID.
+func IsMaskedLegalID(id string, stored string) bool {
+  return id != stored && id == MaskLegalID(stored)
+}
+
+// RedactLegalID masks the legal ID for clients which may not see it.
+func (o *OrgSummary) RedactLegalID() {
+  if o.LegalID.Valid {
+    o.LegalID.String = MaskLegalID(o.LegalID.String)
+  }
+}
+
+// storageLegalID encrypts an Org legal ID for storage. A legal ID containing
+// the '*' used in masking (see MaskLegalID), which cannot be the full legal
+// ID, results in a FieldError.
+func storageLegalID(legalID nulls.String) (nulls.String, rest.RestError) {
+  if !legalID.Valid || legalID.String == `` {
+    return legalID, nil
+  }
+  if strings.ContainsRune(legalID.String, '*') {
+    return legalID, NewFieldError(`legalID`, `may not be a masked value`)
+  }
+  encrypted, err := EncryptLegalID(legalID.String)
+  if err != nil {
+    return legalID, rest.ServerError(`Could not encrypt legal ID.`, err)
+  }
+
+  return nulls.NewString(encrypted), nil
+}
+
+// updateLegalIDInTxn determines the stored legal ID for an update of the
+// oldOrg. Clients which only ever see the masked legal ID send it back
+// unchanged, in which case we keep the existing value.
+func updateLegalIDInTxn(o *Org, oldOrg *Org, ctx context.Context, txn *sql.Tx) (nulls.String, rest.RestError) {
+  if !o.LegalID.Valid || !oldOrg.LegalID.Valid || !IsMaskedLegalID(o.LegalID.String, oldOrg.LegalID.String) {
+    return storageLegalID(o.LegalID)
+  }
+
+  var stored nulls.String
+  if err := txn.Stmt(getLegalIdQuery).QueryRowContext(ctx, o.PubId.String).Scan(&stored); err == sql.ErrNoRows {
+    return stored, rest.NotFoundError(fmt.Sprintf(`Did not find org '%s'.`, o.PubId.String), nil)
+  } else if err != nil {
+    return stored, rest.ServerError(`Could not retrieve org legal ID.`, err)
+  }
+
+  return stored, nil
+}
+
+const getLegalIdStatement = `SELECT u.legal_id FROM users u JOIN entities e ON u.id=e.id WHERE e.pub_id=?`
+var getLegalIdQuery *sql.Stmt
+
+func setupLegalIdDB(db *sql.DB) {
+  var err error
+  if getLegalIdQuery, err = db.Prepare(getLegalIdStatement); err != nil {
+    log.Fatalf("mysql: prepare get legal ID stmt: %v", err)
+  }
+}
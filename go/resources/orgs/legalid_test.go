@@ -0,0 +1,137 @@
+package orgs_test
+
+import (
+  "context"
+  "net/http"
+  "os"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+var testKeyProvider = NewStaticKeyProvider(`test`, map[string][]byte{
+  `test`: []byte(`0123456789abcdef0123456789abcdef`),
+  `old`: []byte(`fedcba9876543210fedcba9876543210`),
+})
+
+func TestEncryptLegalID(t *testing.T) {
+  SetKeyProvider(testKeyProvider)
+  encrypted, err := EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting legal ID.`)
+  assert.NotContains(t, encrypted, `5555`, `Legal ID not encrypted.`)
+  again, err := EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting legal ID.`)
+  assert.NotEqual(t, encrypted, again, `Encryption is deterministic.`)
+
+  decrypted, err := DecryptLegalID(encrypted)
+  require.NoError(t, err, `Unexpected error decrypting legal ID.`)
+  assert.Equal(t, `555-55-5555`, decrypted, `Unexpected decrypted legal ID.`)
+
+  plain, err := DecryptLegalID(`12-3456789`)
+  require.NoError(t, err, `Unexpected error 'decrypting' legacy legal ID.`)
+  assert.Equal(t, `12-3456789`, plain, `Legacy legal ID not returned as is.`)
+
+  _, err = DecryptLegalID(encrypted[:len(encrypted) - 4] + `AAAA`)
+  assert.Error(t, err, `Unexpected non-error decrypting tampered legal ID.`)
+}
+
+func TestLegalIDKeyRotation(t *testing.T) {
+  SetKeyProvider(NewStaticKeyProvider(`old`, map[string][]byte{`old`: []byte(`fedcba9876543210fedcba9876543210`)}))
+  encrypted, err := EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting legal ID.`)
+
+  SetKeyProvider(testKeyProvider)
+  decrypted, err := DecryptLegalID(encrypted)
+  require.NoError(t, err, `Unexpected error decrypting with rotated key.`)
+  assert.Equal(t, `555-55-5555`, decrypted, `Unexpected decrypted legal ID.`)
+}
+
+func TestEnvKeyProvider(t *testing.T) {
+  defer SetKeyProvider(testKeyProvider)
+  defer os.Unsetenv(LegalIDKeysEnv)
+  provider := &EnvKeyProvider{}
+  SetKeyProvider(provider)
+
+  os.Unsetenv(LegalIDKeysEnv)
+  _, err := EncryptLegalID(`555-55-5555`)
+  assert.Error(t, err, `Unexpected non-error encrypting without keys.`)
+
+  os.Setenv(LegalIDKeysEnv, `k2:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=, k1:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=`)
+  encrypted, err := EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting with environment keys.`)
+  assert.True(t, strings.HasPrefix(encrypted, `enc:v1:k2:`), `Not encrypted with the first key.`)
+
+  // Rotated keys are only picked up on reload.
+  os.Setenv(LegalIDKeysEnv, `k3:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=, k2:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=`)
+  encrypted, err = EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting with cached keys.`)
+  assert.True(t, strings.HasPrefix(encrypted, `enc:v1:k2:`), `Keys unexpectedly re-read.`)
+  require.NoError(t, provider.Reload(), `Unexpected error reloading keys.`)
+  encrypted, err = EncryptLegalID(`555-55-5555`)
+  require.NoError(t, err, `Unexpected error encrypting with reloaded keys.`)
+  assert.True(t, strings.HasPrefix(encrypted, `enc:v1:k3:`), `Not encrypted with the rotated key.`)
+  os.Setenv(LegalIDKeysEnv, `bogus`)
+  assert.Error(t, provider.Reload(), `Unexpected non-error reloading malformed keys.`)
+  _, err = EncryptLegalID(`555-55-5555`)
+  assert.NoError(t, err, `Failed reload discarded the loaded keys.`)
+}
+
+func TestMaskLegalID(t *testing.T) {
+  assert.Equal(t, `***-**-5555`, MaskLegalID(`555-55-5555`), `Unexpected SSN mask.`)
+  assert.Equal(t, `**-***6789`, MaskLegalID(`12-3456789`), `Unexpected EIN mask.`)
+  assert.Equal(t, `***`, MaskLegalID(`123`), `Short ID not masked entirely.`)
+  assert.Equal(t, `**-**`, MaskLegalID(`12-34`), `Short ID not masked entirely.`)
+  assert.Equal(t, `*2345`, MaskLegalID(`12345`), `Unexpected mask of five character ID.`)
+  assert.True(t, IsMaskedLegalID(`***-**-5555`, `555-55-5555`), `Masked ID not recognized.`)
+  assert.False(t, IsMaskedLegalID(`555-55-5555`, `555-55-5555`), `Plain ID recognized as masked.`)
+  assert.False(t, IsMaskedLegalID(`***-**-1234`, `555-55-5555`), `Mask of another ID recognized as masked.`)
+  assert.False(t, IsMaskedLegalID(`123`, `123`), `Plain short ID recognized as masked.`)
+  assert.True(t, IsMaskedLegalID(`***`, `123`), `Masked short ID not recognized.`)
+
+  org := trivialOrg.Clone()
+  org.RedactLegalID()
+  assert.Equal(t, `***-**-5555`, org.LegalID.String, `Org legal ID not redacted.`)
+  assert.Equal(t, `555-55-5555`, trivialOrg.LegalID.String, `Redaction affected original.`)
+}
+
+func storedLegalID(t *testing.T, pubID string) string {
+  var stored nulls.String
+  err := sqldb.DB.QueryRow(`SELECT u.legal_id FROM users u JOIN entities e ON u.id=e.id WHERE e.pub_id=?`, pubID).Scan(&stored)
+  require.NoError(t, err, `Unexpected error reading stored legal ID.`)
+  return stored.String
+}
+
+func testOrgLegalID(t *testing.T) {
+  ctx := context.Background()
+  org, restErr := GetOrg(someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error getting Org.`)
+
+  org.LegalID = nulls.NewString(`555-55-5555`)
+  org.LegalIDType = nulls.NewString(`SSN`)
+  updated, restErr := UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating legal ID.`)
+  assert.Equal(t, `555-55-5555`, updated.LegalID.String, `Legal ID not decrypted.`)
+  stored := storedLegalID(t, someOrgID)
+  assert.True(t, strings.HasPrefix(stored, `enc:v1:`), `Legal ID not encrypted at rest.`)
+
+  updated.RedactLegalID()
+  updated.SetSummary(`Masked legal ID round trip.`)
+  updated, restErr = UpdateOrg(updated, ctx)
+  require.NoError(t, restErr, `Unexpected error updating with masked legal ID.`)
+  assert.Equal(t, `555-55-5555`, updated.LegalID.String, `Masked legal ID overwrote stored value.`)
+  assert.Equal(t, stored, storedLegalID(t, someOrgID), `Stored legal ID changed.`)
+
+  // A mask which does not match the stored legal ID is not taken as the
+  // stored legal ID.
+  updated.LegalID = nulls.NewString(`***-**-1234`)
+  _, restErr = UpdateOrg(updated, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error updating with mask of another legal ID.`) {
+    assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  }
+  assert.Equal(t, stored, storedLegalID(t, someOrgID), `Stored legal ID changed.`)
+}
@@ -0,0 +1,323 @@
+package orgs
+
+import (
+  "context"
+  "fmt"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// DefaultListLimit is the page size used when a list request does not specify
+// a limit, and MaxListLimit caps the page size a client may request.
+const DefaultListLimit int64 = 50
+const MaxListLimit int64 = 500
+
+// ListParams describes a page of an Org list request. When CursorMode is set,
+// the Offset is ignored and the page is located by Cursor instead; an empty
+// Cursor requests the first page.
+type ListParams struct {
+  Sort       string
+  Search     string
+  // FullText selects a relevance ranked full-text search (see
+  // ParseSearchQuery) for the Search term in place of the general search.
+  FullText   bool
+  Offset     int64
+  Limit      int64
+  Cursor     string
+  CursorMode bool
+  // IncludeArchived includes archived Orgs, which are excluded by default.
+  IncludeArchived bool
+  // Near, if set, limits the list to Orgs with an address within Radius
+  // meters (or the DefaultNearRadius) of the point, nearest first.
+  Near       *GeoPoint
+  Radius     float64
+  // BBox, if set, limits the list to Orgs with an address within the box.
+  BBox       *BBox
+  Filters    ListFilters
+  // Filter is a filter expression (see OrgsFilterWhereGenerator).
+  Filter     string
+  // Facets names the facets (see orgFacets) to count over the matching Orgs.
+  Facets     []string
+}
+
+func (p *ListParams) fullTextSearch() bool {
+  return p.FullText && p.Search != ``
+}
+
+// OrgListItem is an OrgSummary as listed, along with the annotations from a
+// full-text or 'near' search.
+type OrgListItem struct {
+  OrgSummary
+  // Distance is the distance (in meters) from the point of a 'near' search,
+  // or null otherwise.
+  Distance      nulls.Float64 `json:"distance"`
+  // Relevance is the score of a full-text search match, or null otherwise.
+  Relevance     nulls.Float64 `json:"relevance"`
+  // Highlights holds snippets of the fields matching a full-text search,
+  // keyed by field (see HighlightOrg).
+  Highlights    map[string]string `json:"highlights,omitempty"`
+}
+
+func newListItems(orgs []*OrgSummary) []*OrgListItem {
+  items := make([]*OrgListItem, len(orgs))
+  for i, org := range orgs {
+    items[i] = &OrgListItem{OrgSummary: *org}
+  }
+  return items
+}
+
+// OrgsPage is a single page of OrgListItem results along with the total
+// number of Orgs matching the request. NextCursor and PrevCursor are only set for
+// cursor mode requests, and only when there is a next or previous page.
+// Facets holds the buckets for each requested facet, counted over all the
+// matching Orgs.
+type OrgsPage struct {
+  Items      []*OrgListItem `json:"items"`
+  TotalCount int64         `json:"totalCount"`
+  Offset     int64         `json:"offset"`
+  Limit      int64         `json:"limit"`
+  NextCursor string        `json:"nextCursor,omitempty"`
+  PrevCursor string        `json:"prevCursor,omitempty"`
+  Facets     map[string][]*FacetBucket `json:"facets,omitempty"`
+}
+
+const listOrgsSelect = `SELECT ` + CommonOrgSummaryFields + CommonOrgsFrom
+const countOrgsSelect = `SELECT COUNT(*) ` + CommonOrgsFrom
+
+// ListOrgs retrieves a page of OrgSummary records matching the (optional)
+// search term, location, and filters, ordered according to one of the
+// OrgsSorts. Requesting an unknown sort or facet or providing an invalid
+// cursor results in a rest.BadRequestError.
+//
+// Full-text search results are ordered by relevance and 'near' requests by
+// distance, unless a sort is given. Each OrgListItem carries its Relevance
+// and Highlights or Distance, as appropriate. Cursor mode is not supported
+// for either.
+func ListOrgs(params *ListParams, ctx context.Context) (*OrgsPage, rest.RestError) {
+  sort, ok := OrgsSorts[params.Sort]
+  if !ok {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Unknown sort '%s'.`, params.Sort), nil)
+  }
+  if params.CursorMode && (params.Near != nil || params.fullTextSearch()) {
+    return nil, rest.BadRequestError(`Cursor paging is not supported for full-text or 'near' searches.`, nil)
+  }
+  if restErr := checkFacets(params.Facets); restErr != nil {
+    return nil, restErr
+  }
+  limit := params.Limit
+  if limit <= 0 {
+    limit = DefaultListLimit
+  } else if limit > MaxListLimit {
+    limit = MaxListLimit
+  }
+  offset := params.Offset
+  if offset < 0 || params.CursorMode {
+    offset = 0
+  }
+
+  whereBit, whereParams, restErr := listWhereBit(params)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  var totalCount int64
+  if err := sqldb.DB.QueryRowContext(ctx, countOrgsSelect + whereBit, whereParams...).Scan(&totalCount); err != nil {
+    return nil, rest.ServerError(`Could not count orgs.`, err)
+  }
+
+  var page *OrgsPage
+  if params.CursorMode {
+    page, restErr = listOrgsByCursor(params, whereBit, whereParams, totalCount, limit, ctx)
+  } else if params.Near != nil || params.fullTextSearch() {
+    page, restErr = listOrgsAnnotated(params, whereBit, whereParams, totalCount, limit, offset, ctx)
+  } else {
+    query := listOrgsSelect + whereBit + `ORDER BY ` + sort + `LIMIT ? OFFSET ?`
+    var orgs []*OrgSummary
+    if orgs, restErr = queryOrgSummaries(query, append(whereParams, limit, offset), ctx); restErr == nil {
+      page = &OrgsPage{Items: newListItems(orgs), TotalCount: totalCount, Offset: offset, Limit: limit}
+    }
+  }
+  if restErr != nil {
+    return nil, restErr
+  }
+  if len(params.Facets) > 0 {
+    if page.Facets, restErr = countFacets(params.Facets, whereBit, whereParams, ctx); restErr != nil {
+      return nil, restErr
+    }
+  }
+
+  return page, nil
+}
+
+// listWhereBit generates the 'WHERE' clause selecting the Orgs matching the
+// list parameters (ignoring paging), preceded by any joins required by a
+// full-text or location search (see searchJoinBit and geoJoinBit).
+func listWhereBit(params *ListParams) (string, []interface{}, rest.RestError) {
+  searchBit, searchParams, restErr := searchJoinBit(params)
+  if restErr != nil {
+    return ``, nil, restErr
+  }
+  geoBit, geoParams := geoJoinBit(params)
+  whereBit := searchBit + geoBit + `WHERE 1=1 `
+  if !params.IncludeArchived {
+    whereBit += `AND o.archived_at IS NULL `
+  }
+  whereParams := append(append(make([]interface{}, 0), searchParams...), geoParams...)
+  if params.Search != `` && !params.FullText {
+    searchBit, searchParams, err := OrgsGeneralWhereGenerator(params.Search, whereParams)
+    if err != nil {
+      return ``, nil, rest.BadRequestError(`Could not process search.`, err)
+    }
+    whereBit += searchBit
+    whereParams = searchParams
+  }
+  filterBit, filterParams := params.Filters.whereBit()
+  whereBit += filterBit
+  whereParams = append(whereParams, filterParams...)
+  if params.Filter != `` {
+    filterBit, filterParams, err := OrgsFilterWhereGenerator(params.Filter, whereParams)
+    if err != nil {
+      return ``, nil, rest.BadRequestError(fmt.Sprintf(`Invalid filter: %s.`, err), err)
+    }
+    whereBit += filterBit
+    whereParams = filterParams
+  }
+
+  return whereBit, whereParams, nil
+}
+
+// listOrgsByCursor handles the keyset portion of a cursor mode list request.
+// We fetch one extra record to tell whether there is another page in the
+// direction of travel.
+func listOrgsByCursor(params *ListParams, whereBit string, whereParams []interface{}, totalCount int64, limit int64, ctx context.Context) (*OrgsPage, rest.RestError) {
+  var cursor *OrgCursor
+  if params.Cursor != `` {
+    var err error
+    if cursor, err = DecodeOrgCursor(params.Cursor); err != nil {
+      return nil, rest.BadRequestError(`Invalid cursor.`, err)
+    }
+    if cursor.Sort != params.Sort {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Cursor sort '%s' does not match requested sort '%s'.`, cursor.Sort, params.Sort), nil)
+    }
+  }
+
+  desc := orgsSortDesc[params.Sort]
+  backward := cursor != nil && cursor.Backward
+  if backward {
+    desc = !desc
+  }
+  if cursor != nil {
+    keysetBit, keysetParams := cursor.whereBit(desc)
+    whereBit += keysetBit
+    whereParams = append(whereParams, keysetParams...)
+  }
+
+  query := listOrgsSelect + whereBit + `ORDER BY ` + keysetOrder(desc) + `LIMIT ?`
+  orgs, restErr := queryOrgSummaries(query, append(whereParams, limit + 1), ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  more := int64(len(orgs)) > limit
+  if more {
+    orgs = orgs[:limit]
+  }
+  if backward {
+    for i, j := 0, len(orgs) - 1; i < j; i, j = i + 1, j - 1 {
+      orgs[i], orgs[j] = orgs[j], orgs[i]
+    }
+  }
+
+  page := &OrgsPage{Items: newListItems(orgs), TotalCount: totalCount, Limit: limit}
+  if len(orgs) > 0 {
+    // Going forward, there's a previous page whenever we started from a cursor
+    // and a next page if we found more. Going backward, it's the reverse.
+    hasNext, hasPrev := more, cursor != nil
+    if backward {
+      hasNext, hasPrev = true, more
+    }
+    if hasNext {
+      page.NextCursor = NewOrgCursor(params.Sort, orgs[len(orgs) - 1], false).Encode()
+    }
+    if hasPrev {
+      page.PrevCursor = NewOrgCursor(params.Sort, orgs[0], true).Encode()
+    }
+  }
+
+  return page, nil
+}
+
+// listOrgsAnnotated handles the retrieval portion of a full-text or 'near'
+// list request, which annotates each OrgListItem with the search results.
+func listOrgsAnnotated(params *ListParams, whereBit string, whereParams []interface{}, totalCount int64, limit int64, offset int64, ctx context.Context) (*OrgsPage, rest.RestError) {
+  columns, sort := ``, ``
+  var terms []string
+  if params.fullTextSearch() {
+    terms = ParseSearchQuery(params.Search)
+    columns += `, sd.relevance, sd.place `
+    sort += `sd.relevance DESC, `
+  }
+  if params.Near != nil {
+    columns += `, geo.distance `
+    sort += `geo.distance ASC, `
+  }
+  sort += `e.pub_id ASC `
+  if params.Sort != `` {
+    sort = OrgsSorts[params.Sort]
+  }
+
+  query := `SELECT ` + CommonOrgSummaryFields + columns + CommonOrgsFrom + whereBit + `ORDER BY ` + sort + `LIMIT ? OFFSET ?`
+  rows, err := sqldb.DB.QueryContext(ctx, query, append(whereParams, limit, offset)...)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve orgs.`, err)
+  }
+  defer rows.Close()
+
+  items := make([]*OrgListItem, 0)
+  for rows.Next() {
+    var item OrgListItem
+    var place nulls.String
+    o := &item.OrgSummary
+    fields := []interface{}{&o.PubId, &o.LastUpdated, &o.DisplayName, &o.Summary, &o.Phone, &o.Email, &o.Homepage, &o.LogoURL, &o.ArchivedAt, &o.ParentPubId, &o.Version}
+    if terms != nil {
+      fields = append(fields, &item.Relevance, &place)
+    }
+    if params.Near != nil {
+      fields = append(fields, &item.Distance)
+    }
+    if err := rows.Scan(fields...); err != nil {
+      return nil, rest.ServerError(`Problem reading org list.`, err)
+    }
+    if terms != nil {
+      item.Highlights = HighlightOrg(o, place.String, terms)
+    }
+    o.FormatOut()
+    items = append(items, &item)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, rest.ServerError(`Problem reading org list.`, err)
+  }
+
+  return &OrgsPage{Items: items, TotalCount: totalCount, Offset: offset, Limit: limit}, nil
+}
+
+func queryOrgSummaries(query string, params []interface{}, ctx context.Context) ([]*OrgSummary, rest.RestError) {
+  rows, err := sqldb.DB.QueryContext(ctx, query, params...)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve orgs.`, err)
+  }
+  defer rows.Close()
+
+  results, err := BuildOrgResults(rows)
+  if err != nil {
+    return nil, rest.ServerError(`Problem reading org list.`, err)
+  }
+  orgs := results.([]*OrgSummary)
+  for _, org := range orgs {
+    org.FormatOut()
+  }
+
+  return orgs, nil
+}
@@ -0,0 +1,294 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "log"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// Role describes a User's standing within an Org.
+type Role string
+
+const (
+  RoleOwner  Role = `owner`
+  RoleAdmin  Role = `admin`
+  RoleMember Role = `member`
+)
+
+// ParseRole validates a role name.
+func ParseRole(name string) (Role, error) {
+  switch role := Role(name); role {
+  case RoleOwner, RoleAdmin, RoleMember:
+    return role, nil
+  default:
+    return ``, fmt.Errorf(`unknown role '%s'`, name)
+  }
+}
+
+// Member associates a User with an Org under a Role. Users are identified by
+// their public ID alone; their auth ID is never exposed.
+type Member struct {
+  UserPubId nulls.String `json:"userPubId"`
+  Active    nulls.Bool   `json:"active"`
+  Role      Role         `json:"role"`
+}
+
+func ScanMember(row *sql.Rows) (*Member, error) {
+  var m Member
+
+  if err := row.Scan(&m.UserPubId, &m.Active, &m.Role); err != nil {
+    return nil, err
+  }
+
+  return &m, nil
+}
+
+// AddMember associates the User with the Org under the given Role. If the User
+// is already a member, their Role is updated. Referencing a non-existent Org
+// or User results in a rest.NotFoundError, and demoting the last owner of the
+// Org in a 409 Conflict rest.RestError (see RemoveMember).
+func AddMember(orgPubId string, userPubId string, role Role, ctx context.Context) (*Member, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not add org member. (txn error)", err)
+  }
+
+  member, restErr := AddMemberInTxn(orgPubId, userPubId, role, ctx, txn)
+  // txn already rolled back if in error, so we only need to commit if no error
+  if restErr == nil {
+    defer txn.Commit()
+  }
+
+  return member, restErr
+}
+
+// AddMemberInTxn adds (or updates) an Org member in the context of an
+// existing transaction. See AddMember.
+func AddMemberInTxn(orgPubId string, userPubId string, role Role, ctx context.Context, txn *sql.Tx) (*Member, rest.RestError) {
+  if _, err := ParseRole(string(role)); err != nil {
+    defer txn.Rollback()
+    return nil, rest.BadRequestError(`Invalid member role.`, err)
+  }
+  orgId, userId, restErr := getMemberIdsInTxn(orgPubId, userPubId, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if role != RoleOwner {
+    if restErr := checkRetainsOwnerInTxn(orgPubId, userPubId, ctx, txn); restErr != nil {
+      defer txn.Rollback()
+      return nil, restErr
+    }
+  }
+
+  if _, err := txn.Stmt(addMemberQuery).ExecContext(ctx, orgId, userId, role); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError(`Could not add org member.`, err)
+  }
+
+  return GetMemberInTxn(orgPubId, userPubId, ctx, txn)
+}
+
+// RemoveMember disassociates the User from the Org. Attempting to remove a
+// non-member results in a rest.NotFoundError. An Org must always have an
+// owner: either its own account or a member with the owner role. Attempting
+// to remove the last owner results in a 409 Conflict rest.RestError.
+func RemoveMember(orgPubId string, userPubId string, ctx context.Context) rest.RestError {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError("Could not remove org member. (txn error)", err)
+  }
+
+  restErr := RemoveMemberInTxn(orgPubId, userPubId, ctx, txn)
+  // txn already rolled back if in error, so we only need to commit if no error
+  if restErr == nil {
+    defer txn.Commit()
+  }
+
+  return restErr
+}
+
+// RemoveMemberInTxn removes an Org member in the context of an existing
+// transaction. See RemoveMember.
+func RemoveMemberInTxn(orgPubId string, userPubId string, ctx context.Context, txn *sql.Tx) rest.RestError {
+  if restErr := checkRetainsOwnerInTxn(orgPubId, userPubId, ctx, txn); restErr != nil {
+    defer txn.Rollback()
+    return restErr
+  }
+  res, err := txn.Stmt(removeMemberQuery).ExecContext(ctx, orgPubId, userPubId)
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not remove org member.`, err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not remove org member.`, err)
+  } else if count == 0 {
+    defer txn.Rollback()
+    return rest.NotFoundError(fmt.Sprintf(`User '%s' is not a member of org '%s'.`, userPubId, orgPubId), nil)
+  }
+
+  return nil
+}
+
+// GetMember retrieves a single Org membership. Attempting to retrieve a
+// non-existent membership results in a rest.NotFoundError.
+func GetMember(orgPubId string, userPubId string, ctx context.Context) (*Member, rest.RestError) {
+  return getMemberHelper(orgPubId, userPubId, ctx, nil)
+}
+
+// GetMemberInTxn retrieves a single Org membership in the context of an
+// existing transaction. See GetMember.
+func GetMemberInTxn(orgPubId string, userPubId string, ctx context.Context, txn *sql.Tx) (*Member, rest.RestError) {
+  return getMemberHelper(orgPubId, userPubId, ctx, txn)
+}
+
+func getMemberHelper(orgPubId string, userPubId string, ctx context.Context, txn *sql.Tx) (*Member, rest.RestError) {
+  stmt := getMemberQuery
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  rows, err := stmt.QueryContext(ctx, orgPubId, userPubId)
+  if err != nil {
+    return nil, rest.ServerError(`Error retrieving org member.`, err)
+  }
+  defer rows.Close()
+
+  if !rows.Next() {
+    return nil, rest.NotFoundError(fmt.Sprintf(`User '%s' is not a member of org '%s'.`, userPubId, orgPubId), nil)
+  }
+  member, err := ScanMember(rows)
+  if err != nil {
+    return nil, rest.ServerError(`Problem getting data for org member.`, err)
+  }
+
+  return member, nil
+}
+
+// ListMembers retrieves all members of the Org. Attempting to list the members
+// of a non-existent Org results in a rest.NotFoundError.
+func ListMembers(orgPubId string, ctx context.Context) ([]*Member, rest.RestError) {
+  if _, restErr := GetOrg(orgPubId, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  rows, err := listMembersQuery.QueryContext(ctx, orgPubId)
+  if err != nil {
+    return nil, rest.ServerError(`Error retrieving org members.`, err)
+  }
+  defer rows.Close()
+
+  members := make([]*Member, 0)
+  for rows.Next() {
+    member, err := ScanMember(rows)
+    if err != nil {
+      return nil, rest.ServerError(`Problem getting data for org members.`, err)
+    }
+    members = append(members, member)
+  }
+
+  return members, nil
+}
+
+func getMemberIdsInTxn(orgPubId string, userPubId string, ctx context.Context, txn *sql.Tx) (int64, int64, rest.RestError) {
+  var orgId, userId int64
+  if err := txn.Stmt(getOrgIdQuery).QueryRowContext(ctx, orgPubId).Scan(&orgId); err == sql.ErrNoRows {
+    return 0, 0, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, orgPubId), nil)
+  } else if err != nil {
+    return 0, 0, rest.ServerError(`Could not resolve org.`, err)
+  }
+  if err := txn.Stmt(getUserIdQuery).QueryRowContext(ctx, userPubId).Scan(&userId); err == sql.ErrNoRows {
+    return 0, 0, rest.NotFoundError(fmt.Sprintf(`User '%s' not found.`, userPubId), nil)
+  } else if err != nil {
+    return 0, 0, rest.ServerError(`Could not resolve user.`, err)
+  }
+
+  return orgId, userId, nil
+}
+
+// checkRetainsOwnerInTxn verifies that the Org would still have an owner were
+// the User to lose the owner role. The owner memberships are locked for the
+// remainder of the transaction so that concurrent changes cannot together
+// remove every owner.
+func checkRetainsOwnerInTxn(orgPubId string, userPubId string, ctx context.Context, txn *sql.Tx) rest.RestError {
+  rows, err := txn.Stmt(listOwnersQuery).QueryContext(ctx, orgPubId)
+  if err != nil {
+    return rest.ServerError(`Could not retrieve org owners.`, err)
+  }
+  isOwner, others := false, 0
+  for rows.Next() {
+    var ownerPubId string
+    if err := rows.Scan(&ownerPubId); err != nil {
+      rows.Close()
+      return rest.ServerError(`Problem reading org owners.`, err)
+    }
+    if strings.EqualFold(ownerPubId, userPubId) {
+      isOwner = true
+    } else {
+      others += 1
+    }
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return rest.ServerError(`Problem reading org owners.`, err)
+  }
+  if !isOwner || others > 0 {
+    return nil
+  }
+
+  var hasAccount bool
+  if err := txn.Stmt(orgHasAccountQuery).QueryRowContext(ctx, orgPubId).Scan(&hasAccount); err != nil {
+    return rest.ServerError(`Could not resolve org account.`, err)
+  }
+  if !hasAccount {
+    return conflictError(fmt.Sprintf(`User '%s' is the last owner of org '%s'.`, userPubId, orgPubId), nil)
+  }
+
+  return nil
+}
+
+const commonMemberGet = `SELECT ue.pub_id, u.active, m.role FROM org_members m JOIN entities oe ON m.org_id=oe.id JOIN users u ON m.user_id=u.id JOIN entities ue ON u.id=ue.id `
+const getMemberStatement = commonMemberGet + `WHERE oe.pub_id=? AND ue.pub_id=?`
+const listMembersStatement = commonMemberGet + `WHERE oe.pub_id=? ORDER BY ue.pub_id`
+const getOrgIdStatement = `SELECT o.id FROM orgs o JOIN entities e ON o.id=e.id WHERE e.pub_id=? AND o.archived_at IS NULL`
+const getUserIdStatement = `SELECT u.id FROM users u JOIN entities e ON u.id=e.id WHERE e.pub_id=?`
+const addMemberStatement = `INSERT INTO org_members (org_id, user_id, role) VALUES(?,?,?) ON DUPLICATE KEY UPDATE role=VALUES(role)`
+const listOwnersStatement = `SELECT ue.pub_id FROM org_members m JOIN entities oe ON m.org_id=oe.id JOIN entities ue ON m.user_id=ue.id WHERE oe.pub_id=? AND m.role='owner' FOR UPDATE`
+const orgHasAccountStatement = `SELECT u.auth_id IS NOT NULL FROM users u JOIN entities e ON u.id=e.id WHERE e.pub_id=?`
+const removeMemberStatement = `DELETE m FROM org_members m JOIN entities oe ON m.org_id=oe.id JOIN entities ue ON m.user_id=ue.id WHERE oe.pub_id=? AND ue.pub_id=?`
+var getMemberQuery, listMembersQuery, getOrgIdQuery, getUserIdQuery, addMemberQuery, listOwnersQuery, orgHasAccountQuery, removeMemberQuery *sql.Stmt
+func setupMembersDB(db *sql.DB) {
+  var err error
+  if getMemberQuery, err = db.Prepare(getMemberStatement); err != nil {
+    log.Fatalf("mysql: prepare get org member stmt: %v", err)
+  }
+  if listMembersQuery, err = db.Prepare(listMembersStatement); err != nil {
+    log.Fatalf("mysql: prepare list org members stmt: %v", err)
+  }
+  if getOrgIdQuery, err = db.Prepare(getOrgIdStatement); err != nil {
+    log.Fatalf("mysql: prepare get org ID stmt: %v", err)
+  }
+  if getUserIdQuery, err = db.Prepare(getUserIdStatement); err != nil {
+    log.Fatalf("mysql: prepare get user ID stmt: %v", err)
+  }
+  if addMemberQuery, err = db.Prepare(addMemberStatement); err != nil {
+    log.Fatalf("mysql: prepare add org member stmt: %v", err)
+  }
+  if listOwnersQuery, err = db.Prepare(listOwnersStatement); err != nil {
+    log.Fatalf("mysql: prepare list org owners stmt: %v", err)
+  }
+  if orgHasAccountQuery, err = db.Prepare(orgHasAccountStatement); err != nil {
+    log.Fatalf("mysql: prepare org has account stmt: %v", err)
+  }
+  if removeMemberQuery, err = db.Prepare(removeMemberStatement); err != nil {
+    log.Fatalf("mysql: prepare remove org member stmt: %v", err)
+  }
+}
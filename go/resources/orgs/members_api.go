@@ -0,0 +1,100 @@
+package orgs
+
+import (
+  "net/http"
+
+  "github.com/gorilla/mux"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/handlers"
+  "github.com/Liquid-Labs/catalyst-firewrap/go/fireauth"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// memberRequest is the payload for adding or updating a member.
+type memberRequest struct {
+  Role Role `json:"role"`
+}
+
+func listMembersHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    if _, restErr := authorizeRequest(w, r, authClient, ActionRead, pubID); restErr != nil {
+      return // response handled by authorizeRequest
+    }
+
+    members, restErr := ListMembers(pubID, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, members, `Org members retrieved.`, nil)
+  }
+}
+
+func putMemberHandler(w http.ResponseWriter, r *http.Request) {
+  var req *memberRequest = &memberRequest{}
+  if authClient, restErr := handlers.CheckAndExtract(w, r, req, `Member`); restErr != nil {
+    return // response handled by CheckAndExtract
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    userPubID := vars["userPubId"]
+    if restErr := authorizeMemberChange(w, r, authClient, pubID, userPubID, req.Role); restErr != nil {
+      return // response handled by authorizeMemberChange
+    }
+
+    member, restErr := AddMember(pubID, userPubID, req.Role, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, member, `Org member saved.`, nil)
+  }
+}
+
+func removeMemberHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    vars := mux.Vars(r)
+    pubID := vars["pubId"]
+    userPubID := vars["userPubId"]
+    if restErr := authorizeMemberChange(w, r, authClient, pubID, userPubID, ``); restErr != nil {
+      return // response handled by authorizeMemberChange
+    }
+
+    if restErr := RemoveMember(pubID, userPubID, r.Context()); restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, nil, `Org member removed.`, nil)
+  }
+}
+
+// authorizeMemberChange resolves the Principal making the request and checks
+// that they may make the membership change (see AuthorizeMemberChange). Any
+// error response is handled.
+func authorizeMemberChange(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient, pubID string, userPubID string, role Role) rest.RestError {
+  principal, restErr := PrincipalFromClient(authClient)
+  if restErr == nil {
+    restErr = AuthorizeMemberChange(principal, pubID, userPubID, role, r.Context())
+  }
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return restErr
+  }
+
+  return nil
+}
+
+func initMembersAPI(r *mux.Router) {
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/members/", listMembersHandler).Methods("GET")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/members/{userPubId:" + uuidRE + "}/", putMemberHandler).Methods("PUT")
+  r.HandleFunc("/orgs/{pubId:" + uuidRE + "}/members/{userPubId:" + uuidRE + "}/", removeMemberHandler).Methods("DELETE")
+}
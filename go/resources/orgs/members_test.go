@@ -0,0 +1,106 @@
+package orgs_test
+
+import (
+  "context"
+  "encoding/json"
+  "net/http"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+const someMemberID = `5B4E9F2C-6D2A-4C41-9A0E-3F5C2D7B8A11`
+const otherMemberID = `0C7D3E5A-8B1F-4E6D-A2C9-7F4B1D3E5A60`
+
+func TestParseRole(t *testing.T) {
+  for _, name := range []string{`owner`, `admin`, `member`} {
+    role, err := ParseRole(name)
+    assert.NoErrorf(t, err, `Unexpected error parsing role '%s'.`, name)
+    assert.Equal(t, Role(name), role, `Unexpected role.`)
+  }
+  _, err := ParseRole(`overlord`)
+  assert.Error(t, err, `Unexpected non-error parsing unknown role.`)
+}
+
+func testOrgMembers(t *testing.T) {
+  member, restErr := AddMember(someOrgID, someMemberID, RoleMember, context.Background())
+  require.NoError(t, restErr, `Unexpected error adding member.`)
+  assert.Equal(t, someMemberID, member.UserPubId.String, `Unexpected member public id.`)
+  assert.Equal(t, RoleMember, member.Role, `Unexpected member role.`)
+  data, err := json.Marshal(member)
+  require.NoError(t, err, `Unexpected error encoding member.`)
+  assert.NotContains(t, string(data), `hijklmn456`, `Member auth ID exposed.`)
+
+  member, restErr = AddMember(someOrgID, someMemberID, RoleAdmin, context.Background())
+  require.NoError(t, restErr, `Unexpected error updating member.`)
+  assert.Equal(t, RoleAdmin, member.Role, `Member role not updated.`)
+
+  members, restErr := ListMembers(someOrgID, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing members.`)
+  require.Len(t, members, 1, `Unexpected number of members.`)
+  assert.Equal(t, *member, *members[0], `Listed member does not match.`)
+
+  _, restErr = AddMember(someOrgID, someMemberID, Role(`overlord`), context.Background())
+  assert.Error(t, restErr, `Unexpected non-error adding member with bad role.`)
+  _, restErr = AddMember(someOrgID, `00000000-0000-4000-8000-000000000000`, RoleMember, context.Background())
+  assert.Error(t, restErr, `Unexpected non-error adding non-existent user.`)
+
+  require.NoError(t, RemoveMember(someOrgID, someMemberID, context.Background()), `Unexpected error removing member.`)
+  assert.Error(t, RemoveMember(someOrgID, someMemberID, context.Background()), `Unexpected non-error re-removing member.`)
+  _, restErr = GetMember(someOrgID, someMemberID, context.Background())
+  assert.Error(t, restErr, `Unexpected non-error getting removed member.`)
+}
+
+func testOrgMemberOwners(t *testing.T) {
+  ctx := context.Background()
+  // Unlike the test data Org, this Org has no account of its own, so it is
+  // owned only through its members.
+  owned := someOrg.Clone()
+  owned.SetDisplayName(`Owned Org`)
+  owned, restErr := CreateOrg(owned, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  pubId := owned.PubId.String
+  _, restErr = AddMember(pubId, someMemberID, RoleOwner, ctx)
+  require.NoError(t, restErr, `Unexpected error adding owner.`)
+  _, restErr = AddMember(pubId, otherMemberID, RoleAdmin, ctx)
+  require.NoError(t, restErr, `Unexpected error adding admin.`)
+
+  owner := NewPrincipal(`hijklmn456`, nil)
+  admin := NewPrincipal(`opqrstu789`, nil)
+  for _, change := range []struct {
+    userPubId string
+    role      Role
+    desc      string
+  }{
+    {otherMemberID, RoleOwner, `make themselves owner`},
+    {someMemberID, RoleAdmin, `demote owner`},
+    {someMemberID, ``, `remove owner`},
+  } {
+    restErr := AuthorizeMemberChange(admin, pubId, change.userPubId, change.role, ctx)
+    if assert.Errorf(t, restErr, `Admin unexpectedly allowed to %s.`, change.desc) {
+      assert.Equal(t, http.StatusForbidden, restErr.Code(), `Unexpected error code.`)
+    }
+  }
+  assert.NoError(t, AuthorizeMemberChange(admin, pubId, otherMemberID, RoleMember, ctx), `Admin unexpectedly denied managing non-owner.`)
+  assert.NoError(t, AuthorizeMemberChange(owner, pubId, otherMemberID, RoleOwner, ctx), `Owner unexpectedly denied granting ownership.`)
+  assert.NoError(t, AuthorizeMemberChange(owner, pubId, someMemberID, ``, ctx), `Owner unexpectedly denied removing owner.`)
+
+  _, restErr = AddMember(pubId, someMemberID, RoleAdmin, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error demoting last owner.`) {
+    assert.Equal(t, http.StatusConflict, restErr.Code(), `Unexpected error code.`)
+  }
+  restErr = RemoveMember(pubId, someMemberID, ctx)
+  if assert.Error(t, restErr, `Unexpected non-error removing last owner.`) {
+    assert.Equal(t, http.StatusConflict, restErr.Code(), `Unexpected error code.`)
+  }
+  _, restErr = AddMember(pubId, otherMemberID, RoleOwner, ctx)
+  require.NoError(t, restErr, `Unexpected error adding second owner.`)
+  assert.NoError(t, RemoveMember(pubId, someMemberID, ctx), `Unexpected error removing one of two owners.`)
+
+  // An Org with its own account always has that account as owner.
+  _, restErr = AddMember(someOrgID, someMemberID, RoleOwner, ctx)
+  require.NoError(t, restErr, `Unexpected error adding owner.`)
+  assert.NoError(t, RemoveMember(someOrgID, someMemberID, ctx), `Unexpected error removing owner of org with account.`)
+}
@@ -1,16 +1,12 @@
 package orgs
 
 import (
-  "regexp"
-
   "github.com/Liquid-Labs/catalyst-core-api/go/resources/users"
   "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
   "github.com/Liquid-Labs/catalyst-core-api/go/resources"
   "github.com/Liquid-Labs/go-nullable-mysql/nulls"
 )
 
-var phoneOutFormatter *regexp.Regexp = regexp.MustCompile(`^(\d{3})(\d{3})(\d{4})$`)
-
 // On summary, we don't include address. Note leaving it empty and using
 // 'omitempty' on the Org struct won't work because then Orgs without an address
 // will appear 'incomplete' in the front-end model and never resolve.
@@ -22,10 +18,19 @@ type OrgSummary struct {
   Phone         nulls.String `json:"phone,string"`
   Homepage      nulls.String `json:"homepage"`
   LogoURL       nulls.String `json:"logoURL"`
+  // ArchivedAt is the time (in Unix seconds) at which the Org was archived,
+  // or null for live Orgs.
+  ArchivedAt    nulls.Int64  `json:"archivedAt"`
+  // ParentPubId is the public ID of the parent Org, if any.
+  ParentPubId   nulls.String `json:"parentPubId"`
+  // Version is incremented by every write to the Org (see ETag).
+  Version       nulls.Int64  `json:"version"`
 }
 
+// FormatOut prepares the Org for output, formatting the phone number for the
+// DefaultPhoneRegion.
 func (o *OrgSummary) FormatOut() {
-  o.Phone.String = phoneOutFormatter.ReplaceAllString(o.Phone.String, `$1-$2-$3`)
+  o.Phone.String = FormatPhone(o.Phone.String, DefaultPhoneRegion)
 }
 
 func (o *OrgSummary) SetDisplayName(val string) {
@@ -52,6 +57,15 @@ func (o *OrgSummary) SetLogoURL(val string) {
   o.LogoURL = nulls.NewString(val)
 }
 
+// IsArchived is true if the Org has been archived (soft-deleted).
+func (o *OrgSummary) IsArchived() bool {
+  return o.ArchivedAt.Valid
+}
+
+func (o *OrgSummary) SetParentPubId(val string) {
+  o.ParentPubId = nulls.NewString(val)
+}
+
 func (o *OrgSummary) Clone() *OrgSummary {
   return &OrgSummary{
     *o.User.Clone(),
@@ -61,6 +75,9 @@ func (o *OrgSummary) Clone() *OrgSummary {
     o.Phone,
     o.Homepage,
     o.LogoURL,
+    o.ArchivedAt,
+    o.ParentPubId,
+    o.Version,
   }
 }
 
@@ -68,6 +85,9 @@ func (o *OrgSummary) Clone() *OrgSummary {
 type Org struct {
   OrgSummary
   Addresses     locations.Addresses  `json:"addresses"`
+  // Tags label the Org (see NormalizeTags). On update, nil tags are left as
+  // is while an empty list clears them.
+  Tags          []string             `json:"tags"`
   ChangeDesc    []string             `json:"changeDesc,omitempty"`
 }
 
@@ -78,9 +98,16 @@ func (o *Org) Clone() *Org {
     copy(newChangeDesc, o.ChangeDesc)
   }
 
+  var newTags []string = nil
+  if o.Tags != nil {
+    newTags = make([]string, len(o.Tags))
+    copy(newTags, o.Tags)
+  }
+
   return &Org{
     *o.OrgSummary.Clone(),
     *o.Addresses.Clone(),
+    newTags,
     newChangeDesc,
   }
 }
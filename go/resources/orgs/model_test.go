@@ -30,9 +30,12 @@ var trivialOrgSummary = &OrgSummary{
   nulls.NewString(`displayName`),
   nulls.NewString(`A great company.`),
   nulls.NewString(`foo@test.com`),
-  nulls.NewString(`555-555-9999`),
+  nulls.NewString(`202-555-9999`),
   nulls.NewString(`https://google.com`),
   nulls.NewString(`http://foo.com/logo`),
+  nulls.NewNullInt64(),
+  nulls.NewString(`parent`),
+  nulls.NewInt64(3),
 }
 
 func TestOrgSummaryClone(t *testing.T) {
@@ -48,6 +51,9 @@ func TestOrgSummaryClone(t *testing.T) {
   clone.SetPhone(`555-555-9997`)
   clone.SetHomepage(`https://bar.com`)
   clone.SetLogoURL(`http://bar.com/image`)
+  clone.ArchivedAt = nulls.NewInt64(5)
+  clone.SetParentPubId(`other parent`)
+  clone.Version = nulls.NewInt64(8)
 
   oReflection := reflect.ValueOf(trivialOrgSummary).Elem()
   cReflection := reflect.ValueOf(clone).Elem()
@@ -81,6 +87,7 @@ var trivialOrg = &Org{
       nulls.NewString(`label a`),
     },
   },
+  []string{`k`, `l`},
   []string{`h`, `i`},
 }
 
@@ -114,6 +121,7 @@ func TestOrgClone(t *testing.T) {
       nulls.NewString(`label b`),
     },
   }
+  clone.Tags = []string{`m`}
   clone.ChangeDesc = []string{`j`}
 
   assert.NotEqual(t, trivialOrg.Addresses, clone.Addresses, `Addresses unexpectedly equal.`)
@@ -144,7 +152,7 @@ func TestOrgClone(t *testing.T) {
 
 const jdDisplayName = "John Doe"
 const jdEmail = "johndoe@test.com"
-const jdPhone = "555-555-0000"
+const jdPhone = "202-555-0000"
 const jdActive = false
 
 var johnDoeJson string = `
@@ -174,3 +182,10 @@ func TestOrgFormatter(t *testing.T) {
   testP.FormatOut()
   assert.Equal(t, `555-555-5555`, testP.Phone.String)
 }
+
+func TestOrgIsArchived(t *testing.T) {
+  testO := trivialOrgSummary.Clone()
+  assert.False(t, testO.IsArchived(), `Unexpectedly archived.`)
+  testO.ArchivedAt = nulls.NewInt64(1554768000)
+  assert.True(t, testO.IsArchived(), `Unexpectedly not archived.`)
+}
@@ -0,0 +1,178 @@
+package orgs
+
+import (
+  "bytes"
+  "context"
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "sort"
+  "strconv"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// readOnlyPatchFields may not be changed via a patch.
+var readOnlyPatchFields = []string{`pubId`, `lastUpdated`, `archivedAt`}
+
+// MergePatch applies an RFC 7396 JSON Merge Patch document to a copy of the
+// Org. Fields absent from the patch are left untouched while fields set to
+// 'null' are cleared (become invalid nulls values).
+//
+// As an extension to RFC 7396, 'addresses' may be given as an object keyed by
+// array index rather than as a replacement array. Each indexed value is merge
+// patched onto the existing address, or removes the address if 'null'.
+// Indexes beyond the end of the current addresses append new addresses in
+// index order.
+func MergePatch(o *Org, patch []byte) (*Org, error) {
+  var patchDoc map[string]interface{}
+  if err := decodeJSON(patch, &patchDoc); err != nil {
+    return nil, fmt.Errorf(`patch must be a JSON object: %s`, err)
+  }
+  for _, field := range readOnlyPatchFields {
+    if _, ok := patchDoc[field]; ok {
+      return nil, fmt.Errorf(`field '%s' may not be patched`, field)
+    }
+  }
+
+  current, err := json.Marshal(o)
+  if err != nil {
+    return nil, err
+  }
+  var target map[string]interface{}
+  if err := decodeJSON(current, &target); err != nil {
+    return nil, err
+  }
+
+  if addressPatch, ok := patchDoc[`addresses`].(map[string]interface{}); ok {
+    addresses, _ := target[`addresses`].([]interface{})
+    if target[`addresses`], err = patchByIndex(addresses, addressPatch); err != nil {
+      return nil, err
+    }
+    delete(patchDoc, `addresses`)
+  }
+
+  patched, err := json.Marshal(mergePatch(target, patchDoc))
+  if err != nil {
+    return nil, err
+  }
+  newO := &Org{}
+  if err := json.Unmarshal(patched, newO); err != nil {
+    return nil, err
+  }
+  // The internal ID is not part of the JSON representation.
+  newO.Id = o.Id
+
+  return newO, nil
+}
+
+// decodeJSON decodes preserving numbers as json.Number so that int64 values
+// survive the round trip.
+func decodeJSON(data []byte, v interface{}) error {
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+  return decoder.Decode(v)
+}
+
+// mergePatch implements the RFC 7396 MergePatch algorithm.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+  patchObj, ok := patch.(map[string]interface{})
+  if !ok {
+    return patch
+  }
+  targetObj, ok := target.(map[string]interface{})
+  if !ok {
+    targetObj = make(map[string]interface{})
+  }
+  for key, value := range patchObj {
+    if value == nil {
+      delete(targetObj, key)
+    } else {
+      targetObj[key] = mergePatch(targetObj[key], value)
+    }
+  }
+
+  return targetObj
+}
+
+func patchByIndex(items []interface{}, patch map[string]interface{}) ([]interface{}, error) {
+  indexes := make([]int, 0, len(patch))
+  values := make(map[int]interface{}, len(patch))
+  for key, value := range patch {
+    idx, err := strconv.Atoi(key)
+    if err != nil || idx < 0 {
+      return nil, fmt.Errorf(`invalid address index '%s'`, key)
+    }
+    if idx >= len(items) && value == nil {
+      return nil, fmt.Errorf(`cannot remove non-existent address '%d'`, idx)
+    }
+    indexes = append(indexes, idx)
+    values[idx] = value
+  }
+  sort.Ints(indexes)
+
+  result := make([]interface{}, 0, len(items) + len(indexes))
+  for i, item := range items {
+    if value, ok := values[i]; !ok {
+      result = append(result, item)
+    } else if value != nil {
+      result = append(result, mergePatch(item, value))
+    } // else removed
+  }
+  for _, idx := range indexes {
+    if idx >= len(items) {
+      result = append(result, mergePatch(nil, values[idx]))
+    }
+  }
+
+  return result, nil
+}
+
+// PatchOrg applies a JSON Merge Patch to the canonical Org record. Attempting
+// to patch a non-existent Org results in a rest.NotFoundError, while an
+// invalid patch results in a rest.BadRequestError and a patch producing an
+// invalid Org in a ValidationError (see Org.Validate). If a valid version is
+// given, the patch is only applied if the stored Org is at that version. See
+// UpdateOrgInTxn.
+func PatchOrg(pubId string, patch []byte, version nulls.Int64, ctx context.Context) (*Org, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org record.", err)
+  }
+
+  newO, restErr := PatchOrgInTxn(pubId, patch, version, ctx, txn)
+  // txn already rolled back if in error, so we only need to commit if no error
+  if restErr == nil {
+    defer txn.Commit()
+  }
+
+  return newO, restErr
+}
+
+// PatchOrgInTxn applies a JSON Merge Patch to the canonical Org record within
+// an existing transaction. See PatchOrg.
+func PatchOrgInTxn(pubId string, patch []byte, version nulls.Int64, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  org, restErr := GetOrgInTxn(pubId, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+
+  newO, err := MergePatch(org, patch)
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.BadRequestError(`Could not apply patch.`, err)
+  }
+  if restErr := newO.Validate(ctx); restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if version.Valid {
+    newO.Version = version
+  }
+
+  return UpdateOrgInTxn(newO, ctx, txn)
+}
@@ -0,0 +1,50 @@
+package orgs_test
+
+import (
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestMergePatchFields(t *testing.T) {
+  patched, err := MergePatch(trivialOrg, []byte(`{"phone": "555-555-1234", "summary": null}`))
+  require.NoError(t, err, `Unexpected error applying patch.`)
+  assert.Equal(t, `555-555-1234`, patched.Phone.String, `Phone not patched.`)
+  assert.False(t, patched.Summary.Valid, `Summary not nulled.`)
+  assert.Equal(t, trivialOrg.DisplayName, patched.DisplayName, `Unpatched display name changed.`)
+  assert.Equal(t, trivialOrg.Email, patched.Email, `Unpatched email changed.`)
+  assert.Equal(t, trivialOrg.LegalID, patched.LegalID, `Unpatched legal ID changed.`)
+  assert.Equal(t, trivialOrg.Id, patched.Id, `Internal ID not preserved.`)
+  assert.Equal(t, trivialOrg.Addresses, patched.Addresses, `Unpatched addresses changed.`)
+  assert.Equal(t, `A great company.`, trivialOrg.Summary.String, `Original org modified.`)
+}
+
+func TestMergePatchAddressesByIndex(t *testing.T) {
+  patched, err := MergePatch(trivialOrg, []byte(`{"addresses": {"0": {"city": "Dayton"}, "1": {"address1": "1 Main St", "idx": 1}}}`))
+  require.NoError(t, err, `Unexpected error applying patch.`)
+  require.Len(t, patched.Addresses, 2, `Unexpected number of addresses.`)
+  assert.Equal(t, `Dayton`, patched.Addresses[0].City.String, `City not patched.`)
+  assert.Equal(t, trivialOrg.Addresses[0].Address1, patched.Addresses[0].Address1, `Unpatched address field changed.`)
+  assert.Equal(t, `1 Main St`, patched.Addresses[1].Address1.String, `Address not appended.`)
+
+  patched, err = MergePatch(trivialOrg, []byte(`{"addresses": {"0": null}}`))
+  require.NoError(t, err, `Unexpected error applying patch.`)
+  assert.Len(t, patched.Addresses, 0, `Address not removed.`)
+
+  patched, err = MergePatch(trivialOrg, []byte(`{"addresses": []}`))
+  require.NoError(t, err, `Unexpected error applying patch.`)
+  assert.Len(t, patched.Addresses, 0, `Addresses not replaced.`)
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+  _, err := MergePatch(trivialOrg, []byte(`["phone"]`))
+  assert.Error(t, err, `Unexpected non-error for non-object patch.`)
+  _, err = MergePatch(trivialOrg, []byte(`{"pubId": "b"}`))
+  assert.Error(t, err, `Unexpected non-error patching public ID.`)
+  _, err = MergePatch(trivialOrg, []byte(`{"addresses": {"foo": {}}}`))
+  assert.Error(t, err, `Unexpected non-error for bad address index.`)
+  _, err = MergePatch(trivialOrg, []byte(`{"addresses": {"3": null}}`))
+  assert.Error(t, err, `Unexpected non-error removing non-existent address.`)
+}
@@ -0,0 +1,145 @@
+package orgs
+
+import (
+  "context"
+  "fmt"
+  "net/http"
+  "strings"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+  "github.com/nyaruka/phonenumbers"
+  "golang.org/x/text/language"
+)
+
+// DefaultPhoneRegion is the region assumed for phone numbers given without an
+// international prefix when neither the Org's addresses nor the request
+// indicate a region (see phoneRegion). It is also the region for which phone
+// numbers are formatted on output: national format where the number belongs
+// to the region and international format otherwise.
+var DefaultPhoneRegion = `US`
+
+// addressPhoneRegions maps the state or province codes used in addresses to
+// their region. Addresses carry no country, so only the North American
+// regions can be told apart this way.
+var addressPhoneRegions = make(map[string]string)
+
+func init() {
+  for _, state := range strings.Fields(`AL AK AZ AR CA CO CT DE DC FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO
+      MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY AS GU MP PR VI`) {
+    addressPhoneRegions[state] = `US`
+  }
+  // 'CA' is California; Canadian addresses are known by their province.
+  for _, province := range strings.Fields(`AB BC MB NB NL NS NT NU ON PE QC SK YT`) {
+    addressPhoneRegions[province] = `CA`
+  }
+}
+
+type phoneRegionKey struct{}
+
+// WithPhoneRegion returns a context carrying the region of the request, which
+// is used to interpret phone numbers for Orgs whose addresses do not indicate
+// a region.
+func WithPhoneRegion(ctx context.Context, region string) context.Context {
+  return context.WithValue(ctx, phoneRegionKey{}, strings.ToUpper(region))
+}
+
+// requestPhoneRegion determines the region of the request from the first
+// 'Accept-Language' entry naming one; e.g., 'en-GB'.
+func requestPhoneRegion(r *http.Request) (string, bool) {
+  tags, _, err := language.ParseAcceptLanguage(r.Header.Get(`Accept-Language`))
+  if err != nil {
+    return ``, false
+  }
+  for _, tag := range tags {
+    if region, confidence := tag.Region(); confidence == language.Exact {
+      return region.String(), true
+    }
+  }
+  return ``, false
+}
+
+// withPhoneRegion sets the phone region (see WithPhoneRegion) from the
+// request, if it names one.
+func withPhoneRegion(r *http.Request) *http.Request {
+  if region, ok := requestPhoneRegion(r); ok {
+    return r.WithContext(WithPhoneRegion(r.Context(), region))
+  }
+  return r
+}
+
+// phoneRegion determines the region in which to interpret the Org's phone:
+// the region of its first address which indicates one, else the region of
+// the request, else the DefaultPhoneRegion.
+func phoneRegion(o *Org, ctx context.Context) string {
+  for _, address := range o.Addresses {
+    if address != nil && address.State.Valid {
+      if region, ok := addressPhoneRegions[strings.ToUpper(strings.TrimSpace(address.State.String))]; ok {
+        return region
+      }
+    }
+  }
+  if region, ok := ctx.Value(phoneRegionKey{}).(string); ok && region != `` {
+    return region
+  }
+  return DefaultPhoneRegion
+}
+
+// NormalizePhone parses and validates the phone number, which may carry an
+// extension, and renders it in the stored form: E.164 followed by 'x' and the
+// extension, if any. Numbers beginning with '+' are international; anything
+// else is interpreted according to the region's numbering plan.
+func NormalizePhone(raw string, region string) (string, error) {
+  if _, ok := phonenumbers.GetSupportedRegions()[strings.ToUpper(region)]; !ok {
+    return ``, fmt.Errorf(`unknown phone region '%s'; use international format`, region)
+  }
+  number, err := phonenumbers.Parse(raw, strings.ToUpper(region))
+  if err != nil {
+    return ``, fmt.Errorf(`'%s' is not a phone number`, raw)
+  }
+  if !phonenumbers.IsValidNumber(number) {
+    return ``, fmt.Errorf(`'%s' is not a valid phone number for %s; use international format for other regions`, raw, strings.ToUpper(region))
+  }
+
+  normalized := phonenumbers.Format(number, phonenumbers.E164)
+  if extension := number.GetExtension(); extension != `` {
+    normalized += `x` + extension
+  }
+  return normalized, nil
+}
+
+// FormatPhone renders a stored phone number for display in the region:
+// national format where the number shares the region's calling code and
+// international format otherwise. Numbers which cannot be parsed are returned
+// as is.
+func FormatPhone(stored string, region string) string {
+  number, err := phonenumbers.Parse(stored, strings.ToUpper(region))
+  if err != nil {
+    return stored
+  }
+  international := phonenumbers.Format(number, phonenumbers.INTERNATIONAL)
+  switch {
+  case int(number.GetCountryCode()) != phonenumbers.GetCountryCodeForRegion(strings.ToUpper(region)):
+    return international
+  case number.GetCountryCode() == 1:
+    // North American numbers keep the 'NNN-NNN-NNNN' form in which they have
+    // always been displayed, rather than '(NNN) NNN-NNNN'.
+    return strings.TrimPrefix(international, `+1 `)
+  default:
+    return phonenumbers.Format(number, phonenumbers.NATIONAL)
+  }
+}
+
+// storagePhone normalizes the Org phone for storage, resulting in a FieldError
+// if the phone is invalid. Blank phones are stored as null.
+func storagePhone(o *Org, ctx context.Context) (nulls.String, rest.RestError) {
+  if !present(o.Phone) {
+    return nulls.NewNullString(), nil
+  }
+  normalized, err := NormalizePhone(o.Phone.String, phoneRegion(o, ctx))
+  if err != nil {
+    return o.Phone, NewFieldError(`phone`, err.Error())
+  }
+
+  return nulls.NewString(normalized), nil
+}
@@ -0,0 +1,83 @@
+package orgs_test
+
+import (
+  "context"
+  "net/http"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestNormalizePhone(t *testing.T) {
+  valid := map[string]string{
+    `202-555-1111`: `+12025551111`,
+    `(202) 555-1111`: `+12025551111`,
+    `1 202 555 1111`: `+12025551111`,
+    `+1 202.555.1111`: `+12025551111`,
+    `202-555-1111 ext. 42`: `+12025551111x42`,
+    `202-555-1111 x42`: `+12025551111x42`,
+    `+12025551111x42`: `+12025551111x42`,
+    `+44 20 7946 0958`: `+442079460958`,
+    `011 44 20 7946 0958`: `+442079460958`,
+    `+7 495 123 4567`: `+74951234567`,
+  }
+  for raw, expected := range valid {
+    normalized, err := NormalizePhone(raw, `US`)
+    if assert.NoErrorf(t, err, `Unexpected error normalizing '%s'.`, raw) {
+      assert.Equalf(t, expected, normalized, `Unexpected normalization of '%s'.`, raw)
+    }
+  }
+
+  normalized, err := NormalizePhone(`020 7946 0958`, `GB`)
+  require.NoError(t, err, `Unexpected error normalizing national GB number.`)
+  assert.Equal(t, `+442079460958`, normalized, `Trunk prefix not removed.`)
+
+  invalid := []string{``, `555-1111`, `202-155-1111`, `020 7946 0958`, `555-CALL-NOW`, `+1 202 555 11112`, `+44 20 79`, `+0123456789`}
+  for _, raw := range invalid {
+    _, err := NormalizePhone(raw, `US`)
+    assert.Errorf(t, err, `Unexpected non-error normalizing '%s'.`, raw)
+  }
+
+  _, err = NormalizePhone(`202-555-1111`, `XX`)
+  assert.Error(t, err, `Unexpected non-error for unknown region.`)
+}
+
+func TestFormatPhone(t *testing.T) {
+  assert.Equal(t, `202-555-1111`, FormatPhone(`+12025551111`, `US`), `Unexpected domestic format.`)
+  assert.Equal(t, `202-555-1111 ext. 42`, FormatPhone(`+12025551111x42`, `US`), `Unexpected extension format.`)
+  assert.Equal(t, `+1 202-555-1111`, FormatPhone(`+12025551111`, `GB`), `Unexpected international format.`)
+  assert.Equal(t, `+44 20 7946 0958`, FormatPhone(`+442079460958`, `US`), `Unexpected international format.`)
+  assert.Equal(t, `020 7946 0958`, FormatPhone(`+442079460958`, `GB`), `Unexpected national format.`)
+  assert.Equal(t, `202-555-1111`, FormatPhone(`2025551111`, `US`), `Unexpected format for legacy number.`)
+  assert.Equal(t, `bad`, FormatPhone(`bad`, `US`), `Unparsable number not returned as is.`)
+}
+
+func testOrgPhone(t *testing.T) {
+  ctx := context.Background()
+  org, restErr := GetOrg(someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error getting Org.`)
+
+  org.SetPhone(`+44 20 7946 0958 ext 7`)
+  updated, restErr := UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating international phone.`)
+  assert.Equal(t, `+44 20 7946 0958 ext. 7`, updated.Phone.String, `Unexpected formatted phone.`)
+
+  updated.SetPhone(`555-1111`)
+  _, restErr = UpdateOrg(updated, ctx)
+  require.Error(t, restErr, `Unexpected non-error updating with invalid phone.`)
+  assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  fieldErr, ok := restErr.(*FieldError)
+  require.True(t, ok, `Expected a FieldError.`)
+  assert.Equal(t, `phone`, fieldErr.Field, `Unexpected error field.`)
+
+  // National numbers are read in the region of the request, absent an address
+  // indicating one.
+  updated.SetPhone(`020 7946 0958`)
+  _, restErr = UpdateOrg(updated, ctx)
+  assert.Error(t, restErr, `Unexpected non-error updating with foreign national phone.`)
+  updated, restErr = UpdateOrg(updated, WithPhoneRegion(ctx, `GB`))
+  require.NoError(t, restErr, `Unexpected error updating phone in request region.`)
+  assert.Equal(t, `+44 20 7946 0958`, updated.Phone.String, `Unexpected formatted phone.`)
+}
@@ -0,0 +1,241 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "html"
+  "log"
+  "strings"
+  "unicode"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// MaxSearchTerms caps the number of terms considered in a full-text search.
+const MaxSearchTerms = 16
+
+// isSearchRune is true for the characters making up a search term. Anything
+// else separates terms, as with the MySQL full-text parser.
+func isSearchRune(r rune) bool {
+  return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// ParseSearchQuery splits a full-text search query into distinct, lower case
+// terms. Punctuation, including the MySQL boolean mode operators, separates
+// terms and is otherwise ignored.
+func ParseSearchQuery(query string) []string {
+  terms := make([]string, 0)
+  seen := make(map[string]bool)
+  for _, term := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool { return !isSearchRune(r) }) {
+    if !seen[term] && len(terms) < MaxSearchTerms {
+      seen[term] = true
+      terms = append(terms, term)
+    }
+  }
+
+  return terms
+}
+
+// booleanQuery renders the terms as a MySQL boolean mode query matching words
+// beginning with each term. When required is set, every term must match.
+func booleanQuery(terms []string, required bool) string {
+  query := make([]string, len(terms))
+  for i, term := range terms {
+    query[i] = term + `*`
+    if required {
+      query[i] = `+` + query[i]
+    }
+  }
+
+  return strings.Join(query, ` `)
+}
+
+// searchJoinBit generates a join limiting the Orgs to those matching every
+// term of the list parameters' full-text search. The join, aliased 'sd',
+// provides the relevance of each Org, with matches in the display name
+// counting for more, and the places indexed for it. The search is served by
+// the SearchIndex, if one is configured.
+func searchJoinBit(params *ListParams) (string, []interface{}, rest.RestError) {
+  if !params.fullTextSearch() {
+    return ``, nil, nil
+  }
+  terms := ParseSearchQuery(params.Search)
+  if len(terms) == 0 {
+    return ``, nil, rest.BadRequestError(`Search has no searchable terms.`, nil)
+  }
+  if searchIndex != nil {
+    return indexJoinBit(terms, params.IncludeArchived)
+  }
+  strict, loose := booleanQuery(terms, true), booleanQuery(terms, false)
+
+  return `JOIN (SELECT org_id, place, MATCH(name, summary, contact, place) AGAINST(? IN BOOLEAN MODE) + MATCH(name) AGAINST(? IN BOOLEAN MODE) AS relevance FROM org_search WHERE MATCH(name, summary, contact, place) AGAINST(? IN BOOLEAN MODE)) sd ON o.id=sd.org_id `,
+    []interface{}{strict, loose, strict}, nil
+}
+
+// HighlightStart and HighlightEnd mark the matched words in highlighted
+// snippets.
+const HighlightStart = `<em>`
+const HighlightEnd = `</em>`
+
+// SnippetRadius is the number of characters of context kept on either side
+// of the first match in a highlighted snippet.
+var SnippetRadius = 40
+
+// Highlight returns a snippet of the text around the words beginning with
+// any of the terms, which are marked with HighlightStart and HighlightEnd, or
+// the empty string if nothing matches. The text is HTML escaped, so the
+// snippet may be displayed as is.
+func Highlight(text string, terms []string) string {
+  runes := []rune(text)
+  type span struct{ start, end int }
+  matches := make([]span, 0)
+  for i := 0; i < len(runes); {
+    if !isSearchRune(runes[i]) {
+      i += 1
+      continue
+    }
+    end := i
+    for end < len(runes) && isSearchRune(runes[end]) {
+      end += 1
+    }
+    word := strings.ToLower(string(runes[i:end]))
+    for _, term := range terms {
+      if strings.HasPrefix(word, term) {
+        matches = append(matches, span{i, end})
+        break
+      }
+    }
+    i = end
+  }
+  if len(matches) == 0 {
+    return ``
+  }
+
+  // Trim to whole words around the first match.
+  start, end := matches[0].start - SnippetRadius, matches[0].end + SnippetRadius
+  if start <= 0 {
+    start = 0
+  } else {
+    for start < matches[0].start && !unicode.IsSpace(runes[start - 1]) {
+      start += 1
+    }
+  }
+  if end >= len(runes) {
+    end = len(runes)
+  } else {
+    for end > matches[0].end && !unicode.IsSpace(runes[end]) {
+      end -= 1
+    }
+  }
+
+  var snippet strings.Builder
+  if start > 0 {
+    snippet.WriteString(`…`)
+  }
+  at := start
+  for _, match := range matches {
+    if match.end > end {
+      break
+    }
+    snippet.WriteString(html.EscapeString(string(runes[at:match.start])))
+    snippet.WriteString(HighlightStart)
+    snippet.WriteString(html.EscapeString(string(runes[match.start:match.end])))
+    snippet.WriteString(HighlightEnd)
+    at = match.end
+  }
+  snippet.WriteString(html.EscapeString(strings.TrimRightFunc(string(runes[at:end]), unicode.IsSpace)))
+  if end < len(runes) {
+    snippet.WriteString(`…`)
+  }
+
+  return snippet.String()
+}
+
+// HighlightOrg highlights the terms in the searched OrgSummary fields and the
+// places (see searchPlace), keyed by field. Fields without a match are
+// omitted.
+func HighlightOrg(o *OrgSummary, place string, terms []string) map[string]string {
+  highlights := make(map[string]string)
+  fields := map[string]string{
+    `displayName`: o.DisplayName.String,
+    `summary`: o.Summary.String,
+    `email`: o.Email.String,
+    `homepage`: o.Homepage.String,
+    `address`: place,
+  }
+  for field, text := range fields {
+    if snippet := Highlight(text, terms); snippet != `` {
+      highlights[field] = snippet
+    }
+  }
+
+  return highlights
+}
+
+// searchPlace renders the distinct cities and states of the Org's addresses
+// for indexing, in the same form as searchDocFields.
+func searchPlace(o *Org) string {
+  places := make([]string, 0)
+  seen := make(map[string]bool)
+  for _, address := range o.Addresses {
+    place := strings.TrimSpace(address.City.String + ` ` + address.State.String)
+    if place != `` && !seen[place] {
+      seen[place] = true
+      places = append(places, place)
+    }
+  }
+
+  return strings.Join(places, ` `)
+}
+
+// writeSearchDocInTxn updates the full-text search document for the Org as
+// written as part of the transaction, rolling back the transaction on
+// failure.
+func writeSearchDocInTxn(o *Org, ctx context.Context, txn *sql.Tx) rest.RestError {
+  doc := NewSearchDoc(o)
+  if _, err := txn.Stmt(writeSearchDocQuery).ExecContext(ctx, o.Id, doc.Name, doc.Summary, doc.Contact, doc.Place); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not update org search document.`, err)
+  }
+
+  return nil
+}
+
+// BackfillSearchDocs generates the full-text search documents for the Orgs
+// without any, such as those written before full-text search was available.
+// This should be run at startup so that every Org can be found.
+func BackfillSearchDocs(ctx context.Context) rest.RestError {
+  if _, err := sqldb.DB.ExecContext(ctx, backfillSearchDocsStatement); err != nil {
+    return rest.ServerError(`Could not backfill org search documents.`, err)
+  }
+
+  return nil
+}
+
+// RebuildSearchDocs regenerates the full-text search documents for every Org
+// from the Org records. Documents are maintained as Orgs are written, and
+// missing documents are generated by BackfillSearchDocs, so this is only
+// needed where Orgs have since been changed directly in the database.
+func RebuildSearchDocs(ctx context.Context) rest.RestError {
+  if _, err := sqldb.DB.ExecContext(ctx, rebuildSearchDocsStatement); err != nil {
+    return rest.ServerError(`Could not rebuild org search documents.`, err)
+  }
+
+  return nil
+}
+
+const writeSearchDocStatement = `INSERT INTO org_search (org_id, name, summary, contact, place) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE name=VALUES(name), summary=VALUES(summary), contact=VALUES(contact), place=VALUES(place)`
+// searchDocFields selects the SearchDoc text, less the public ID, for an Org.
+const searchDocFields = `o.display_name, o.summary, CONCAT_WS(' ', o.email, o.homepage), (SELECT GROUP_CONCAT(DISTINCT CONCAT_WS(' ', loc.city, loc.state) SEPARATOR ' ') FROM entity_addresses ea JOIN locations loc ON ea.location_id=loc.id WHERE ea.entity_id=o.id AND ea.idx >= 0)`
+const rebuildSearchDocsStatement = `INSERT INTO org_search (org_id, name, summary, contact, place) SELECT o.id, ` + searchDocFields + ` FROM orgs o ON DUPLICATE KEY UPDATE name=VALUES(name), summary=VALUES(summary), contact=VALUES(contact), place=VALUES(place)`
+// Should an Org be written as the backfill runs, its own document stands.
+const backfillSearchDocsStatement = `INSERT INTO org_search (org_id, name, summary, contact, place) SELECT o.id, ` + searchDocFields + ` FROM orgs o WHERE NOT EXISTS (SELECT 1 FROM org_search s WHERE s.org_id=o.id) ON DUPLICATE KEY UPDATE org_id=org_search.org_id`
+var writeSearchDocQuery *sql.Stmt
+
+func setupSearchDB(db *sql.DB) {
+  var err error
+  if writeSearchDocQuery, err = db.Prepare(writeSearchDocStatement); err != nil {
+    log.Fatalf("mysql: prepare write search doc stmt: %v", err)
+  }
+}
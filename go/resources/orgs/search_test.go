@@ -0,0 +1,70 @@
+package orgs_test
+
+import (
+  "context"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+  assert.Equal(t, []string{`acme`, `widgets`, `ohio`}, ParseSearchQuery(`  Acme "widgets" +Ohio* acme`), `Unexpected terms.`)
+  assert.Equal(t, []string{`jane`, `test`, `com`}, ParseSearchQuery(`jane@test.com`), `Unexpected email terms.`)
+  assert.Empty(t, ParseSearchQuery(`+-<>()~*"@`), `Unexpected terms for operators only.`)
+}
+
+func TestHighlight(t *testing.T) {
+  assert.Equal(t, `<em>Acme</em> <em>Widgets</em> Co.`, Highlight(`Acme Widgets Co.`, []string{`acm`, `widget`}), `Unexpected highlight.`)
+  assert.Equal(t, `janedoe@<em>test</em>.com`, Highlight(`janedoe@test.com`, []string{`test`}), `Unexpected email highlight.`)
+  assert.Equal(t, `&lt;b&gt; <em>Bold</em>`, Highlight(`<b> Bold`, []string{`bold`}), `Highlight not escaped.`)
+  assert.Equal(t, ``, Highlight(`Acme Widgets Co.`, []string{`gadget`}), `Unexpected highlight without a match.`)
+
+  long := strings.Repeat(`filler `, 20) + `needle` + strings.Repeat(` filler`, 20)
+  snippet := Highlight(long, []string{`needle`})
+  assert.True(t, strings.HasPrefix(snippet, `…filler `), `Expected leading ellipsis on whole word.`)
+  assert.True(t, strings.HasSuffix(snippet, ` filler…`), `Expected trailing ellipsis on whole word.`)
+  assert.Contains(t, snippet, `<em>needle</em>`, `Match not highlighted in snippet.`)
+  assert.True(t, len(snippet) < len(long), `Snippet not trimmed.`)
+}
+
+func testOrgSearchSeeded(t *testing.T) {
+  page, restErr := ListOrgs(&ListParams{Search: `builders`, FullText: true}, context.Background())
+  require.NoError(t, restErr, `Unexpected error searching orgs.`)
+  require.Len(t, page.Items, 1, `Seeded org not backfilled.`)
+  assert.Equal(t, someOrgID, page.Items[0].PubId.String, `Unexpected match.`)
+}
+
+func testOrgFullTextSearch(t *testing.T) {
+  ctx := context.Background()
+  require.NoError(t, RebuildSearchDocs(ctx), `Unexpected error rebuilding search documents.`)
+
+  named := someOrg.Clone()
+  named.SetDisplayName(`Zanzibar Quokka Outfitters`)
+  named.SetSummary(`Outfitters for the discerning traveler.`)
+  named, restErr := CreateOrg(named, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  described := someOrg.Clone()
+  described.SetDisplayName(`Described Org`)
+  described.SetSummary(`We supply Zanzibar quokka enthusiasts.`)
+  described, restErr = CreateOrg(described, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+
+  page, restErr := ListOrgs(&ListParams{Search: `zanzib quokk`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching orgs.`)
+  require.Len(t, page.Items, 2, `Unexpected number of matches.`)
+  assert.Equal(t, named.PubId.String, page.Items[0].PubId.String, `Name match not ranked first.`)
+  assert.Equal(t, described.PubId.String, page.Items[1].PubId.String, `Unexpected second match.`)
+  assert.True(t, page.Items[0].Relevance.Float64 > page.Items[1].Relevance.Float64, `Unexpected relevance order.`)
+  assert.Equal(t, `<em>Zanzibar</em> <em>Quokka</em> Outfitters`, page.Items[0].Highlights[`displayName`], `Unexpected name highlight.`)
+  assert.Equal(t, `We supply <em>Zanzibar</em> <em>quokka</em> enthusiasts.`, page.Items[1].Highlights[`summary`], `Unexpected summary highlight.`)
+
+  page, restErr = ListOrgs(&ListParams{Search: `zanzibar outfitters`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching orgs.`)
+  require.Len(t, page.Items, 1, `Expected all terms to be required.`)
+
+  _, restErr = ListOrgs(&ListParams{Search: `"*"`, FullText: true}, ctx)
+  assert.Error(t, restErr, `Unexpected non-error for search without terms.`)
+}
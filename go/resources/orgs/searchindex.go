@@ -0,0 +1,232 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "encoding/json"
+  "log"
+  "strings"
+  "time"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// SearchDoc is the text of an Org indexed for full-text search; the same
+// text held in the 'org_search' table.
+type SearchDoc struct {
+  PubId   string
+  Name    string
+  Summary string
+  // Contact is the email and homepage.
+  Contact string
+  // Place is the cities and states of the addresses (see searchPlace).
+  Place   string
+  // Archived is set for archived Orgs, which are only matched on request.
+  Archived bool
+}
+
+// NewSearchDoc extracts the indexed text from the Org.
+func NewSearchDoc(o *Org) *SearchDoc {
+  return &SearchDoc{
+    PubId: o.PubId.String,
+    Name: o.DisplayName.String,
+    Summary: o.Summary.String,
+    Contact: strings.TrimSpace(o.Email.String + ` ` + o.Homepage.String),
+    Place: searchPlace(o),
+    Archived: o.IsArchived(),
+  }
+}
+
+// SearchHit is an Org matching a full-text search, along with its score and
+// the indexed Place, for highlighting.
+type SearchHit struct {
+  PubId string
+  Score float64
+  Place string
+}
+
+// SearchIndex is a full-text index of the Orgs which, once configured with
+// SetSearchIndex, serves full-text list requests in place of the database.
+// Archived Orgs are kept in the index, flagged as such. Implementations must
+// be safe for concurrent use.
+type SearchIndex interface {
+  // Search returns the hits for the Orgs with a word beginning with each of
+  // the terms, best match first. Archived Orgs are only included on request.
+  Search(terms []string, includeArchived bool) ([]*SearchHit, error)
+  // Update adds or replaces the docs, recording the ID of the last outbox
+  // event reflected in the index.
+  Update(docs []*SearchDoc, lastEventId int64) error
+  // LastEventId returns the event ID recorded by the last Update, or 0 for a
+  // new or reset index.
+  LastEventId() int64
+  // Reset empties the index.
+  Reset() error
+}
+
+// SearchIndexPathEnv names the environment variable giving the location of
+// the DiskIndex file. When set, the service uses a DiskIndex for full-text
+// search.
+const SearchIndexPathEnv = `ORGS_SEARCH_INDEX`
+
+var searchIndex SearchIndex
+
+// SetSearchIndex configures the SearchIndex used for full-text search. A nil
+// index, the default, searches the database.
+func SetSearchIndex(index SearchIndex) {
+  searchIndex = index
+}
+
+// indexHit is a SearchHit as passed to the database by indexJoinBit.
+type indexHit struct {
+  PubId string  `json:"p"`
+  Score float64 `json:"r"`
+  Place string  `json:"l"`
+}
+
+// MaxIndexHits limits the SearchIndex hits passed to the database for a
+// search. Each hit adds its public ID, score, and place, up to a couple of
+// hundred bytes, to the query, which must fit MySQL's 'max_allowed_packet';
+// the default limit keeps the query to a few megabytes.
+var MaxIndexHits = 10000
+
+// indexJoinBit generates the equivalent of the searchJoinBit join from the
+// SearchIndex hits, which are passed to the database as a single JSON array.
+// Only the best MaxIndexHits hits are passed, so where a search matches more
+// Orgs (as a short prefix may), the list filters, counts, and facets apply to
+// the best matches alone. Searching the database has no such limit.
+func indexJoinBit(terms []string, includeArchived bool) (string, []interface{}, rest.RestError) {
+  hits, err := searchIndex.Search(terms, includeArchived)
+  if err != nil {
+    return ``, nil, rest.ServerError(`Could not search org index.`, err)
+  }
+  if len(hits) > MaxIndexHits {
+    hits = hits[:MaxIndexHits]
+  }
+  rows := make([]indexHit, len(hits))
+  for i, hit := range hits {
+    rows[i] = indexHit{hit.PubId, hit.Score, hit.Place}
+  }
+  data, err := json.Marshal(rows)
+  if err != nil {
+    return ``, nil, rest.ServerError(`Could not search org index.`, err)
+  }
+
+  // The public IDs are as indexed, so compare them exactly.
+  return `JOIN JSON_TABLE(?, '$[*]' COLUMNS (pub_id VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin PATH '$.p', relevance DOUBLE PATH '$.r', place VARCHAR(1024) PATH '$.l')) sd ON e.pub_id=sd.pub_id `,
+    []interface{}{string(data)}, nil
+}
+
+// SearchIndexer keeps a SearchIndex in step with the database by tailing the
+// outbox, so Orgs written by CreateOrgInTxn, UpdateOrgInTxn, and the like
+// are indexed shortly after the transaction commits. As with the
+// EventStream, each process sees every event.
+type SearchIndexer struct {
+  // Interval is the time between polls of the outbox.
+  Interval time.Duration
+  Index    SearchIndex
+}
+
+// NewSearchIndexer creates a SearchIndexer for the index, polling every
+// second.
+func NewSearchIndexer(index SearchIndex) *SearchIndexer {
+  return &SearchIndexer{Interval: time.Second, Index: index}
+}
+
+// Sync applies the events committed to the outbox since the index was last
+// updated (see EventGapWindow), returning the number applied. An index last
+// updated before the events pruned from the outbox (see EventRetention) is
+// rebuilt instead.
+func (s *SearchIndexer) Sync(ctx context.Context) (int, error) {
+  applied := 0
+  for {
+    fromId := s.Index.LastEventId()
+    events, lastId, err := ReplayEvents(fromId, MaxListLimit, ctx)
+    if err != nil {
+      return applied, err
+    }
+    // Checked after reading, as the pruning may have raced the read.
+    if prunedId, err := prunedEventId(ctx); err != nil {
+      return applied, err
+    } else if fromId < prunedId {
+      log.Printf("Org search index predates the pruned org events; rebuilding.")
+      return applied, RebuildSearchIndex(s.Index, ctx)
+    }
+    if lastId == fromId {
+      return applied, nil
+    }
+    // Only the latest state of each Org matters.
+    latest := make(map[string]*Event)
+    for _, e := range events {
+      latest[e.OrgPubId] = e
+    }
+    docs := make([]*SearchDoc, 0, len(latest))
+    for _, e := range latest {
+      docs = append(docs, NewSearchDoc(e.Org))
+    }
+    if err := s.Index.Update(docs, lastId); err != nil {
+      return applied, err
+    }
+    applied += len(events)
+  }
+}
+
+// Run keeps the index in step until the context is done. A new index should
+// first be built with RebuildSearchIndex.
+func (s *SearchIndexer) Run(ctx context.Context) {
+  ticker := time.NewTicker(s.Interval)
+  defer ticker.Stop()
+  for {
+    if _, err := s.Sync(ctx); err != nil {
+      log.Printf("Could not sync org search index: %s", err)
+    }
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// RebuildSearchIndex resets the index and loads every Org from the database.
+// Events raised while the rebuild runs are picked up by the next SearchIndexer
+// Sync.
+func RebuildSearchIndex(index SearchIndex, ctx context.Context) error {
+  lastId, err := eventHorizon(ctx)
+  if err != nil {
+    return err
+  }
+  rows, err := indexDocsQuery.QueryContext(ctx)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  docs := make([]*SearchDoc, 0)
+  for rows.Next() {
+    var doc SearchDoc
+    var name, summary, contact, place sql.NullString
+    if err := rows.Scan(&doc.PubId, &name, &summary, &contact, &place, &doc.Archived); err != nil {
+      return err
+    }
+    doc.Name, doc.Summary, doc.Contact, doc.Place = name.String, summary.String, contact.String, place.String
+    docs = append(docs, &doc)
+  }
+  if err := rows.Err(); err != nil {
+    return err
+  }
+  if err := index.Reset(); err != nil {
+    return err
+  }
+
+  return index.Update(docs, lastId)
+}
+
+const indexDocsStatement = `SELECT e.pub_id, ` + searchDocFields + `, o.archived_at IS NOT NULL FROM orgs o JOIN entities e ON o.id=e.id`
+var indexDocsQuery *sql.Stmt
+
+func setupSearchIndexDB(db *sql.DB) {
+  var err error
+  if indexDocsQuery, err = db.Prepare(indexDocsStatement); err != nil {
+    log.Fatalf("mysql: prepare index docs stmt: %v", err)
+  }
+}
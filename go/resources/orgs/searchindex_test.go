@@ -0,0 +1,88 @@
+package orgs_test
+
+import (
+  "context"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func testOrgSearchIndex(t *testing.T) {
+  ctx := context.Background()
+  dir, err := ioutil.TempDir(``, `orgs-index`)
+  require.NoError(t, err, `Could not create index directory.`)
+  defer os.RemoveAll(dir)
+  index, err := OpenDiskIndex(filepath.Join(dir, `orgs.idx`))
+  require.NoError(t, err, `Unexpected error opening index.`)
+
+  indexed := someOrg.Clone()
+  indexed.SetDisplayName(`Xylophonic Wombat Supply`)
+  indexed, restErr := CreateOrg(indexed, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  require.NoError(t, RebuildSearchIndex(index, ctx), `Unexpected error rebuilding index.`)
+  SetSearchIndex(index)
+  defer SetSearchIndex(nil)
+
+  page, restErr := ListOrgs(&ListParams{Search: `xylophon womb`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  require.Len(t, page.Items, 1, `Rebuilt index did not find org.`)
+  assert.Equal(t, indexed.PubId.String, page.Items[0].PubId.String, `Unexpected match.`)
+  assert.True(t, page.Items[0].Relevance.Valid, `Expected relevance from index.`)
+  assert.Equal(t, `<em>Xylophonic</em> <em>Wombat</em> Supply`, page.Items[0].Highlights[`displayName`], `Unexpected highlight.`)
+
+  indexed.SetDisplayName(`Marimba Wombat Supply`)
+  indexed.Version = nulls.NewNullInt64()
+  _, restErr = UpdateOrg(indexed, ctx)
+  require.NoError(t, restErr, `Unexpected error updating org.`)
+  applied, err := NewSearchIndexer(index).Sync(ctx)
+  require.NoError(t, err, `Unexpected error syncing index.`)
+  assert.True(t, applied > 0, `Expected events to be applied.`)
+
+  page, restErr = ListOrgs(&ListParams{Search: `xylophon`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  assert.Len(t, page.Items, 0, `Stale name still indexed.`)
+  page, restErr = ListOrgs(&ListParams{Search: `marimba`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  assert.Len(t, page.Items, 1, `Updated name not indexed.`)
+
+  _, restErr = ArchiveOrg(indexed.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error archiving org.`)
+  _, err = NewSearchIndexer(index).Sync(ctx)
+  require.NoError(t, err, `Unexpected error syncing index.`)
+  page, restErr = ListOrgs(&ListParams{Search: `marimba`, FullText: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  assert.Len(t, page.Items, 0, `Archived org listed by default.`)
+  page, restErr = ListOrgs(&ListParams{Search: `marimba`, FullText: true, IncludeArchived: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  require.Len(t, page.Items, 1, `Archived org not listed on request.`)
+  assert.Equal(t, int64(1), page.TotalCount, `Unexpected total count.`)
+  assert.Equal(t, indexed.PubId.String, page.Items[0].PubId.String, `Unexpected match.`)
+
+  // The rebuild keeps archived orgs, flagged as such.
+  require.NoError(t, RebuildSearchIndex(index, ctx), `Unexpected error rebuilding index.`)
+  hits, err := index.Search([]string{`marimba`}, true)
+  require.NoError(t, err, `Unexpected error searching index.`)
+  require.Len(t, hits, 1, `Archived org not indexed.`)
+  hits, _ = index.Search([]string{`marimba`}, false)
+  assert.Empty(t, hits, `Archived org matched by default.`)
+
+  // Only the best hits are passed to the database.
+  other := someOrg.Clone()
+  other.SetDisplayName(`Marimba Repair`)
+  _, restErr = CreateOrg(other, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  _, err = NewSearchIndexer(index).Sync(ctx)
+  require.NoError(t, err, `Unexpected error syncing index.`)
+  defer func(max int) { MaxIndexHits = max }(MaxIndexHits)
+  MaxIndexHits = 1
+  page, restErr = ListOrgs(&ListParams{Search: `marimba`, FullText: true, IncludeArchived: true}, ctx)
+  require.NoError(t, restErr, `Unexpected error searching index.`)
+  assert.Len(t, page.Items, 1, `Unexpected number of capped matches.`)
+  assert.Equal(t, int64(1), page.TotalCount, `Unexpected capped total count.`)
+}
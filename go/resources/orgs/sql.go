@@ -23,7 +23,7 @@ var OrgsSorts = map[string]string{
 func ScanOrgSummary(row *sql.Rows) (*OrgSummary, error) {
 	var o OrgSummary
 
-	if err := row.Scan(&o.PubId, &o.LastUpdated, &o.DisplayName, &o.Summary, &o.Phone, &o.Email, &o.Homepage, &o.LogoURL); err != nil {
+	if err := row.Scan(&o.PubId, &o.LastUpdated, &o.DisplayName, &o.Summary, &o.Phone, &o.Email, &o.Homepage, &o.LogoURL, &o.ArchivedAt, &o.ParentPubId, &o.Version); err != nil {
 		return nil, err
 	}
 
@@ -36,7 +36,7 @@ func ScanOrgDetail(row *sql.Rows) (*Org, *locations.Address, error) {
 
 	if err := row.Scan(&o.PubId, &o.LastUpdated, &o.DisplayName, &o.Summary,
       &o.Phone, &o.Email, &o.Homepage, &o.LogoURL, &o.Active, &o.AuthId,
-      &o.LegalID, &o.LegalIDType, &o.Id,
+      &o.LegalID, &o.LegalIDType, &o.ArchivedAt, &o.ParentPubId, &o.Version, &o.Id,
       &a.LocationId, &a.Idx, &a.Label, &a.Address1, &a.Address2, &a.City,
       &a.State, &a.Zip, &a.Lat, &a.Lng); err != nil {
 		return nil, nil, err
@@ -46,6 +46,13 @@ func ScanOrgDetail(row *sql.Rows) (*Org, *locations.Address, error) {
   if a.LocationId.Int64 < 0 {
     a.LocationId = nulls.NewNullInt64()
   }
+  if o.LegalID.Valid {
+    legalID, err := DecryptLegalID(o.LegalID.String)
+    if err != nil {
+      return nil, nil, err
+    }
+    o.LegalID.String = legalID
+  }
 
 	return &o, &a, nil
 }
@@ -80,10 +87,11 @@ func OrgsGeneralWhereGenerator(term string, params []interface{}) (string, []int
   return whereBit, params, nil
 }
 
-const CommonOrgFields = `e.pub_id, e.last_updated, o.display_name, o.summary, o.phone, o.email, o.homepage, o.logo_url, u.active, u.auth_id, u.legal_id, u.legal_id_type `
-const CommonOrgsFrom = `FROM orgs o JOIN users u ON o.id=u.id JOIN entities e ON o.id=e.id `
+const CommonOrgSummaryFields = `e.pub_id, e.last_updated, o.display_name, o.summary, o.phone, o.email, o.homepage, o.logo_url, UNIX_TIMESTAMP(o.archived_at), pe.pub_id, o.version `
+const CommonOrgFields = `e.pub_id, e.last_updated, o.display_name, o.summary, o.phone, o.email, o.homepage, o.logo_url, u.active, u.auth_id, u.legal_id, u.legal_id_type, UNIX_TIMESTAMP(o.archived_at), pe.pub_id, o.version `
+const CommonOrgsFrom = `FROM orgs o JOIN users u ON o.id=u.id JOIN entities e ON o.id=e.id LEFT JOIN entities pe ON o.parent_id=pe.id `
 
-const createOrgStatement = `INSERT INTO orgs (id, display_name, summary, phone, email, homepage, logo_url) VALUES(?,?,?,?,?,?,?)`
+const createOrgStatement = `INSERT INTO orgs (id, display_name, summary, phone, email, homepage, logo_url, parent_id) VALUES(?,?,?,?,?,?,?,?)`
 func CreateOrg(o *Org, ctx context.Context) (*Org, rest.RestError) {
   txn, err := sqldb.DB.Begin()
   if err != nil {
@@ -98,11 +106,42 @@ func CreateOrg(o *Org, ctx context.Context) (*Org, rest.RestError) {
   return newO, restErr
 }
 
+// CreateOrgInTxn creates the Org within an existing transaction. Where the
+// context carries a Principal (see WithPrincipal), setting the account fields
+// ('authId', 'active', and the legal ID) requires ActionImportAccounts, as
+// the auth ID, in particular, ties the new Org to a User.
 func CreateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  if p := PrincipalFromContext(ctx); p != nil && hasAccountFields(o) {
+    if restErr := Authorize(p, ``, ActionImportAccounts, ctx); restErr != nil {
+      defer txn.Rollback()
+      return nil, restErr
+    }
+  }
+  phone, restErr := storagePhone(o, ctx)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
   o.Addresses.CompleteAddresses(ctx)
 
+  parentId, restErr := resolveParentIdInTxn(o, nil, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+
+  legalID, restErr := storageLegalID(o.LegalID)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+
   var err error
+  // The User is created with the encrypted legal ID.
+  plainLegalID := o.LegalID
+  o.LegalID = legalID
   newId, restErr := users.CreateUserInTxn(&o.User, txn)
+  o.LegalID = plainLegalID
   if restErr != nil {
     defer txn.Rollback()
 		return nil, restErr
@@ -110,7 +149,7 @@ func CreateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestEr
 
   o.Id = nulls.NewInt64(newId)
 
-	_, err = txn.Stmt(createOrgQuery).Exec(newId, o.DisplayName, o.Summary, o.Phone, o.Email, o.Homepage, o.LogoURL)
+	_, err = txn.Stmt(createOrgQuery).Exec(newId, o.DisplayName, o.Summary, phone, o.Email, o.Homepage, o.LogoURL, parentId)
 	if err != nil {
     // TODO: can we do more to tell the cause of the failure? We assume it's due to malformed data with the HTTP code
     defer txn.Rollback()
@@ -122,11 +161,17 @@ func CreateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestEr
     defer txn.Rollback()
     return nil, restErr
   }
+  if restErr := writeTagsInTxn(newId, o.Tags, ctx, txn); restErr != nil {
+    return nil, restErr
+  }
 
   newOrg, err := GetOrgByIDInTxn(o.Id.Int64, ctx, txn)
   if err != nil {
     return nil, rest.ServerError("Problem retrieving newly updated org.", err)
   }
+  if restErr := recordWriteInTxn(AuditCreate, nil, newOrg, ctx, txn); restErr != nil {
+    return nil, restErr
+  }
   // Carry any 'ChangeDesc' made by the geocoding out.
   o.PromoteChanges()
   newOrg.ChangeDesc = o.ChangeDesc
@@ -138,57 +183,71 @@ const CommonOrgGet string = `SELECT ` + CommonOrgFields + `, o.id, loc.id, ea.id
 const getOrgStatement string = CommonOrgGet + `WHERE e.pub_id=? `
 
 // GetOrg retrieves a Org from a public ID string (UUID). Attempting to
-// retrieve a non-existent Org results in a rest.NotFoundError. This is used
-// primarily to retrieve a Org in response to an API request.
+// retrieve a non-existent or archived Org results in a rest.NotFoundError.
+// This is used primarily to retrieve a Org in response to an API request.
 //
 // Consider using GetOrgByID to retrieve a Org from another backend/DB
 // function. TODO: reference discussion of internal vs public IDs.
 func GetOrg(pubId string, ctx context.Context) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgQuery, pubId, ctx, nil)
+  return getOrgHelper(getOrgQuery, pubId, false, ctx, nil)
 }
 
 // GetOrgInTxn retrieves a Org by public ID string (UUID) in the context
 // of an existing transaction. See GetOrg.
 func GetOrgInTxn(pubId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgQuery, pubId, ctx, txn)
+  return getOrgHelper(getOrgQuery, pubId, false, ctx, txn)
+}
+
+// GetOrgIncludingArchived retrieves a Org by public ID string (UUID) whether
+// or not it has been archived. See GetOrg.
+func GetOrgIncludingArchived(pubId string, ctx context.Context) (*Org, rest.RestError) {
+  return getOrgHelper(getOrgQuery, pubId, true, ctx, nil)
+}
+
+// GetOrgIncludingArchivedInTxn retrieves a Org by public ID string (UUID),
+// whether or not it has been archived, in the context of an existing
+// transaction. See GetOrgIncludingArchived.
+func GetOrgIncludingArchivedInTxn(pubId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  return getOrgHelper(getOrgQuery, pubId, true, ctx, txn)
 }
 
 const getOrgByAuthIdStatement string = CommonOrgGet + ` WHERE u.auth_id=? `
 // GetOrgByAuthId retrieves a Org from a public authentication ID string
 // provided by the authentication provider (firebase). Attempting to retrieve a
-// non-existent Org results in a rest.NotFoundError. This is used primarily
-// to retrieve a Org in response to an API request, especially
+// non-existent or archived Org results in a rest.NotFoundError. This is used
+// primarily to retrieve a Org in response to an API request, especially
 // '/orgs/self'.
 func GetOrgByAuthId(authId string, ctx context.Context) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgByAuthIdQuery, authId, ctx, nil)
+  return getOrgHelper(getOrgByAuthIdQuery, authId, false, ctx, nil)
 }
 
 // GetOrgByAuthIdInTxn retrieves a Org by public authentication ID string
 // in the context of an existing transaction. See GetOrgByAuthId.
 func GetOrgByAuthIdInTxn(authId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgByAuthIdQuery, authId, ctx, txn)
+  return getOrgHelper(getOrgByAuthIdQuery, authId, false, ctx, txn)
 }
 
 const getOrgByIdStatement string = CommonOrgGet + ` WHERE o.id=? `
 // GetOrgByID retrieves a Org by internal ID. As the internal ID must
 // never be exposed to users, this method is exclusively for internal/backend
-// use. Specifically, since Orgs are associated with other Entities through
-// the internal ID (i.e., foreign keys use the internal ID), this function is
-// most often used to retrieve a Org which is to be bundled in a response.
+// use and, unlike GetOrg, will retrieve archived Orgs. Specifically, since
+// Orgs are associated with other Entities through the internal ID (i.e.,
+// foreign keys use the internal ID), this function is most often used to
+// retrieve a Org which is to be bundled in a response.
 //
 // Use GetOrg to retrieve a Org in response to an API request. TODO:
 // reference discussion of internal vs public IDs.
 func GetOrgByID(id int64, ctx context.Context) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgByIdQuery, id, ctx, nil)
+  return getOrgHelper(getOrgByIdQuery, id, true, ctx, nil)
 }
 
 // GetOrgByIDInTxn retrieves a Org by internal ID in the context of an
 // existing transaction. See GetOrgByID.
 func GetOrgByIDInTxn(id int64, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
-  return getOrgHelper(getOrgByIdQuery, id, ctx, txn)
+  return getOrgHelper(getOrgByIdQuery, id, true, ctx, txn)
 }
 
-func getOrgHelper(stmt *sql.Stmt, id interface{}, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+func getOrgHelper(stmt *sql.Stmt, id interface{}, includeArchived bool, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
   if txn != nil {
     stmt = txn.Stmt(stmt)
   }
@@ -214,12 +273,15 @@ func getOrgHelper(stmt *sql.Stmt, id interface{}, ctx context.Context, txn *sql.
 	    addresses = append(addresses, address)
     }
 	}
-  if org != nil {
+  if org != nil && (includeArchived || !org.IsArchived()) {
     org.Addresses = addresses
     org.FormatOut()
   } else {
     return nil, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, id), nil)
   }
+  if org.Tags, err = getTags(org.Id.Int64, ctx, txn); err != nil {
+    return nil, rest.ServerError(fmt.Sprintf("Problem getting tags for org: '%v'", id), err)
+  }
 
 	return org, nil
 }
@@ -248,7 +310,37 @@ func UpdateOrg(o *Org, ctx context.Context) (*Org, rest.RestError) {
 
 // UpdatesOrgInTxn updates the canonical Org record within an existing
 // transaction. See UpdateOrg.
+//
+// If the Org carries a Version, it is taken to be the version of the record
+// the caller read, and the update fails with a 409 Conflict rest.RestError if
+// the stored record has since changed.
 func UpdateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  phone, restErr := storagePhone(o, ctx)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if o.Version.Valid {
+    if restErr := checkOrgVersionInTxn(o.PubId.String, o.Version.Int64, ctx, txn); restErr != nil {
+      defer txn.Rollback()
+      return nil, restErr
+    }
+  }
+  oldOrg, restErr := GetOrgInTxn(o.PubId.String, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  parentId, restErr := resolveParentIdInTxn(o, oldOrg, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  legalID, restErr := updateLegalIDInTxn(o, oldOrg, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
   if o.Addresses != nil {
     o.Addresses.CompleteAddresses(ctx)
   }
@@ -262,18 +354,26 @@ func UpdateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestEr
   }
 
   var updateStmt *sql.Stmt = txn.Stmt(updateOrgQuery)
-  _, err = updateStmt.Exec(o.Active, o.LegalID, o.LegalIDType, o.DisplayName, o.Summary, o.Phone, o.Email, o.Homepage, o.LogoURL, o.PubId)
+  _, err = updateStmt.Exec(o.Active, legalID, o.LegalIDType, o.DisplayName, o.Summary, phone, o.Email, o.Homepage, o.LogoURL, parentId, o.PubId)
   if err != nil {
     if txn != nil {
       defer txn.Rollback()
     }
     return nil, rest.ServerError("Could not update org record.", err)
   }
+  if o.Tags != nil {
+    if restErr := writeTagsInTxn(oldOrg.Id.Int64, o.Tags, ctx, txn); restErr != nil {
+      return nil, restErr
+    }
+  }
 
   newOrg, err := GetOrgInTxn(o.PubId.String, ctx, txn)
   if err != nil {
     return nil, rest.ServerError("Problem retrieving newly updated org.", err)
   }
+  if restErr := recordWriteInTxn(AuditUpdate, oldOrg, newOrg, ctx, txn); restErr != nil {
+    return nil, restErr
+  }
   // Carry any 'ChangeDesc' made by the geocoding out.
   o.PromoteChanges()
   newOrg.ChangeDesc = o.ChangeDesc
@@ -281,9 +381,131 @@ func UpdateOrgInTxn(o *Org, ctx context.Context, txn *sql.Tx) (*Org, rest.RestEr
   return newOrg, nil
 }
 
+// ArchiveOrg marks an Org, and its underlying User, as inactive and archived.
+// Archived Orgs are excluded from GetOrg and ListOrgs results, but may be
+// brought back with RestoreOrg. Attempting to archive a non-existent or
+// already archived Org results in a rest.NotFoundError.
+func ArchiveOrg(pubId string, ctx context.Context) (*Org, rest.RestError) {
+  return setArchivedHelper(archiveOrgQuery, deactivateArchivedUserQuery, AuditArchive, pubId, ctx)
+}
+
+// RestoreOrg reverses ArchiveOrg, returning the Org to the state it was in
+// before being archived; the User's 'active' flag is set back to its value at
+// the time. Attempting to restore a non-existent or non-archived Org results
+// in a rest.NotFoundError.
+func RestoreOrg(pubId string, ctx context.Context) (*Org, rest.RestError) {
+  return setArchivedHelper(restoreOrgQuery, reactivateRestoredUserQuery, AuditRestore, pubId, ctx)
+}
+
+func setArchivedHelper(stmt *sql.Stmt, userStmt *sql.Stmt, action AuditAction, pubId string, ctx context.Context) (*Org, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org record.", err)
+  }
+
+  newO, restErr := setArchivedInTxn(stmt, userStmt, action, pubId, ctx, txn)
+  // txn already rolled back if in error, so we only need to commit if no error
+  if restErr == nil {
+    defer txn.Commit()
+  }
+
+  return newO, restErr
+}
+
+// ArchiveOrgInTxn archives an Org within an existing transaction. See
+// ArchiveOrg.
+func ArchiveOrgInTxn(pubId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  return setArchivedInTxn(archiveOrgQuery, deactivateArchivedUserQuery, AuditArchive, pubId, ctx, txn)
+}
+
+// RestoreOrgInTxn restores an archived Org within an existing transaction.
+// See RestoreOrg.
+func RestoreOrgInTxn(pubId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  return setArchivedInTxn(restoreOrgQuery, reactivateRestoredUserQuery, AuditRestore, pubId, ctx, txn)
+}
+
+// setArchivedInTxn applies the Org statement, which must change the Org for
+// the change to be recorded, followed by the User statement.
+func setArchivedInTxn(stmt *sql.Stmt, userStmt *sql.Stmt, action AuditAction, pubId string, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  // A missing Org is reported as not found below.
+  oldOrg, _ := GetOrgIncludingArchivedInTxn(pubId, ctx, txn)
+  res, err := txn.Stmt(stmt).ExecContext(ctx, pubId)
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org record.", err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org record.", err)
+  } else if count == 0 {
+    defer txn.Rollback()
+    return nil, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, pubId), nil)
+  }
+  if _, err := txn.Stmt(userStmt).ExecContext(ctx, pubId); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org user record.", err)
+  }
+
+  newOrg, restErr := GetOrgIncludingArchivedInTxn(pubId, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if restErr := recordWriteInTxn(action, oldOrg, newOrg, ctx, txn); restErr != nil {
+    return nil, restErr
+  }
+
+  return newOrg, nil
+}
+
+// recordWriteInTxn records the audit entry, version snapshot, search
+// document, and outbox event for a change to an Org as part of the
+// transaction, rolling back the transaction on failure.
+func recordWriteInTxn(action AuditAction, oldOrg *Org, newOrg *Org, ctx context.Context, txn *sql.Tx) rest.RestError {
+  if restErr := writeAuditInTxn(action, oldOrg, newOrg, ctx, txn); restErr != nil {
+    return restErr
+  }
+  if restErr := writeVersionInTxn(newOrg, ctx, txn); restErr != nil {
+    return restErr
+  }
+  if restErr := writeSearchDocInTxn(newOrg, ctx, txn); restErr != nil {
+    return restErr
+  }
+
+  return appendEventInTxn(action, newOrg, ctx, txn)
+}
+
+// Archiving saves the User's 'active' flag in 'archived_active' before the
+// User is deactivated, and restoring sets the flag back from the saved value.
+// As MySQL does not order the assignments of a multi-table update, the Org and
+// User are updated separately. Orgs archived before the flag was saved keep
+// their User's current flag.
+const archiveOrgStatement = `UPDATE orgs o JOIN users u ON u.id=o.id JOIN entities e ON o.id=e.id SET o.archived_at=NOW(), o.archived_active=u.active, o.version=o.version+1, e.last_updated=0 WHERE e.pub_id=? AND o.archived_at IS NULL`
+const deactivateArchivedUserStatement = `UPDATE users u JOIN entities e ON u.id=e.id SET u.active=0 WHERE e.pub_id=?`
+const restoreOrgStatement = `UPDATE orgs o JOIN entities e ON o.id=e.id SET o.archived_at=NULL, o.version=o.version+1, e.last_updated=0 WHERE e.pub_id=? AND o.archived_at IS NOT NULL`
+const reactivateRestoredUserStatement = `UPDATE users u JOIN orgs o ON u.id=o.id JOIN entities e ON o.id=e.id SET u.active=COALESCE(o.archived_active, u.active) WHERE e.pub_id=?`
+
+const getOrgVersionStatement = `SELECT o.version FROM orgs o JOIN entities e ON o.id=e.id WHERE e.pub_id=? FOR UPDATE`
+// checkOrgVersionInTxn verifies that the stored Org is at the expected
+// version, locking the record for the remainder of the transaction.
+func checkOrgVersionInTxn(pubId string, version int64, ctx context.Context, txn *sql.Tx) rest.RestError {
+  var current nulls.Int64
+  if err := txn.Stmt(getOrgVersionQuery).QueryRowContext(ctx, pubId).Scan(&current); err == sql.ErrNoRows {
+    return rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, pubId), nil)
+  } else if err != nil {
+    return rest.ServerError(`Could not verify org version.`, err)
+  }
+  if current.Int64 != version {
+    return conflictError(fmt.Sprintf(`Org '%s' has been modified (version %d) since it was read (version %d).`, pubId, current.Int64, version), nil)
+  }
+
+  return nil
+}
+
 // TODO: enable update of AuthID
-const updateOrgStatement = `UPDATE orgs o JOIN users u ON u.id=o.id JOIN entities e ON o.id=e.id SET u.active=?, u.legal_id=?, u.legal_id_type=?, o.display_name=?, o.summary=?, o.phone=?, o.email=?, o.homepage=?, o.logo_url=?, e.last_updated=0 WHERE e.pub_id=?`
-var createOrgQuery, updateOrgQuery, getOrgQuery, getOrgByAuthIdQuery, getOrgByIdQuery *sql.Stmt
+const updateOrgStatement = `UPDATE orgs o JOIN users u ON u.id=o.id JOIN entities e ON o.id=e.id SET u.active=?, u.legal_id=?, u.legal_id_type=?, o.display_name=?, o.summary=?, o.phone=?, o.email=?, o.homepage=?, o.logo_url=?, o.parent_id=?, o.version=o.version+1, e.last_updated=0 WHERE e.pub_id=?`
+var createOrgQuery, updateOrgQuery, getOrgQuery, getOrgByAuthIdQuery, getOrgByIdQuery, archiveOrgQuery, deactivateArchivedUserQuery, restoreOrgQuery, reactivateRestoredUserQuery, getOrgVersionQuery *sql.Stmt
 func SetupDB(db *sql.DB) {
   var err error
   if createOrgQuery, err = db.Prepare(createOrgStatement); err != nil {
@@ -301,4 +523,31 @@ func SetupDB(db *sql.DB) {
   if updateOrgQuery, err = db.Prepare(updateOrgStatement); err != nil {
     log.Fatalf("mysql: prepare update org stmt: %v", err)
   }
+  if getOrgVersionQuery, err = db.Prepare(getOrgVersionStatement); err != nil {
+    log.Fatalf("mysql: prepare get org version stmt: %v", err)
+  }
+  if archiveOrgQuery, err = db.Prepare(archiveOrgStatement); err != nil {
+    log.Fatalf("mysql: prepare archive org stmt: %v", err)
+  }
+  if deactivateArchivedUserQuery, err = db.Prepare(deactivateArchivedUserStatement); err != nil {
+    log.Fatalf("mysql: prepare deactivate archived user stmt: %v", err)
+  }
+  if restoreOrgQuery, err = db.Prepare(restoreOrgStatement); err != nil {
+    log.Fatalf("mysql: prepare restore org stmt: %v", err)
+  }
+  if reactivateRestoredUserQuery, err = db.Prepare(reactivateRestoredUserStatement); err != nil {
+    log.Fatalf("mysql: prepare reactivate restored user stmt: %v", err)
+  }
+  setupTagsDB(db)
+  setupMembersDB(db)
+  setupAuthzDB(db)
+  setupHierarchyDB(db)
+  setupLegalIdDB(db)
+  setupAuditDB(db)
+  setupVersionsDB(db)
+  setupEventsDB(db)
+  setupWebhooksDB(db)
+  setupStreamDB(db)
+  setupSearchDB(db)
+  setupSearchIndexDB(db)
 }
@@ -2,6 +2,7 @@ package orgs_test
 
 import (
   "context"
+  "net/http"
   "os"
   "testing"
 
@@ -11,6 +12,7 @@ import (
   "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
   "github.com/Liquid-Labs/catalyst-core-api/go/resources/users"
   "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
   "github.com/stretchr/testify/assert"
   "github.com/stretchr/testify/require"
 )
@@ -27,12 +29,48 @@ func TestOrgsDBIntegration(t *testing.T) {
       if sqldb.DB == nil { // test was skipped, but we still need to setup
         setupDB()
       }
+      t.Run(`OrgAsOfSeeded`, testOrgAsOfSeeded)
+      t.Run(`OrgSearchSeeded`, testOrgSearchSeeded)
       t.Run(`OrgGet`, testOrgGet)
+      t.Run(`OrgGetByAuthId`, testOrgGetByAuthId)
       t.Run(`OrgCreate`, testOrgCreate)
+      t.Run(`OrgCreateAccounts`, testOrgCreateAccounts)
       t.Run(`OrgUpdate`, testOrgUpdate)
       t.Run(`OrgGetInTxn`, testOrgGetInTxn)
       t.Run(`OrgCreateInTxn`, testOrgCreateInTxn)
       t.Run(`OrgUpdateInTxn`, testOrgUpdateInTxn)
+      t.Run(`OrgList`, testOrgList)
+      t.Run(`OrgListCursor`, testOrgListCursor)
+      t.Run(`OrgArchive`, testOrgArchive)
+      t.Run(`OrgPatch`, testOrgPatch)
+      t.Run(`OrgUpdateConflict`, testOrgUpdateConflict)
+      t.Run(`OrgMembers`, testOrgMembers)
+      t.Run(`OrgRelationships`, testOrgRelationships)
+      t.Run(`OrgMemberOwners`, testOrgMemberOwners)
+      t.Run(`OrgHierarchy`, testOrgHierarchy)
+      t.Run(`OrgHierarchyMoves`, testOrgHierarchyMoves)
+      t.Run(`OrgHierarchyConcurrentMoves`, testOrgHierarchyConcurrentMoves)
+      t.Run(`OrgImport`, testOrgImport)
+      t.Run(`OrgExport`, testOrgExport)
+      t.Run(`OrgPhone`, testOrgPhone)
+      t.Run(`OrgPatchInvalid`, testOrgPatchInvalid)
+      t.Run(`OrgLegalID`, testOrgLegalID)
+      t.Run(`OrgHistory`, testOrgHistory)
+      t.Run(`OrgAsOf`, testOrgAsOf)
+      t.Run(`OrgEvents`, testOrgEvents)
+      t.Run(`OrgWebhooks`, testOrgWebhooks)
+      t.Run(`OrgEventsPerSink`, testOrgEventsPerSink)
+      t.Run(`OrgEventsDeadLetter`, testOrgEventsDeadLetter)
+      t.Run(`OrgChanges`, testOrgChanges)
+      t.Run(`OrgChangesUncommitted`, testOrgChangesUncommitted)
+      t.Run(`OrgChangesExpired`, testOrgChangesExpired)
+      t.Run(`OrgStream`, testOrgStream)
+      t.Run(`OrgNear`, testOrgNear)
+      t.Run(`OrgFullTextSearch`, testOrgFullTextSearch)
+      t.Run(`OrgSearchIndex`, testOrgSearchIndex)
+      t.Run(`OrgTags`, testOrgTags)
+      t.Run(`OrgFacets`, testOrgFacets)
+      t.Run(`OrgFilter`, testOrgFilter)
     }
   }
 }
@@ -40,8 +78,15 @@ func TestOrgsDBIntegration(t *testing.T) {
 const someOrgID=`E9EB036A-0194-4AD4-B598-2412FB9C8F5B`
 
 func setupDB() {
+  SetKeyProvider(testKeyProvider)
   sqldb.RegisterSetup(entities.SetupDB, locations.SetupDB, users.SetupDB, /*orgs.*/SetupDB)
   sqldb.InitDB() // panics if unable to initialize
+  if restErr := BackfillVersions(context.Background()); restErr != nil {
+    panic(restErr)
+  }
+  if restErr := BackfillSearchDocs(context.Background()); restErr != nil {
+    panic(restErr)
+  }
 }
 
 func testOrgDBSetup(t *testing.T) {
@@ -54,12 +99,22 @@ func testOrgGet(t *testing.T) {
   require.NotNil(t, org, `Unexpected nil Org on create (with no error); check ID.`)
   assert.Equal(t, `Some Org`, org.DisplayName.String, `Unexpected display name.`)
   assert.Equal(t, `janedoe@test.com`, org.Email.String, `Unexpected email.`)
-  assert.Equal(t, `555-555-1111`, org.Phone.String, `Unexpected phone.`)
+  assert.Equal(t, `202-555-1111`, org.Phone.String, `Unexpected phone.`)
   assert.Equal(t, false, org.Active.Bool, `Unexpected active value.`)
   assert.NotEmpty(t, org.Id, `Unexpected empty ID.`)
   assert.Equal(t, someOrgID, org.PubId.String, `Unexpected public id.`)
 }
 
+func testOrgGetByAuthId(t *testing.T) {
+  org, err := GetOrgByAuthId(`abcdefg123`, context.Background())
+  require.NoError(t, err, `Unexpected error getting Org by auth ID.`)
+  require.NotNil(t, org, `Unexpected nil Org (with no error); check auth ID.`)
+  assert.Equal(t, someOrgID, org.PubId.String, `Unexpected public id.`)
+
+  _, err = GetOrgByAuthId(`no-such-auth-id`, context.Background())
+  assert.Error(t, err, `Unexpected non-error getting Org by unknown auth ID.`)
+}
+
 func testOrgCreate(t *testing.T) {
   org, err := CreateOrg(someOrg, context.Background())
   require.NoError(t, err, `Unexpected error creating Org.`)
@@ -72,6 +127,34 @@ func testOrgCreate(t *testing.T) {
   assert.NotEmpty(t, org.PubId, `Unexpected empty public id.`)
 }
 
+func testOrgCreateAccounts(t *testing.T) {
+  ctx := context.Background()
+  memberCtx := WithPrincipal(ctx, NewPrincipal(`opqrstu789`, nil))
+  plain := someOrg.Clone()
+  plain.SetDisplayName(`Plain Created Org`)
+  plain.Active = nulls.NewNullBool()
+  plain.AuthId = nulls.NewNullString()
+
+  withAuthId := plain.Clone()
+  withAuthId.AuthId = nulls.NewString(`hijklmn456`)
+  _, restErr := CreateOrg(withAuthId, memberCtx)
+  if assert.Error(t, restErr, `Unexpected non-error setting auth ID.`) {
+    assert.Equal(t, http.StatusForbidden, restErr.Code(), `Unexpected error code.`)
+  }
+  withActive := plain.Clone()
+  withActive.SetActive(true)
+  _, restErr = CreateOrg(withActive, memberCtx)
+  if assert.Error(t, restErr, `Unexpected non-error setting active flag.`) {
+    assert.Equal(t, http.StatusForbidden, restErr.Code(), `Unexpected error code.`)
+  }
+
+  _, restErr = CreateOrg(plain, memberCtx)
+  assert.NoError(t, restErr, `Unexpected error creating plain org.`)
+  adminCtx := WithPrincipal(ctx, NewPrincipal(`opqrstu789`, map[string]interface{}{PlatformAdminClaim: true}))
+  _, restErr = CreateOrg(withActive, adminCtx)
+  assert.NoError(t, restErr, `Unexpected error setting active flag as platform admin.`)
+}
+
 func testOrgUpdate(t *testing.T) {
   someOtherOrg, err := GetOrg(someOrgID, context.Background())
   require.NoError(t, err, `Unexpected error getting Org.`)
@@ -79,7 +162,7 @@ func testOrgUpdate(t *testing.T) {
   someOtherOrg.SetActive(true)
   someOtherOrg.SetDisplayName(`Jane P. Doe`)
   someOtherOrg.SetEmail(`janepdoe@test.com`)
-  someOtherOrg.SetPhone(`555-555-0001`)
+  someOtherOrg.SetPhone(`202-555-0001`)
   org, err := UpdateOrg(someOtherOrg, context.Background())
   require.NoError(t, err, `Unexpected error updating Org.`)
   require.NotNil(t, org, `Unexpected nil Org on create (with no error).`)
@@ -97,7 +180,7 @@ func testOrgGetInTxn(t *testing.T) {
   txn, _ := sqldb.DB.Begin()
   orig := someOtherOrg.Clone()
   // if we get in a txn, we should see the changes
-  someOtherOrg.SetPhone(`555-555-0003`)
+  someOtherOrg.SetPhone(`202-555-0003`)
   org, restErr := UpdateOrgInTxn(someOtherOrg, context.Background(), txn)
   someOtherTxn, restErr := GetOrgInTxn(someOrgID, context.Background(), txn)
   assert.Equal(t, *org, *someOtherTxn, `Update-Org and Get-Org do not match.`)
@@ -131,3 +214,123 @@ func testOrgUpdateInTxn(t *testing.T) {
   /*txn, err := sqldb.DB.Begin()
   assert.NoError(t, err, `Unexpected error opening transaction.`)*/
 }
+
+func testOrgList(t *testing.T) {
+  page, restErr := ListOrgs(&ListParams{Search: `Jane P. Doe`}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing orgs.`)
+  require.NotNil(t, page, `Unexpected nil page (with no error).`)
+  assert.Equal(t, int64(1), page.TotalCount, `Unexpected total count.`)
+  require.Len(t, page.Items, 1, `Unexpected number of results.`)
+  assert.Equal(t, someOrgID, page.Items[0].PubId.String, `Unexpected public id.`)
+  assert.Equal(t, DefaultListLimit, page.Limit, `Unexpected default limit.`)
+
+  _, restErr = ListOrgs(&ListParams{Sort: `foo-asc`}, context.Background())
+  assert.Error(t, restErr, `Unexpected non-error for unknown sort.`)
+}
+
+func testOrgListCursor(t *testing.T) {
+  first, restErr := ListOrgs(&ListParams{Limit: 1, CursorMode: true}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing first page.`)
+  require.Len(t, first.Items, 1, `Unexpected number of results.`)
+  assert.Empty(t, first.PrevCursor, `Unexpected previous cursor on first page.`)
+  require.NotEmpty(t, first.NextCursor, `Expected next cursor on first page.`)
+
+  second, restErr := ListOrgs(&ListParams{Limit: 1, CursorMode: true, Cursor: first.NextCursor}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing second page.`)
+  require.Len(t, second.Items, 1, `Unexpected number of results.`)
+  assert.NotEqual(t, first.Items[0].PubId, second.Items[0].PubId, `Pages unexpectedly overlap.`)
+  require.NotEmpty(t, second.PrevCursor, `Expected previous cursor on second page.`)
+
+  back, restErr := ListOrgs(&ListParams{Limit: 1, CursorMode: true, Cursor: second.PrevCursor}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing previous page.`)
+  require.Len(t, back.Items, 1, `Unexpected number of results.`)
+  assert.Equal(t, first.Items[0].PubId, back.Items[0].PubId, `Previous page does not match first page.`)
+
+  _, restErr = ListOrgs(&ListParams{Sort: `name-desc`, CursorMode: true, Cursor: first.NextCursor}, context.Background())
+  assert.Error(t, restErr, `Unexpected non-error using cursor with mismatched sort.`)
+}
+
+func testOrgArchive(t *testing.T) {
+  yetAnotherOrg := someOrg.Clone()
+  yetAnotherOrg.SetDisplayName(`Archived Doe`)
+  yetAnotherOrg.SetActive(true)
+  newOrg, restErr := CreateOrg(yetAnotherOrg, context.Background())
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  pubId := newOrg.PubId.String
+
+  archived, restErr := ArchiveOrg(pubId, context.Background())
+  require.NoError(t, restErr, `Unexpected error archiving org.`)
+  assert.True(t, archived.IsArchived(), `Org not marked archived.`)
+  assert.False(t, archived.Active.Bool, `Archived org still active.`)
+
+  noOrg, restErr := GetOrg(pubId, context.Background())
+  assert.Nil(t, noOrg, `Unexpected retrieval of archived org.`)
+  assert.Error(t, restErr, `Unexpected non-error retrieving archived org.`)
+  page, restErr := ListOrgs(&ListParams{Search: `Archived Doe`}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing orgs.`)
+  assert.Equal(t, int64(0), page.TotalCount, `Archived org unexpectedly listed.`)
+  page, restErr = ListOrgs(&ListParams{Search: `Archived Doe`, IncludeArchived: true}, context.Background())
+  require.NoError(t, restErr, `Unexpected error listing orgs.`)
+  assert.Equal(t, int64(1), page.TotalCount, `Archived org not listed with 'IncludeArchived'.`)
+
+  _, restErr = ArchiveOrg(pubId, context.Background())
+  assert.Error(t, restErr, `Unexpected non-error re-archiving org.`)
+
+  restored, restErr := RestoreOrg(pubId, context.Background())
+  require.NoError(t, restErr, `Unexpected error restoring org.`)
+  assert.False(t, restored.IsArchived(), `Restored org still marked archived.`)
+  restored, restErr = GetOrg(pubId, context.Background())
+  assert.NoError(t, restErr, `Unexpected error retrieving restored org.`)
+  require.NotNil(t, restored, `Unexpected nil restored org.`)
+  assert.True(t, restored.Active.Bool, `Restored org lost active flag.`)
+
+  // An inactive Org comes back inactive.
+  inactive := restored.Clone()
+  inactive.SetActive(false)
+  inactive, restErr = UpdateOrg(inactive, context.Background())
+  require.NoError(t, restErr, `Unexpected error deactivating org.`)
+  archived, restErr = ArchiveOrg(pubId, context.Background())
+  require.NoError(t, restErr, `Unexpected error archiving org.`)
+  assert.False(t, archived.Active.Bool, `Archived org still active.`)
+  restored, restErr = RestoreOrg(pubId, context.Background())
+  require.NoError(t, restErr, `Unexpected error restoring org.`)
+  assert.False(t, restored.Active.Bool, `Restored org unexpectedly active.`)
+  assert.Equal(t, inactive.Active, restored.Active, `Unexpected active value after round trip.`)
+}
+
+func testOrgPatch(t *testing.T) {
+  orig, restErr := GetOrg(someOrgID, context.Background())
+  require.NoError(t, restErr, `Unexpected error getting org.`)
+  org, restErr := PatchOrg(someOrgID, []byte(`{"phone": "202-555-0004"}`), nulls.NewNullInt64(), context.Background())
+  require.NoError(t, restErr, `Unexpected error patching org.`)
+  assert.Equal(t, `202-555-0004`, org.Phone.String, `Phone not patched.`)
+  assert.Equal(t, orig.DisplayName, org.DisplayName, `Unpatched display name changed.`)
+  assert.Equal(t, orig.Email, org.Email, `Unpatched email changed.`)
+  assert.Equal(t, orig.Summary, org.Summary, `Unpatched summary changed.`)
+
+  _, restErr = PatchOrg(someOrgID, []byte(`{"pubId": "foo"}`), nulls.NewNullInt64(), context.Background())
+  assert.Error(t, restErr, `Unexpected non-error for invalid patch.`)
+}
+
+func testOrgUpdateConflict(t *testing.T) {
+  org, restErr := GetOrg(someOrgID, context.Background())
+  require.NoError(t, restErr, `Unexpected error getting org.`)
+  stale := org.Clone()
+  stale.Version = nulls.NewInt64(org.Version.Int64 - 1)
+  _, restErr = UpdateOrg(stale, context.Background())
+  require.Error(t, restErr, `Unexpected non-error updating stale org.`)
+  assert.Equal(t, http.StatusConflict, restErr.Code(), `Unexpected error code.`)
+
+  _, restErr = PatchOrg(someOrgID, []byte(`{"phone": "202-555-0005"}`), stale.Version, context.Background())
+  require.Error(t, restErr, `Unexpected non-error patching stale org.`)
+  assert.Equal(t, http.StatusConflict, restErr.Code(), `Unexpected error code.`)
+
+  updated, restErr := UpdateOrg(org, context.Background())
+  require.NoError(t, restErr, `Unexpected error updating current org.`)
+  assert.NotEqual(t, ETag(&org.OrgSummary), ETag(&updated.OrgSummary), `ETag not changed by update.`)
+
+  // A second write within the same second must still be detected.
+  _, restErr = UpdateOrg(org, context.Background())
+  require.Error(t, restErr, `Unexpected non-error updating superseded org.`)
+  assert.Equal(t, http.StatusConflict, restErr.Code(), `Unexpected error code.`)
+}
@@ -0,0 +1,229 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "io"
+  "log"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+  "unicode"
+)
+
+// StreamFilter selects the events sent to a stream client. An empty filter
+// matches every event.
+type StreamFilter struct {
+  // PubIds, if any, limits the stream to the identified Orgs.
+  PubIds map[string]bool
+  // Term, if set, limits the stream to Orgs matching the search term in the
+  // same way as OrgsGeneralWhereGenerator.
+  Term   string
+}
+
+// NewStreamFilter creates a StreamFilter from the requested public IDs and
+// search term.
+func NewStreamFilter(pubIds []string, term string) *StreamFilter {
+  filter := &StreamFilter{Term: term}
+  if len(pubIds) > 0 {
+    filter.PubIds = make(map[string]bool, len(pubIds))
+    for _, pubId := range pubIds {
+      filter.PubIds[strings.ToUpper(pubId)] = true
+    }
+  }
+  return filter
+}
+
+// Matches is true if the event passes the filter.
+func (f *StreamFilter) Matches(e *Event) bool {
+  if f.PubIds != nil && !f.PubIds[strings.ToUpper(e.OrgPubId)] {
+    return false
+  }
+  return f.Term == `` || MatchesSearch(&e.Org.OrgSummary, f.Term)
+}
+
+// MatchesSearch applies a general search term to an Org in memory. As with
+// OrgsGeneralWhereGenerator, numeric terms are matched against the phone
+// number and other terms against the display name and email, ignoring case.
+func MatchesSearch(o *OrgSummary, term string) bool {
+  if _, err := strconv.ParseInt(term, 10, 64); err == nil {
+    digits := strings.Map(func(r rune) rune {
+      if unicode.IsDigit(r) {
+        return r
+      }
+      return -1
+    }, o.Phone.String)
+    return strings.Contains(digits, term)
+  }
+  term = strings.ToLower(term)
+  return strings.Contains(strings.ToLower(o.DisplayName.String), term) ||
+    strings.Contains(strings.ToLower(o.Email.String), term)
+}
+
+// WriteStreamEvent writes the event as a Server-Sent Event, identified by the
+// event ID and carrying the OrgSummary.
+func WriteStreamEvent(w io.Writer, e *Event) error {
+  data, err := json.Marshal(e.Org.OrgSummary)
+  if err != nil {
+    return err
+  }
+  _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+  return err
+}
+
+// streamBuffer is the number of events held for a stream client before it is
+// considered too slow and dropped.
+const streamBuffer = 64
+
+// EventStream tails the outbox, fanning committed events out to the stream
+// clients. Since it reads the outbox directly, every process sees every event
+// whichever Dispatcher delivers it.
+type EventStream struct {
+  // Interval is the time between polls of the outbox.
+  Interval    time.Duration
+  mu          sync.Mutex
+  lastId      int64
+  started     bool
+  subscribers map[chan *Event]bool
+}
+
+// NewEventStream creates an EventStream polling every second.
+func NewEventStream() *EventStream {
+  return &EventStream{Interval: time.Second, subscribers: make(map[chan *Event]bool)}
+}
+
+// Subscribe registers a stream client. The returned channel receives events,
+// in order, until the cancel function is called. Should the client fall
+// behind, the channel is closed and the client must resume from the last
+// event it saw (see ReplayEvents).
+func (s *EventStream) Subscribe() (<-chan *Event, func()) {
+  events := make(chan *Event, streamBuffer)
+  s.mu.Lock()
+  s.subscribers[events] = true
+  s.mu.Unlock()
+
+  return events, func() {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.subscribers[events] {
+      delete(s.subscribers, events)
+      close(events)
+    }
+  }
+}
+
+func (s *EventStream) publish(e *Event) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  for events := range s.subscribers {
+    select {
+    case events <- e:
+    default:
+      delete(s.subscribers, events)
+      close(events)
+    }
+  }
+}
+
+// poll publishes the events committed to the outbox since the last poll. The
+// first poll only notes where the outbox stands.
+func (s *EventStream) poll(ctx context.Context) error {
+  if !s.started {
+    lastId, err := eventHorizon(ctx)
+    if err != nil {
+      return err
+    }
+    s.lastId, s.started = lastId, true
+    return nil
+  }
+  for {
+    events, lastId, err := ReplayEvents(s.lastId, MaxListLimit, ctx)
+    if err != nil {
+      return err
+    }
+    for _, e := range events {
+      s.publish(e)
+    }
+    if lastId == s.lastId {
+      return nil
+    }
+    s.lastId = lastId
+  }
+}
+
+// Run polls the outbox, publishing events, until the context is done.
+func (s *EventStream) Run(ctx context.Context) {
+  ticker := time.NewTicker(s.Interval)
+  defer ticker.Stop()
+  for {
+    if err := s.poll(ctx); err != nil {
+      log.Printf("Could not poll org events for stream: %s", err)
+    }
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// DefaultEventStream is the EventStream serving '/orgs/stream/'.
+var DefaultEventStream = NewEventStream()
+
+// ReplayEvents reads up to limit of the committed events following the
+// identified event (see EventGapWindow), oldest first, whether or not they
+// have been delivered. Events whose payload cannot be read are logged and
+// skipped. Along with the events, the ID of the last event read, including
+// any skipped, is returned; this is afterId where there are none to read.
+func ReplayEvents(afterId int64, limit int64, ctx context.Context) ([]*Event, int64, error) {
+  rows, err := replayEventsQuery.QueryContext(ctx, gapWindowSeconds(), afterId, limit)
+  if err != nil {
+    return nil, afterId, err
+  }
+  defer rows.Close()
+
+  read := make([]*Event, 0)
+  ids := make([]int64, 0)
+  recent := make([]bool, 0)
+  payloads := make([][]byte, 0)
+  for rows.Next() {
+    var e Event
+    var payload []byte
+    var isRecent bool
+    if err := rows.Scan(&e.Id, &e.Type, &e.OrgPubId, &e.At, &payload, &isRecent); err != nil {
+      return nil, afterId, err
+    }
+    read, ids, recent, payloads = append(read, &e), append(ids, e.Id), append(recent, isRecent), append(payloads, payload)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, afterId, err
+  }
+
+  count := committedPrefix(afterId, ids, recent)
+  events := make([]*Event, 0, count)
+  for i, e := range read[:count] {
+    if err := json.Unmarshal(payloads[i], &e.Org); err != nil {
+      log.Printf("Skipping org event %d (%s) with malformed payload: %s", e.Id, e.Type, err)
+      continue
+    }
+    events = append(events, e)
+  }
+  if count > 0 {
+    afterId = ids[count - 1]
+  }
+
+  return events, afterId, nil
+}
+
+const replayEventsStatement = `SELECT ob.id, ob.event_type, e.pub_id, UNIX_TIMESTAMP(ob.created_at), ob.payload, ob.created_at > NOW() - INTERVAL ? SECOND FROM org_outbox ob JOIN entities e ON ob.org_id=e.id WHERE ob.id > ? ORDER BY ob.id LIMIT ?`
+var replayEventsQuery *sql.Stmt
+
+func setupStreamDB(db *sql.DB) {
+  var err error
+  if replayEventsQuery, err = db.Prepare(replayEventsStatement); err != nil {
+    log.Fatalf("mysql: prepare replay events stmt: %v", err)
+  }
+}
@@ -0,0 +1,96 @@
+package orgs_test
+
+import (
+  "bytes"
+  "context"
+  "testing"
+  "time"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestMatchesSearch(t *testing.T) {
+  org := trivialOrgSummary.Clone()
+  org.SetPhone(`+1 555-555-9999`)
+  assert.True(t, MatchesSearch(org, `DISPLAY`), `Display name not matched ignoring case.`)
+  assert.True(t, MatchesSearch(org, `foo@`), `Email not matched.`)
+  assert.True(t, MatchesSearch(org, `5559999`), `Phone not matched by digits.`)
+  assert.False(t, MatchesSearch(org, `great`), `Unexpected match on summary.`)
+  assert.False(t, MatchesSearch(org, `1234`), `Unexpected phone match.`)
+}
+
+func TestStreamFilter(t *testing.T) {
+  e := &Event{Type: EventOrgUpdated, OrgPubId: `abc`, Org: trivialOrg}
+  assert.True(t, NewStreamFilter(nil, ``).Matches(e), `Empty filter did not match.`)
+  assert.True(t, NewStreamFilter([]string{`ABC`}, ``).Matches(e), `Public ID not matched ignoring case.`)
+  assert.False(t, NewStreamFilter([]string{`def`}, ``).Matches(e), `Unexpected public ID match.`)
+  assert.True(t, NewStreamFilter([]string{`abc`}, `display`).Matches(e), `Public ID and term not matched.`)
+  assert.False(t, NewStreamFilter(nil, `nomatch`).Matches(e), `Unexpected term match.`)
+}
+
+func TestWriteStreamEvent(t *testing.T) {
+  var buf bytes.Buffer
+  require.NoError(t, WriteStreamEvent(&buf, &Event{Id: 7, Type: EventOrgCreated, Org: trivialOrg}), `Unexpected error writing event.`)
+  lines := bytes.Split(buf.Bytes(), []byte("\n"))
+  require.Len(t, lines, 5, `Unexpected event framing.`)
+  assert.Equal(t, `id: 7`, string(lines[0]), `Unexpected id line.`)
+  assert.Equal(t, `event: OrgCreated`, string(lines[1]), `Unexpected event line.`)
+  assert.Contains(t, string(lines[2]), `"displayName":"displayName"`, `Unexpected data line.`)
+  assert.NotContains(t, string(lines[2]), `addresses`, `Data not a summary.`)
+}
+
+func testOrgStream(t *testing.T) {
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+  // Earlier tests leave gaps behind where their transactions rolled back.
+  defer func(window time.Duration) { EventGapWindow = window }(EventGapWindow)
+  EventGapWindow = 0
+  stream := NewEventStream()
+  stream.Interval = 10 * time.Millisecond
+  events, unsubscribe := stream.Subscribe()
+  defer unsubscribe()
+  go stream.Run(ctx)
+  // Let the stream note where the outbox stands.
+  time.Sleep(100 * time.Millisecond)
+
+  _, restErr := PatchOrg(someOrgID, []byte(`{"summary": "Streamed."}`), nulls.NewNullInt64(), ctx)
+  require.NoError(t, restErr, `Unexpected error patching org.`)
+  var e *Event
+  select {
+  case e = <-events:
+  case <-time.After(5 * time.Second):
+    require.Fail(t, `Timed out waiting for streamed event.`)
+  }
+  assert.Equal(t, EventOrgUpdated, e.Type, `Unexpected event type.`)
+  assert.Equal(t, `Streamed.`, e.Org.Summary.String, `Unexpected streamed org.`)
+
+  replay, lastId, err := ReplayEvents(e.Id - 1, 1, ctx)
+  require.NoError(t, err, `Unexpected error replaying events.`)
+  require.Len(t, replay, 1, `Unexpected number of replayed events.`)
+  assert.Equal(t, e.Id, replay[0].Id, `Unexpected replayed event.`)
+  assert.Equal(t, e.Id, lastId, `Unexpected replay position.`)
+
+  // A malformed payload is skipped rather than stalling the replay.
+  res, err := sqldb.DB.Exec(`INSERT INTO org_outbox (event_type, org_id, payload) SELECT ?, org_id, ? FROM org_outbox WHERE id=?`, EventOrgUpdated, `{`, e.Id)
+  require.NoError(t, err, `Unexpected error adding malformed event.`)
+  malformedId, err := res.LastInsertId()
+  require.NoError(t, err, `Unexpected error adding malformed event.`)
+  defer sqldb.DB.Exec(`DELETE FROM org_outbox WHERE id=?`, malformedId)
+  _, restErr = PatchOrg(someOrgID, []byte(`{"summary": "Streamed again."}`), nulls.NewNullInt64(), ctx)
+  require.NoError(t, restErr, `Unexpected error patching org.`)
+  replay, lastId, err = ReplayEvents(e.Id, MaxListLimit, ctx)
+  require.NoError(t, err, `Unexpected error replaying past malformed event.`)
+  require.NotEmpty(t, replay, `Replay stalled at malformed event.`)
+  assert.Equal(t, `Streamed again.`, replay[len(replay) - 1].Org.Summary.String, `Unexpected replayed org.`)
+  assert.Equal(t, replay[len(replay) - 1].Id, lastId, `Unexpected replay position.`)
+  select {
+  case e = <-events:
+  case <-time.After(5 * time.Second):
+    require.Fail(t, `Stream stalled at malformed event.`)
+  }
+  assert.Equal(t, `Streamed again.`, e.Org.Summary.String, `Unexpected streamed org.`)
+}
@@ -0,0 +1,119 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "log"
+  "sort"
+  "strings"
+  "unicode/utf8"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// Tag limits; the length (in characters) is that of the 'org_tags' column.
+const (
+  maxTagLength = 64
+  MaxOrgTags   = 32
+)
+
+// NormalizeTag renders the tag in the stored form: lower case, with runs of
+// whitespace collapsed to a single space.
+func NormalizeTag(tag string) string {
+  return strings.ToLower(strings.Join(strings.Fields(tag), ` `))
+}
+
+// NormalizeTags normalizes each of the tags (see NormalizeTag), dropping
+// duplicates, and sorts them.
+func NormalizeTags(tags []string) []string {
+  seen := make(map[string]bool, len(tags))
+  normalized := make([]string, 0, len(tags))
+  for _, tag := range tags {
+    tag = NormalizeTag(tag)
+    if !seen[tag] {
+      seen[tag] = true
+      normalized = append(normalized, tag)
+    }
+  }
+  sort.Strings(normalized)
+
+  return normalized
+}
+
+// validateTags checks that each tag is non-blank and fits its column, and
+// that there are no more than MaxOrgTags.
+func validateTags(errs *ValidationError, tags []string) {
+  if len(tags) > MaxOrgTags {
+    errs.add(`tags`, fmt.Sprintf(`may not exceed %d tags`, MaxOrgTags))
+  }
+  for i, tag := range tags {
+    path := fmt.Sprintf(`tags[%d]`, i)
+    if tag = NormalizeTag(tag); tag == `` {
+      errs.add(path, `may not be blank`)
+    } else if utf8.RuneCountInString(tag) > maxTagLength {
+      errs.add(path, fmt.Sprintf(`may not exceed %d characters`, maxTagLength))
+    }
+  }
+}
+
+// writeTagsInTxn replaces the Org's tags with the normalized tags as part of
+// the transaction, rolling back the transaction on failure.
+func writeTagsInTxn(orgId int64, tags []string, ctx context.Context, txn *sql.Tx) rest.RestError {
+  if _, err := txn.Stmt(deleteTagsQuery).ExecContext(ctx, orgId); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not update org tags.`, err)
+  }
+  for _, tag := range NormalizeTags(tags) {
+    if tag == `` {
+      continue
+    }
+    if _, err := txn.Stmt(createTagQuery).ExecContext(ctx, orgId, tag); err != nil {
+      defer txn.Rollback()
+      return rest.UnprocessableEntityError(fmt.Sprintf(`Could not tag org '%s'.`, tag), err)
+    }
+  }
+
+  return nil
+}
+
+// getTags retrieves the Org's tags in order.
+func getTags(orgId int64, ctx context.Context, txn *sql.Tx) ([]string, error) {
+  stmt := getTagsQuery
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  rows, err := stmt.QueryContext(ctx, orgId)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+  tags := make([]string, 0)
+  for rows.Next() {
+    var tag string
+    if err := rows.Scan(&tag); err != nil {
+      return nil, err
+    }
+    tags = append(tags, tag)
+  }
+
+  return tags, rows.Err()
+}
+
+const getTagsStatement = `SELECT tag FROM org_tags WHERE org_id=? ORDER BY tag`
+const deleteTagsStatement = `DELETE FROM org_tags WHERE org_id=?`
+const createTagStatement = `INSERT INTO org_tags (org_id, tag) VALUES (?,?)`
+var getTagsQuery, deleteTagsQuery, createTagQuery *sql.Stmt
+
+func setupTagsDB(db *sql.DB) {
+  var err error
+  if getTagsQuery, err = db.Prepare(getTagsStatement); err != nil {
+    log.Fatalf("mysql: prepare get tags stmt: %v", err)
+  }
+  if deleteTagsQuery, err = db.Prepare(deleteTagsStatement); err != nil {
+    log.Fatalf("mysql: prepare delete tags stmt: %v", err)
+  }
+  if createTagQuery, err = db.Prepare(createTagStatement); err != nil {
+    log.Fatalf("mysql: prepare create tag stmt: %v", err)
+  }
+}
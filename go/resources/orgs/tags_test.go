@@ -0,0 +1,68 @@
+package orgs_test
+
+import (
+  "context"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+  assert.Equal(t, `non profit`, NormalizeTag("  Non\t Profit "), `Unexpected normalized tag.`)
+  assert.Equal(t, []string{`arts`, `non profit`}, NormalizeTags([]string{`Non Profit`, `arts`, `non  profit`}), `Unexpected normalized tags.`)
+  assert.Equal(t, []string{}, NormalizeTags(nil), `Unexpected tags for nil.`)
+}
+
+func TestOrgValidateTags(t *testing.T) {
+  org := trivialOrg.Clone()
+  org.Tags = []string{`arts`, ` `, strings.Repeat(`x`, 65)}
+  restErr := org.Validate(context.Background())
+  require.Error(t, restErr, `Unexpected non-error validating invalid tags.`)
+  validationErr, ok := restErr.(*ValidationError)
+  require.True(t, ok, `Expected a ValidationError.`)
+  fields := make([]string, len(validationErr.Fields))
+  for i, field := range validationErr.Fields {
+    fields[i] = field.Field
+  }
+  assert.ElementsMatch(t, []string{`tags[1]`, `tags[2]`}, fields, `Unexpected invalid fields.`)
+
+  org.Tags = make([]string, MaxOrgTags + 1)
+  for i := range org.Tags {
+    org.Tags[i] = strings.Repeat(`t`, i + 1)
+  }
+  assert.Error(t, org.Validate(context.Background()), `Unexpected non-error validating too many tags.`)
+}
+
+func testOrgTags(t *testing.T) {
+  ctx := context.Background()
+  org := someOrg.Clone()
+  org.SetDisplayName(`Tagged Org`)
+  org.Tags = []string{`Arts`, `non profit`, `arts`}
+  org, restErr := CreateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  assert.Equal(t, []string{`arts`, `non profit`}, org.Tags, `Unexpected tags on create.`)
+
+  org.SetSummary(`Tags left as is.`)
+  org.Tags = nil
+  org.Version.Valid = false
+  org, restErr = UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating org.`)
+  assert.Equal(t, []string{`arts`, `non profit`}, org.Tags, `Tags not kept when omitted.`)
+
+  org.Tags = []string{`music`}
+  org.Version.Valid = false
+  org, restErr = UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating org.`)
+  retrieved, restErr := GetOrg(org.PubId.String, ctx)
+  require.NoError(t, restErr, `Unexpected error retrieving org.`)
+  assert.Equal(t, []string{`music`}, retrieved.Tags, `Tags not replaced.`)
+
+  org.Tags = []string{}
+  org.Version.Valid = false
+  org, restErr = UpdateOrg(org, ctx)
+  require.NoError(t, restErr, `Unexpected error updating org.`)
+  assert.Equal(t, []string{}, org.Tags, `Tags not cleared.`)
+}
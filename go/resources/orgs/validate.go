@@ -0,0 +1,164 @@
+package orgs
+
+import (
+  "context"
+  "fmt"
+  "net/http"
+  "net/mail"
+  "net/url"
+  "regexp"
+  "strings"
+  "unicode/utf8"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ValidationError is a 422 Unprocessable Entity rest.RestError listing every
+// invalid field.
+type ValidationError struct {
+  Fields []*FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+  problems := make([]string, len(e.Fields))
+  for i, field := range e.Fields {
+    problems[i] = fmt.Sprintf(`'%s': %s`, field.Field, field.Message)
+  }
+  return `Invalid org; ` + strings.Join(problems, `; `)
+}
+
+func (e *ValidationError) Code() int {
+  return http.StatusUnprocessableEntity
+}
+
+func (e *ValidationError) Cause() error {
+  return nil
+}
+
+func (e *ValidationError) add(field string, message string) {
+  e.Fields = append(e.Fields, NewFieldError(field, message))
+}
+
+// Column length limits (in characters) from the 'orgs' schema.
+const (
+  maxDisplayNameLength = 128
+  maxSummaryLength     = 512
+  maxEmailLength       = 255
+  maxURLLength         = 255
+)
+
+// Address field length limits (in characters), and the form of a postal code;
+// letters, digits, spaces, and hyphens, as used across regions.
+const (
+  maxAddressLabelLength = 64
+  maxAddressLineLength  = 128
+  maxCityLength         = 64
+  maxStateLength        = 64
+  maxZipLength          = 12
+)
+
+var zipMatcher = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9 -]*[A-Za-z0-9])?$`)
+
+// Validate checks the Org before it is written, returning a ValidationError
+// listing each problem. The display name and email are required, the email,
+// homepage, logo URL, and phone must be well formed, and values must fit
+// their columns. Each address is checked in turn, with problems reported
+// against its indexed path; e.g., 'addresses[0].zip'. The context determines
+// the phone region, where the Org's addresses do not (see WithPhoneRegion).
+// Tags must be non-blank and fit their column.
+func (o *Org) Validate(ctx context.Context) rest.RestError {
+  errs := &ValidationError{}
+
+  validateRequired(errs, `displayName`, o.DisplayName)
+  validateRequired(errs, `email`, o.Email)
+  validateLength(errs, `displayName`, o.DisplayName, maxDisplayNameLength)
+  validateLength(errs, `summary`, o.Summary, maxSummaryLength)
+  if validateLength(errs, `email`, o.Email, maxEmailLength) && present(o.Email) {
+    if addr, err := mail.ParseAddress(o.Email.String); err != nil || addr.Address != o.Email.String {
+      errs.add(`email`, `must be a plain email address`)
+    }
+  }
+  validateURL(errs, `homepage`, o.Homepage)
+  validateURL(errs, `logoURL`, o.LogoURL)
+  if present(o.Phone) {
+    if _, err := NormalizePhone(o.Phone.String, phoneRegion(o, ctx)); err != nil {
+      errs.add(`phone`, err.Error())
+    }
+  }
+  idxs := make(map[int64]bool)
+  for i, address := range o.Addresses {
+    validateAddress(errs, fmt.Sprintf(`addresses[%d]`, i), address, idxs)
+  }
+  validateTags(errs, o.Tags)
+
+  if len(errs.Fields) > 0 {
+    return errs
+  }
+  return nil
+}
+
+func present(value nulls.String) bool {
+  return value.Valid && strings.TrimSpace(value.String) != ``
+}
+
+func validateRequired(errs *ValidationError, field string, value nulls.String) {
+  if !present(value) {
+    errs.add(field, `is required`)
+  }
+}
+
+// validateLength is true if the value fits.
+func validateLength(errs *ValidationError, field string, value nulls.String, max int) bool {
+  if value.Valid && utf8.RuneCountInString(value.String) > max {
+    errs.add(field, fmt.Sprintf(`may not exceed %d characters`, max))
+    return false
+  }
+  return true
+}
+
+func validateAddress(errs *ValidationError, path string, address *locations.Address, idxs map[int64]bool) {
+  if address == nil {
+    errs.add(path, `must be an address`)
+    return
+  }
+  validateLength(errs, path + `.label`, address.Label, maxAddressLabelLength)
+  validateLength(errs, path + `.address1`, address.Address1, maxAddressLineLength)
+  validateLength(errs, path + `.address2`, address.Address2, maxAddressLineLength)
+  validateLength(errs, path + `.city`, address.City, maxCityLength)
+  validateLength(errs, path + `.state`, address.State, maxStateLength)
+  if validateLength(errs, path + `.zip`, address.Zip, maxZipLength) && present(address.Zip) {
+    if !zipMatcher.MatchString(address.Zip.String) {
+      errs.add(path + `.zip`, `must be a postal code`)
+    }
+  }
+  if address.Lat.Valid != address.Lng.Valid {
+    errs.add(path, `must give both 'lat' and 'lng' or neither`)
+  }
+  if address.Lat.Valid && (address.Lat.Float64 < -90 || address.Lat.Float64 > 90) {
+    errs.add(path + `.lat`, `must be between -90 and 90`)
+  }
+  if address.Lng.Valid && (address.Lng.Float64 < -180 || address.Lng.Float64 > 180) {
+    errs.add(path + `.lng`, `must be between -180 and 180`)
+  }
+  if address.Idx.Valid {
+    if address.Idx.Int64 < 0 {
+      errs.add(path + `.idx`, `may not be negative`)
+    } else if idxs[address.Idx.Int64] {
+      errs.add(path + `.idx`, `duplicates that of another address`)
+    }
+    idxs[address.Idx.Int64] = true
+  }
+}
+
+func validateURL(errs *ValidationError, field string, value nulls.String) {
+  if !validateLength(errs, field, value, maxURLLength) || !present(value) {
+    return
+  }
+  if u, err := url.Parse(value.String); err != nil || u.Host == `` {
+    errs.add(field, `must be an absolute URL`)
+  } else if u.Scheme != `http` && u.Scheme != `https` {
+    errs.add(field, `must use the 'http' or 'https' scheme`)
+  }
+}
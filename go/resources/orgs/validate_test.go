@@ -0,0 +1,87 @@
+package orgs_test
+
+import (
+  "context"
+  "net/http"
+  "strings"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/locations"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestOrgValidate(t *testing.T) {
+  assert.NoError(t, trivialOrg.Validate(context.Background()), `Unexpected error validating valid Org.`)
+
+  org := trivialOrg.Clone()
+  org.DisplayName = nulls.NewNullString()
+  org.Email = nulls.NewString(`  `)
+  org.Summary = nulls.NewString(strings.Repeat(`x`, 513))
+  org.Homepage = nulls.NewString(`ftp://foo.com/`)
+  org.LogoURL = nulls.NewString(`logo.png`)
+  org.Phone = nulls.NewString(`555-1111`)
+  restErr := org.Validate(context.Background())
+  require.Error(t, restErr, `Unexpected non-error validating invalid Org.`)
+  assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+  validationErr, ok := restErr.(*ValidationError)
+  require.True(t, ok, `Expected a ValidationError.`)
+
+  fields := make([]string, len(validationErr.Fields))
+  for i, field := range validationErr.Fields {
+    fields[i] = field.Field
+  }
+  assert.ElementsMatch(t, []string{`displayName`, `email`, `summary`, `homepage`, `logoURL`, `phone`}, fields, `Unexpected invalid fields.`)
+}
+
+func TestOrgValidateAddresses(t *testing.T) {
+  org := trivialOrg.Clone()
+  bad := &locations.Address{}
+  bad.Idx = nulls.NewInt64(1)
+  bad.Zip = nulls.NewString(`#123`)
+  bad.City = nulls.NewString(strings.Repeat(`x`, 65))
+  bad.Lat = nulls.NewFloat64(91)
+  bad.Lng = nulls.NewFloat64(0)
+  org.Addresses = append(org.Addresses, bad, nil)
+  restErr := org.Validate(context.Background())
+  require.Error(t, restErr, `Unexpected non-error validating invalid addresses.`)
+  validationErr, ok := restErr.(*ValidationError)
+  require.True(t, ok, `Expected a ValidationError.`)
+
+  fields := make([]string, len(validationErr.Fields))
+  for i, field := range validationErr.Fields {
+    fields[i] = field.Field
+  }
+  expected := []string{`addresses[1].city`, `addresses[1].zip`, `addresses[1].lat`, `addresses[1].idx`, `addresses[2]`}
+  assert.ElementsMatch(t, expected, fields, `Unexpected invalid fields.`)
+}
+
+func TestOrgValidateEmail(t *testing.T) {
+  for _, email := range []string{`foo`, `Foo <foo@test.com>`, `foo@`} {
+    org := trivialOrg.Clone()
+    org.Email = nulls.NewString(email)
+    assert.Errorf(t, org.Validate(context.Background()), `Unexpected non-error for email '%s'.`, email)
+  }
+}
+
+func TestOrgValidateLength(t *testing.T) {
+  org := trivialOrg.Clone()
+  org.DisplayName = nulls.NewString(strings.Repeat(`é`, 128))
+  assert.NoError(t, org.Validate(context.Background()), `Multi-byte characters counted as multiple characters.`)
+  org.DisplayName = nulls.NewString(strings.Repeat(`é`, 129))
+  assert.Error(t, org.Validate(context.Background()), `Unexpected non-error for over-long display name.`)
+}
+
+func testOrgPatchInvalid(t *testing.T) {
+  _, restErr := PatchOrg(someOrgID, []byte(`{"email": null, "homepage": "nope"}`), nulls.NewNullInt64(), context.Background())
+  require.Error(t, restErr, `Unexpected non-error for invalid patch.`)
+  validationErr, ok := restErr.(*ValidationError)
+  require.True(t, ok, `Expected a ValidationError.`)
+  assert.Len(t, validationErr.Fields, 2, `Unexpected number of invalid fields.`)
+
+  org, restErr := GetOrg(someOrgID, context.Background())
+  require.NoError(t, restErr, `Unexpected error getting Org.`)
+  assert.True(t, org.Email.Valid, `Invalid patch applied.`)
+}
@@ -0,0 +1,262 @@
+package orgs
+
+import (
+  "context"
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "log"
+  "strconv"
+  "time"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// ParseAsOf parses a point in time given either as Unix seconds or as an
+// RFC 3339 timestamp.
+func ParseAsOf(value string) (time.Time, error) {
+  if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+    return time.Unix(secs, 0), nil
+  }
+  at, err := time.Parse(time.RFC3339, value)
+  if err != nil {
+    return at, fmt.Errorf(`'%s' is neither Unix seconds nor an RFC 3339 timestamp`, value)
+  }
+
+  return at, nil
+}
+
+// snapshotOrg renders the Org as stored in a version snapshot. As with the
+// canonical record, the legal ID is encrypted.
+func snapshotOrg(o *Org) ([]byte, rest.RestError) {
+  snapshot := o.Clone()
+  snapshot.ChangeDesc = nil
+  legalID, restErr := storageLegalID(snapshot.LegalID)
+  if restErr != nil {
+    return nil, restErr
+  }
+  snapshot.LegalID = legalID
+  data, err := json.Marshal(snapshot)
+  if err != nil {
+    return nil, rest.ServerError(`Could not snapshot org.`, err)
+  }
+
+  return data, nil
+}
+
+// restoreSnapshot reverses snapshotOrg.
+func restoreSnapshot(data []byte) (*Org, error) {
+  org := &Org{}
+  if err := json.Unmarshal(data, org); err != nil {
+    return nil, err
+  }
+  if org.LegalID.Valid {
+    legalID, err := DecryptLegalID(org.LegalID.String)
+    if err != nil {
+      return nil, err
+    }
+    org.LegalID.String = legalID
+  }
+
+  return org, nil
+}
+
+// writeVersionInTxn records a snapshot of the Org as written as part of the
+// transaction, rolling back the transaction on failure.
+func writeVersionInTxn(o *Org, ctx context.Context, txn *sql.Tx) rest.RestError {
+  data, restErr := snapshotOrg(o)
+  if restErr == nil {
+    if _, err := txn.Stmt(createVersionQuery).ExecContext(ctx, o.Id, data); err != nil {
+      restErr = rest.ServerError(`Could not record org version.`, err)
+    }
+  }
+  if restErr != nil {
+    defer txn.Rollback()
+    return restErr
+  }
+
+  return nil
+}
+
+// Baseline versions (see BackfillVersions) may be recorded after later
+// versions, so we order by time first.
+const getOrgAsOfStatement = `SELECT v.snapshot FROM org_versions v JOIN entities e ON v.org_id=e.id WHERE e.pub_id=? AND v.created_at <= FROM_UNIXTIME(?) ORDER BY v.created_at DESC, v.id DESC LIMIT 1`
+
+// GetOrgAsOf retrieves the Org as it stood at the given time, which may
+// include a since archived state. Attempting to retrieve a non-existent Org,
+// or an Org as of a time before it was first recorded, results in a
+// rest.NotFoundError.
+func GetOrgAsOf(pubId string, at time.Time, ctx context.Context) (*Org, rest.RestError) {
+  return getOrgAsOfHelper(pubId, at, ctx, nil)
+}
+
+// GetOrgAsOfInTxn retrieves the Org as it stood at the given time in the
+// context of an existing transaction. See GetOrgAsOf.
+func GetOrgAsOfInTxn(pubId string, at time.Time, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  return getOrgAsOfHelper(pubId, at, ctx, txn)
+}
+
+func getOrgAsOfHelper(pubId string, at time.Time, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  stmt := getOrgAsOfQuery
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  var data []byte
+  if err := stmt.QueryRowContext(ctx, pubId, at.Unix()).Scan(&data); err == sql.ErrNoRows {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found as of %s.`, pubId, at.UTC().Format(time.RFC3339)), nil)
+  } else if err != nil {
+    return nil, rest.ServerError(`Error retrieving org version.`, err)
+  }
+
+  org, err := restoreSnapshot(data)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Problem reading version of org '%s'.`, pubId), err)
+  }
+  org.FormatOut()
+
+  return org, nil
+}
+
+// RevertOrg restores the Org, including its addresses, to the state it was in
+// at the given time. The revert is an ordinary update, so the restored state
+// is validated and audited as any other (see UpdateOrgInTxn). If a valid
+// version is given, the revert is only applied if the stored Org is at that
+// version. Attempting to revert an archived Org results in a
+// rest.NotFoundError.
+func RevertOrg(pubId string, at time.Time, version nulls.Int64, ctx context.Context) (*Org, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update org record.", err)
+  }
+
+  newO, restErr := RevertOrgInTxn(pubId, at, version, ctx, txn)
+  // txn already rolled back if in error, so we only need to commit if no error
+  if restErr == nil {
+    defer txn.Commit()
+  }
+
+  return newO, restErr
+}
+
+// RevertOrgInTxn restores the Org to the state it was in at the given time
+// within an existing transaction. See RevertOrg.
+func RevertOrgInTxn(pubId string, at time.Time, version nulls.Int64, ctx context.Context, txn *sql.Tx) (*Org, rest.RestError) {
+  current, restErr := GetOrgInTxn(pubId, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  prior, restErr := GetOrgAsOfInTxn(pubId, at, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if restErr := prior.Validate(ctx); restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  prior.Id = current.Id
+  prior.ArchivedAt = current.ArchivedAt
+  // The snapshot's own version is necessarily stale.
+  prior.Version = version
+
+  return UpdateOrgInTxn(prior, ctx, txn)
+}
+
+// BackfillVersions records a baseline version for each Org without any, such
+// as those written before versions were kept, dated to the Org's last update.
+// This should be run at startup so that every Org can be retrieved as of any
+// time since then (see GetOrgAsOf).
+func BackfillVersions(ctx context.Context) rest.RestError {
+  rows, err := listUnversionedOrgsQuery.QueryContext(ctx)
+  if err != nil {
+    return rest.ServerError(`Could not list unversioned orgs.`, err)
+  }
+  ids := make([]int64, 0)
+  for rows.Next() {
+    var id int64
+    if err := rows.Scan(&id); err != nil {
+      rows.Close()
+      return rest.ServerError(`Could not list unversioned orgs.`, err)
+    }
+    ids = append(ids, id)
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return rest.ServerError(`Could not list unversioned orgs.`, err)
+  }
+
+  for _, id := range ids {
+    txn, err := sqldb.DB.Begin()
+    if err != nil {
+      return rest.ServerError(`Could not backfill org versions. (txn error)`, err)
+    }
+    if restErr := backfillVersionInTxn(id, ctx, txn); restErr != nil {
+      return restErr
+    }
+    if err := txn.Commit(); err != nil {
+      return rest.ServerError(`Could not backfill org versions.`, err)
+    }
+  }
+
+  return nil
+}
+
+// backfillVersionInTxn records the baseline version of the Org, unless it has
+// been versioned in the meantime, rolling back the transaction on failure.
+func backfillVersionInTxn(id int64, ctx context.Context, txn *sql.Tx) rest.RestError {
+  // Locking the Org serializes the backfill with any concurrent write.
+  var unversioned bool
+  var lastUpdated int64
+  if err := txn.Stmt(lockUnversionedOrgQuery).QueryRowContext(ctx, id).Scan(&unversioned, &lastUpdated); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not check org versions.`, err)
+  }
+  if !unversioned {
+    return nil
+  }
+  org, restErr := GetOrgByIDInTxn(id, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return restErr
+  }
+  data, restErr := snapshotOrg(org)
+  if restErr != nil {
+    defer txn.Rollback()
+    return restErr
+  }
+  if _, err := txn.Stmt(createBaselineVersionQuery).ExecContext(ctx, id, lastUpdated, data); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not record org version.`, err)
+  }
+
+  return nil
+}
+
+const createVersionStatement = `INSERT INTO org_versions (org_id, snapshot) VALUES (?,?)`
+const listUnversionedOrgsStatement = `SELECT o.id FROM orgs o WHERE NOT EXISTS (SELECT 1 FROM org_versions v WHERE v.org_id=o.id)`
+const lockUnversionedOrgStatement = `SELECT NOT EXISTS (SELECT 1 FROM org_versions v WHERE v.org_id=o.id), e.last_updated FROM orgs o JOIN entities e ON o.id=e.id WHERE o.id=? FOR UPDATE`
+const createBaselineVersionStatement = `INSERT INTO org_versions (org_id, created_at, snapshot) VALUES (?,FROM_UNIXTIME(?),?)`
+var createVersionQuery, getOrgAsOfQuery, listUnversionedOrgsQuery, lockUnversionedOrgQuery, createBaselineVersionQuery *sql.Stmt
+
+func setupVersionsDB(db *sql.DB) {
+  var err error
+  if createVersionQuery, err = db.Prepare(createVersionStatement); err != nil {
+    log.Fatalf("mysql: prepare create version stmt: %v", err)
+  }
+  if getOrgAsOfQuery, err = db.Prepare(getOrgAsOfStatement); err != nil {
+    log.Fatalf("mysql: prepare get org as of stmt: %v", err)
+  }
+  if listUnversionedOrgsQuery, err = db.Prepare(listUnversionedOrgsStatement); err != nil {
+    log.Fatalf("mysql: prepare list unversioned orgs stmt: %v", err)
+  }
+  if lockUnversionedOrgQuery, err = db.Prepare(lockUnversionedOrgStatement); err != nil {
+    log.Fatalf("mysql: prepare lock unversioned org stmt: %v", err)
+  }
+  if createBaselineVersionQuery, err = db.Prepare(createBaselineVersionStatement); err != nil {
+    log.Fatalf("mysql: prepare create baseline version stmt: %v", err)
+  }
+}
@@ -0,0 +1,69 @@
+package orgs_test
+
+import (
+  "context"
+  "testing"
+  "time"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+func TestParseAsOf(t *testing.T) {
+  at, err := ParseAsOf(`1546300800`)
+  require.NoError(t, err, `Unexpected error parsing Unix seconds.`)
+  assert.Equal(t, int64(1546300800), at.Unix(), `Unexpected time from Unix seconds.`)
+  at, err = ParseAsOf(`2019-01-01T00:00:00Z`)
+  require.NoError(t, err, `Unexpected error parsing RFC 3339 timestamp.`)
+  assert.Equal(t, int64(1546300800), at.Unix(), `Unexpected time from RFC 3339 timestamp.`)
+  _, err = ParseAsOf(`yesterday`)
+  assert.Error(t, err, `Unexpected non-error for invalid time.`)
+}
+
+// testOrgAsOfSeeded runs before any test writes the test data Org, which
+// predates versioning and so is only covered by the backfilled baseline.
+func testOrgAsOfSeeded(t *testing.T) {
+  ctx := context.Background()
+  seeded, restErr := GetOrgAsOf(someOrgID, time.Now(), ctx)
+  require.NoError(t, restErr, `Unexpected error getting seeded org.`)
+  assert.Equal(t, `Some Org`, seeded.DisplayName.String, `Unexpected seeded display name.`)
+  _, restErr = GetOrgAsOf(someOrgID, time.Unix(0, 0), ctx)
+  assert.Error(t, restErr, `Unexpected non-error getting seeded org before baseline.`)
+}
+
+func testOrgAsOf(t *testing.T) {
+  ctx := context.Background()
+  versioned := someOrg.Clone()
+  versioned.SetDisplayName(`Versioned Org`)
+  versioned, restErr := CreateOrg(versioned, ctx)
+  require.NoError(t, restErr, `Unexpected error creating org.`)
+  pubId := versioned.PubId.String
+  // Versions are recorded to the second.
+  time.Sleep(time.Second)
+  before := time.Now()
+  time.Sleep(time.Second)
+
+  versioned.SetDisplayName(`Renamed Org`)
+  versioned.Version = nulls.NewNullInt64()
+  _, restErr = UpdateOrg(versioned, ctx)
+  require.NoError(t, restErr, `Unexpected error updating org.`)
+
+  past, restErr := GetOrgAsOf(pubId, before, ctx)
+  require.NoError(t, restErr, `Unexpected error getting past org.`)
+  assert.Equal(t, `Versioned Org`, past.DisplayName.String, `Unexpected past display name.`)
+  assert.Equal(t, versioned.LegalID, past.LegalID, `Legal ID not restored.`)
+  _, restErr = GetOrgAsOf(pubId, before.Add(-time.Hour), ctx)
+  assert.Error(t, restErr, `Unexpected non-error getting org before creation.`)
+
+  reverted, restErr := RevertOrg(pubId, before, nulls.NewNullInt64(), ctx)
+  require.NoError(t, restErr, `Unexpected error reverting org.`)
+  assert.Equal(t, `Versioned Org`, reverted.DisplayName.String, `Display name not reverted.`)
+  current, restErr := GetOrgAsOf(pubId, time.Now(), ctx)
+  require.NoError(t, restErr, `Unexpected error getting current version.`)
+  assert.Equal(t, `Versioned Org`, current.DisplayName.String, `Revert not versioned.`)
+
+  _, restErr = RevertOrg(pubId, before, nulls.NewInt64(reverted.Version.Int64 - 1), ctx)
+  assert.Error(t, restErr, `Unexpected non-error reverting stale org.`)
+}
@@ -0,0 +1,644 @@
+package orgs
+
+import (
+  "bytes"
+  "context"
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "log"
+  "net"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "syscall"
+  "time"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// Webhook is a subscription to have Org events of the given types POSTed to a
+// URL. A Webhook may be scoped to a single Org, otherwise it receives events
+// for all Orgs. The Secret, used to sign deliveries, is only revealed when the
+// Webhook is created.
+type Webhook struct {
+  Id         int64        `json:"id"`
+  URL        string       `json:"url"`
+  EventTypes []EventType  `json:"eventTypes"`
+  OrgPubId   nulls.String `json:"orgPubId"`
+  Secret     string       `json:"secret,omitempty"`
+  CreatedAt  int64        `json:"createdAt"`
+}
+
+// Matches is true if the Webhook subscribes to the event.
+func (h *Webhook) Matches(e *Event) bool {
+  if h.OrgPubId.Valid && !strings.EqualFold(h.OrgPubId.String, e.OrgPubId) {
+    return false
+  }
+  for _, eventType := range h.EventTypes {
+    if eventType == e.Type {
+      return true
+    }
+  }
+  return false
+}
+
+// Validate checks a new Webhook. The URL must be an absolute 'https' URL
+// which does not name a non-public host (see WebhookAllowPrivateNetworks),
+// the secret, if given, may be at most 128 characters, and at least one known
+// event type is required.
+func (h *Webhook) Validate() rest.RestError {
+  u, err := url.Parse(h.URL)
+  if err != nil || u.Scheme != `https` || u.Host == `` {
+    return NewFieldError(`url`, `must be an absolute https URL`)
+  }
+  if len(h.URL) > maxURLLength {
+    return NewFieldError(`url`, fmt.Sprintf(`may be at most %d characters`, maxURLLength))
+  }
+  if !WebhookAllowPrivateNetworks {
+    // Names are checked again as they are resolved; see webhookDialControl.
+    host := strings.TrimSuffix(strings.ToLower(u.Hostname()), `.`)
+    if ip := net.ParseIP(host); (ip != nil && !publicAddress(ip)) || host == `localhost` || strings.HasSuffix(host, `.localhost`) {
+      return NewFieldError(`url`, `may not name a loopback, private, or link-local host`)
+    }
+  }
+  if len(h.Secret) > maxWebhookSecretLength {
+    return NewFieldError(`secret`, fmt.Sprintf(`may be at most %d characters`, maxWebhookSecretLength))
+  }
+  if len(h.EventTypes) == 0 {
+    return NewFieldError(`eventTypes`, `at least one event type is required`)
+  }
+  for _, eventType := range h.EventTypes {
+    if _, ok := eventTypeNames[eventType]; !ok {
+      return NewFieldError(`eventTypes`, fmt.Sprintf(`unknown event type '%s'`, eventType))
+    }
+  }
+
+  return nil
+}
+
+const maxWebhookSecretLength = 128
+
+var eventTypeNames = map[EventType]bool{
+  EventOrgCreated: true,
+  EventOrgUpdated: true,
+  EventOrgArchived: true,
+  EventOrgRestored: true,
+}
+
+// WebhookDelivery records the delivery of a single event to a Webhook. Times
+// are in Unix seconds. Status is the HTTP status of the last attempt, if a
+// response was received.
+type WebhookDelivery struct {
+  Id          int64        `json:"id"`
+  EventId     int64        `json:"eventId"`
+  EventType   EventType    `json:"eventType"`
+  Attempts    int          `json:"attempts"`
+  Status      nulls.Int64  `json:"status"`
+  Error       nulls.String `json:"error"`
+  CreatedAt   int64        `json:"createdAt"`
+  DeliveredAt nulls.Int64  `json:"deliveredAt"`
+  // FailedAt is set once a delivery has exhausted WebhookMaxAttempts.
+  FailedAt    nulls.Int64  `json:"failedAt"`
+}
+
+// Headers set on webhook deliveries.
+const (
+  WebhookEventHeader     = `X-Orgs-Event`
+  WebhookDeliveryHeader  = `X-Orgs-Delivery`
+  WebhookTimestampHeader = `X-Orgs-Timestamp`
+  WebhookSignatureHeader = `X-Orgs-Signature`
+)
+
+// SignWebhook computes the signature header value for a delivery: 'sha256='
+// followed by the hex HMAC-SHA256, keyed by the Webhook secret, of the
+// timestamp header value, a '.', and the body.
+func SignWebhook(secret string, timestamp string, body []byte) string {
+  mac := hmac.New(sha256.New, []byte(secret))
+  io.WriteString(mac, timestamp + `.`)
+  mac.Write(body)
+  return `sha256=` + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a delivery signature, as a receiver would.
+func VerifyWebhookSignature(secret string, timestamp string, body []byte, signature string) bool {
+  return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
+
+func newWebhookSecret() (string, error) {
+  secret := make([]byte, 32)
+  if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+    return ``, err
+  }
+  return hex.EncodeToString(secret), nil
+}
+
+// WebhookAllowPrivateNetworks permits webhooks to name, and deliveries to be
+// made to, loopback, private, link-local, and other non-public addresses.
+// It is off so that webhooks cannot be used to reach internal services, and
+// is meant only for development and testing.
+var WebhookAllowPrivateNetworks = false
+
+// nonPublicNetworks are the networks to which webhooks may not be delivered.
+var nonPublicNetworks = make([]*net.IPNet, 0)
+
+func init() {
+  for _, cidr := range []string{
+    `0.0.0.0/8`, `10.0.0.0/8`, `100.64.0.0/10`, `127.0.0.0/8`, `169.254.0.0/16`,
+    `172.16.0.0/12`, `192.0.0.0/24`, `192.168.0.0/16`, `198.18.0.0/15`,
+    `224.0.0.0/4`, `240.0.0.0/4`,
+    `::/128`, `::1/128`, `64:ff9b::/96`, `fc00::/7`, `fe80::/10`, `ff00::/8`,
+  } {
+    _, network, _ := net.ParseCIDR(cidr)
+    nonPublicNetworks = append(nonPublicNetworks, network)
+  }
+}
+
+// publicAddress is false for addresses within the nonPublicNetworks,
+// including their IPv4-mapped IPv6 forms.
+func publicAddress(ip net.IP) bool {
+  if ip4 := ip.To4(); ip4 != nil {
+    ip = ip4
+  }
+  for _, network := range nonPublicNetworks {
+    if network.Contains(ip) {
+      return false
+    }
+  }
+  return true
+}
+
+// webhookDialControl refuses connections to non-public addresses unless
+// WebhookAllowPrivateNetworks is set. It's checked as each connection is
+// made, after the name is resolved, so a name cannot be re-pointed at an
+// internal address once the webhook is created.
+func webhookDialControl(network string, address string, c syscall.RawConn) error {
+  if WebhookAllowPrivateNetworks {
+    return nil
+  }
+  host, _, err := net.SplitHostPort(address)
+  if err != nil {
+    return err
+  }
+  if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+    return fmt.Errorf(`webhook delivery to non-public address '%s' refused`, host)
+  }
+  return nil
+}
+
+// WebhookSender POSTs signed webhook deliveries.
+type WebhookSender struct {
+  Client *http.Client
+}
+
+// NewWebhookSender creates a WebhookSender which gives up on receivers after
+// ten seconds. It connects directly, ignoring any proxy, only to public
+// addresses (see WebhookAllowPrivateNetworks), and does not follow redirects.
+func NewWebhookSender() *WebhookSender {
+  dialer := &net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}
+  transport := &http.Transport{
+    DialContext:         dialer.DialContext,
+    TLSHandshakeTimeout: 5 * time.Second,
+    MaxIdleConns:        100,
+    IdleConnTimeout:     90 * time.Second,
+  }
+  return &WebhookSender{&http.Client{
+    Transport: transport,
+    Timeout:   10 * time.Second,
+    // The redirect response is treated as any other non-2xx response.
+    CheckRedirect: func(req *http.Request, via []*http.Request) error {
+      return http.ErrUseLastResponse
+    },
+  }}
+}
+
+// Send POSTs the JSON body to the URL, returning the response status. Any
+// non-2xx response is an error.
+func (s *WebhookSender) Send(url string, secret string, eventType EventType, deliveryId int64, body []byte, ctx context.Context) (int, error) {
+  req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+  if err != nil {
+    return 0, err
+  }
+  timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+  req.Header.Set(`Content-Type`, `application/json`)
+  req.Header.Set(WebhookEventHeader, string(eventType))
+  req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(deliveryId, 10))
+  req.Header.Set(WebhookTimestampHeader, timestamp)
+  req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+
+  resp, err := s.Client.Do(req.WithContext(ctx))
+  if err != nil {
+    return 0, err
+  }
+  defer resp.Body.Close()
+  // Drain (a little of) the body so the connection may be reused.
+  io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+  if resp.StatusCode < 200 || resp.StatusCode > 299 {
+    return resp.StatusCode, fmt.Errorf(`receiver responded '%s'`, resp.Status)
+  }
+
+  return resp.StatusCode, nil
+}
+
+// CreateWebhook adds a Webhook subscription, generating its secret unless
+// one is given. The secret is stored encrypted with the same key set as legal
+// IDs (see KeyProvider), so rotating those keys covers both. Invalid Webhooks
+// result in a FieldError and scoping to a non-existent Org results in a
+// rest.NotFoundError.
+func CreateWebhook(h *Webhook, ctx context.Context) (*Webhook, rest.RestError) {
+  if restErr := h.Validate(); restErr != nil {
+    return nil, restErr
+  }
+  secret := h.Secret
+  if secret == `` {
+    var err error
+    if secret, err = newWebhookSecret(); err != nil {
+      return nil, rest.ServerError(`Could not generate webhook secret.`, err)
+    }
+  }
+  storedSecret, err := encryptAtRest(secret)
+  if err != nil {
+    return nil, rest.ServerError(`Could not encrypt webhook secret.`, err)
+  }
+  orgId := nulls.NewNullInt64()
+  if h.OrgPubId.Valid {
+    var id int64
+    if err := getOrgIdQuery.QueryRowContext(ctx, h.OrgPubId.String).Scan(&id); err == sql.ErrNoRows {
+      return nil, rest.NotFoundError(fmt.Sprintf(`Org '%s' not found.`, h.OrgPubId.String), nil)
+    } else if err != nil {
+      return nil, rest.ServerError(`Could not resolve org.`, err)
+    }
+    orgId = nulls.NewInt64(id)
+  }
+
+  eventTypes := make([]string, len(h.EventTypes))
+  for i, eventType := range h.EventTypes {
+    eventTypes[i] = string(eventType)
+  }
+  res, err := createWebhookQuery.ExecContext(ctx, h.URL, strings.Join(eventTypes, `,`), orgId, storedSecret)
+  if err != nil {
+    return nil, rest.ServerError(`Could not create webhook.`, err)
+  }
+  id, err := res.LastInsertId()
+  if err != nil {
+    return nil, rest.ServerError(`Could not create webhook.`, err)
+  }
+
+  hook, restErr := GetWebhook(id, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  hook.Secret = secret
+
+  return hook, nil
+}
+
+const commonWebhookGet = `SELECT w.id, w.url, w.event_types, oe.pub_id, UNIX_TIMESTAMP(w.created_at) FROM org_webhooks w LEFT JOIN entities oe ON w.org_id=oe.id `
+
+func scanWebhook(rows *sql.Rows) (*Webhook, error) {
+  var h Webhook
+  var eventTypes string
+  if err := rows.Scan(&h.Id, &h.URL, &eventTypes, &h.OrgPubId, &h.CreatedAt); err != nil {
+    return nil, err
+  }
+  h.EventTypes = make([]EventType, 0)
+  for _, eventType := range strings.Split(eventTypes, `,`) {
+    h.EventTypes = append(h.EventTypes, EventType(eventType))
+  }
+
+  return &h, nil
+}
+
+func queryWebhooks(stmt *sql.Stmt, ctx context.Context, args ...interface{}) ([]*Webhook, rest.RestError) {
+  rows, err := stmt.QueryContext(ctx, args...)
+  if err != nil {
+    return nil, rest.ServerError(`Error retrieving webhooks.`, err)
+  }
+  defer rows.Close()
+
+  hooks := make([]*Webhook, 0)
+  for rows.Next() {
+    hook, err := scanWebhook(rows)
+    if err != nil {
+      return nil, rest.ServerError(`Problem getting data for webhooks.`, err)
+    }
+    hooks = append(hooks, hook)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, rest.ServerError(`Problem getting data for webhooks.`, err)
+  }
+
+  return hooks, nil
+}
+
+// GetWebhook retrieves a Webhook, without its secret. Attempting to retrieve a
+// non-existent Webhook results in a rest.NotFoundError.
+func GetWebhook(id int64, ctx context.Context) (*Webhook, rest.RestError) {
+  hooks, restErr := queryWebhooks(getWebhookQuery, ctx, id)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if len(hooks) == 0 {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Webhook '%d' not found.`, id), nil)
+  }
+
+  return hooks[0], nil
+}
+
+// ListWebhooks retrieves the Webhooks scoped to the Org or, given an empty
+// orgPubId, those for all Orgs.
+func ListWebhooks(orgPubId string, ctx context.Context) ([]*Webhook, rest.RestError) {
+  if orgPubId == `` {
+    return queryWebhooks(listGlobalWebhooksQuery, ctx)
+  }
+  return queryWebhooks(listOrgWebhooksQuery, ctx, orgPubId)
+}
+
+// DeleteWebhook removes a Webhook along with its delivery log. Attempting to
+// delete a non-existent Webhook results in a rest.NotFoundError.
+func DeleteWebhook(id int64, ctx context.Context) rest.RestError {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError("Could not delete webhook. (txn error)", err)
+  }
+  if _, err := txn.Stmt(deleteWebhookDeliveriesQuery).ExecContext(ctx, id); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not delete webhook.`, err)
+  }
+  res, err := txn.Stmt(deleteWebhookQuery).ExecContext(ctx, id)
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not delete webhook.`, err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(`Could not delete webhook.`, err)
+  } else if count == 0 {
+    defer txn.Rollback()
+    return rest.NotFoundError(fmt.Sprintf(`Webhook '%d' not found.`, id), nil)
+  }
+  defer txn.Commit()
+
+  return nil
+}
+
+// ListWebhookDeliveries retrieves the most recent deliveries to the Webhook,
+// most recent first.
+func ListWebhookDeliveries(id int64, limit int64, ctx context.Context) ([]*WebhookDelivery, rest.RestError) {
+  if limit <= 0 {
+    limit = DefaultListLimit
+  } else if limit > MaxListLimit {
+    limit = MaxListLimit
+  }
+  rows, err := listWebhookDeliveriesQuery.QueryContext(ctx, id, limit)
+  if err != nil {
+    return nil, rest.ServerError(`Error retrieving webhook deliveries.`, err)
+  }
+  defer rows.Close()
+
+  deliveries := make([]*WebhookDelivery, 0)
+  for rows.Next() {
+    var d WebhookDelivery
+    if err := rows.Scan(&d.Id, &d.EventId, &d.EventType, &d.Attempts, &d.Status, &d.Error, &d.CreatedAt, &d.DeliveredAt, &d.FailedAt); err != nil {
+      return nil, rest.ServerError(`Problem getting data for webhook deliveries.`, err)
+    }
+    deliveries = append(deliveries, &d)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, rest.ServerError(`Problem getting data for webhook deliveries.`, err)
+  }
+
+  return deliveries, nil
+}
+
+// WebhookSink is an EventSink queuing deliveries of each event to the
+// matching Webhooks. Queuing is idempotent, so redelivered events are only
+// sent once. The deliveries are sent by a WebhookDeliverer.
+type WebhookSink struct{}
+
+func (WebhookSink) HandleEvent(e *Event, ctx context.Context) error {
+  hooks, restErr := queryWebhooks(listCandidateWebhooksQuery, ctx, e.OrgPubId)
+  if restErr != nil {
+    return restErr
+  }
+  var body []byte
+  for _, hook := range hooks {
+    if !hook.Matches(e) {
+      continue
+    }
+    if body == nil {
+      var err error
+      if body, err = json.Marshal(e.Org); err != nil {
+        return err
+      }
+    }
+    if _, err := queueWebhookDeliveryQuery.ExecContext(ctx, hook.Id, e.Id, e.Type, body); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// WebhookRetryBaseDelay and WebhookRetryMaxDelay bound the exponential
+// backoff between delivery attempts. After WebhookMaxAttempts, the delivery
+// is abandoned.
+var WebhookRetryBaseDelay = 10 * time.Second
+var WebhookRetryMaxDelay = 6 * time.Hour
+var WebhookMaxAttempts = 12
+
+// WebhookRetryDelay is the delay before retrying a webhook delivery which has
+// failed the given number of attempts.
+func WebhookRetryDelay(attempts int) time.Duration {
+  return retryDelay(WebhookRetryBaseDelay, WebhookRetryMaxDelay, attempts)
+}
+
+// webhookLease is how long a WebhookDeliverer has to make an attempt before
+// the delivery may be claimed by another.
+const webhookLease = time.Minute
+
+// WebhookDeliverer sends the queued webhook deliveries.
+type WebhookDeliverer struct {
+  Sender    *WebhookSender
+  // Interval is the time between polls of the delivery queue.
+  Interval  time.Duration
+  // BatchSize limits the number of deliveries claimed per poll.
+  BatchSize int
+}
+
+// NewWebhookDeliverer creates a WebhookDeliverer polling every second.
+func NewWebhookDeliverer() *WebhookDeliverer {
+  return &WebhookDeliverer{NewWebhookSender(), time.Second, 20}
+}
+
+type pendingDelivery struct {
+  id        int64
+  url       string
+  secret    string
+  eventType EventType
+  attempts  int
+  payload   []byte
+}
+
+// DeliverPending makes an attempt at each of a batch of due deliveries,
+// returning the number of attempts made.
+func (d *WebhookDeliverer) DeliverPending(ctx context.Context) (int, error) {
+  pending, err := d.claim(ctx)
+  if err != nil {
+    return 0, err
+  }
+  for _, p := range pending {
+    var status int
+    secret, sendErr := decryptAtRest(p.secret)
+    if sendErr == nil {
+      status, sendErr = d.Sender.Send(p.url, secret, p.eventType, p.id, p.payload, ctx)
+    }
+    statusValue := nulls.NewNullInt64()
+    if status != 0 {
+      statusValue = nulls.NewInt64(int64(status))
+    }
+    if sendErr == nil {
+      _, err = deliveredWebhookQuery.ExecContext(ctx, statusValue, p.id)
+    } else if p.attempts + 1 >= WebhookMaxAttempts {
+      log.Printf("Abandoning webhook delivery %d after %d attempts: %s", p.id, p.attempts + 1, sendErr)
+      _, err = abandonWebhookQuery.ExecContext(ctx, statusValue, lastError(sendErr), p.id)
+    } else {
+      delay := WebhookRetryDelay(p.attempts + 1)
+      _, err = retryWebhookQuery.ExecContext(ctx, statusValue, lastError(sendErr), int64(delay / time.Second), p.id)
+    }
+    if err != nil {
+      return 0, err
+    }
+  }
+
+  return len(pending), nil
+}
+
+// claim leases a batch of due deliveries.
+func (d *WebhookDeliverer) claim(ctx context.Context) ([]*pendingDelivery, error) {
+  txn, err := sqldb.DB.BeginTx(ctx, nil)
+  if err != nil {
+    return nil, err
+  }
+  defer txn.Rollback()
+
+  rows, err := txn.Stmt(claimWebhookDeliveriesQuery).QueryContext(ctx, d.BatchSize)
+  if err != nil {
+    return nil, err
+  }
+  pending := make([]*pendingDelivery, 0)
+  for rows.Next() {
+    var p pendingDelivery
+    if err := rows.Scan(&p.id, &p.url, &p.secret, &p.eventType, &p.attempts, &p.payload); err != nil {
+      rows.Close()
+      return nil, err
+    }
+    pending = append(pending, &p)
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  for _, p := range pending {
+    if _, err := txn.Stmt(leaseWebhookDeliveryQuery).ExecContext(ctx, int64(webhookLease / time.Second), p.id); err != nil {
+      return nil, err
+    }
+  }
+
+  return pending, txn.Commit()
+}
+
+// Run polls the delivery queue, sending deliveries, until the context is
+// done.
+func (d *WebhookDeliverer) Run(ctx context.Context) {
+  ticker := time.NewTicker(d.Interval)
+  defer ticker.Stop()
+  for {
+    for {
+      count, err := d.DeliverPending(ctx)
+      if err != nil {
+        log.Printf("Could not deliver org webhooks: %s", err)
+      }
+      if err != nil || count < d.BatchSize {
+        break
+      }
+    }
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+const createWebhookStatement = `INSERT INTO org_webhooks (url, event_types, org_id, secret) VALUES (?,?,?,?)`
+const getWebhookStatement = commonWebhookGet + `WHERE w.id=?`
+const listGlobalWebhooksStatement = commonWebhookGet + `WHERE w.org_id IS NULL ORDER BY w.id`
+const listOrgWebhooksStatement = commonWebhookGet + `WHERE oe.pub_id=? ORDER BY w.id`
+const listCandidateWebhooksStatement = commonWebhookGet + `WHERE w.org_id IS NULL OR oe.pub_id=?`
+const deleteWebhookStatement = `DELETE FROM org_webhooks WHERE id=?`
+const deleteWebhookDeliveriesStatement = `DELETE FROM org_webhook_deliveries WHERE webhook_id=?`
+const queueWebhookDeliveryStatement = `INSERT IGNORE INTO org_webhook_deliveries (webhook_id, event_id, event_type, payload) VALUES (?,?,?,?)`
+const listWebhookDeliveriesStatement = `SELECT id, event_id, event_type, attempts, last_status, last_error, UNIX_TIMESTAMP(created_at), UNIX_TIMESTAMP(delivered_at), UNIX_TIMESTAMP(failed_at) FROM org_webhook_deliveries WHERE webhook_id=? ORDER BY id DESC LIMIT ?`
+const claimWebhookDeliveriesStatement = `SELECT d.id, w.url, w.secret, d.event_type, d.attempts, d.payload FROM org_webhook_deliveries d JOIN org_webhooks w ON d.webhook_id=w.id WHERE d.delivered_at IS NULL AND d.failed_at IS NULL AND d.next_attempt_at <= NOW() ORDER BY d.id LIMIT ? FOR UPDATE SKIP LOCKED`
+const leaseWebhookDeliveryStatement = `UPDATE org_webhook_deliveries SET next_attempt_at=NOW() + INTERVAL ? SECOND WHERE id=?`
+const deliveredWebhookStatement = `UPDATE org_webhook_deliveries SET attempts=attempts+1, last_status=?, last_error=NULL, delivered_at=NOW() WHERE id=?`
+const retryWebhookStatement = `UPDATE org_webhook_deliveries SET attempts=attempts+1, last_status=?, last_error=?, next_attempt_at=NOW() + INTERVAL ? SECOND WHERE id=?`
+const abandonWebhookStatement = `UPDATE org_webhook_deliveries SET attempts=attempts+1, last_status=?, last_error=?, failed_at=NOW() WHERE id=?`
+var createWebhookQuery, getWebhookQuery, listGlobalWebhooksQuery, listOrgWebhooksQuery, listCandidateWebhooksQuery, deleteWebhookQuery, deleteWebhookDeliveriesQuery, queueWebhookDeliveryQuery, listWebhookDeliveriesQuery, claimWebhookDeliveriesQuery, leaseWebhookDeliveryQuery, deliveredWebhookQuery, retryWebhookQuery, abandonWebhookQuery *sql.Stmt
+
+func setupWebhooksDB(db *sql.DB) {
+  var err error
+  if createWebhookQuery, err = db.Prepare(createWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare create webhook stmt: %v", err)
+  }
+  if getWebhookQuery, err = db.Prepare(getWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare get webhook stmt: %v", err)
+  }
+  if listGlobalWebhooksQuery, err = db.Prepare(listGlobalWebhooksStatement); err != nil {
+    log.Fatalf("mysql: prepare list global webhooks stmt: %v", err)
+  }
+  if listOrgWebhooksQuery, err = db.Prepare(listOrgWebhooksStatement); err != nil {
+    log.Fatalf("mysql: prepare list org webhooks stmt: %v", err)
+  }
+  if listCandidateWebhooksQuery, err = db.Prepare(listCandidateWebhooksStatement); err != nil {
+    log.Fatalf("mysql: prepare list candidate webhooks stmt: %v", err)
+  }
+  if deleteWebhookQuery, err = db.Prepare(deleteWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare delete webhook stmt: %v", err)
+  }
+  if deleteWebhookDeliveriesQuery, err = db.Prepare(deleteWebhookDeliveriesStatement); err != nil {
+    log.Fatalf("mysql: prepare delete webhook deliveries stmt: %v", err)
+  }
+  if queueWebhookDeliveryQuery, err = db.Prepare(queueWebhookDeliveryStatement); err != nil {
+    log.Fatalf("mysql: prepare queue webhook delivery stmt: %v", err)
+  }
+  if listWebhookDeliveriesQuery, err = db.Prepare(listWebhookDeliveriesStatement); err != nil {
+    log.Fatalf("mysql: prepare list webhook deliveries stmt: %v", err)
+  }
+  if claimWebhookDeliveriesQuery, err = db.Prepare(claimWebhookDeliveriesStatement); err != nil {
+    log.Fatalf("mysql: prepare claim webhook deliveries stmt: %v", err)
+  }
+  if leaseWebhookDeliveryQuery, err = db.Prepare(leaseWebhookDeliveryStatement); err != nil {
+    log.Fatalf("mysql: prepare lease webhook delivery stmt: %v", err)
+  }
+  if deliveredWebhookQuery, err = db.Prepare(deliveredWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare delivered webhook stmt: %v", err)
+  }
+  if retryWebhookQuery, err = db.Prepare(retryWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare retry webhook stmt: %v", err)
+  }
+  if abandonWebhookQuery, err = db.Prepare(abandonWebhookStatement); err != nil {
+    log.Fatalf("mysql: prepare abandon webhook stmt: %v", err)
+  }
+}
@@ -0,0 +1,129 @@
+package orgs
+
+import (
+  "fmt"
+  "net/http"
+  "strconv"
+
+  "github.com/gorilla/mux"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/handlers"
+  "github.com/Liquid-Labs/catalyst-firewrap/go/fireauth"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// authorizeWebhook retrieves the Webhook identified in the request path and
+// checks that the Principal making the request may manage it. Any error
+// response is handled.
+func authorizeWebhook(w http.ResponseWriter, r *http.Request, authClient *fireauth.ScopedClient) (*Webhook, rest.RestError) {
+  vars := mux.Vars(r)
+  id, err := strconv.ParseInt(vars["webhookId"], 10, 64)
+  if err != nil {
+    restErr := rest.BadRequestError(fmt.Sprintf(`Invalid webhook ID '%s'.`, vars["webhookId"]), err)
+    rest.HandleError(w, restErr)
+    return nil, restErr
+  }
+  hook, restErr := GetWebhook(id, r.Context())
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return nil, restErr
+  }
+  if _, restErr := authorizeRequest(w, r, authClient, ActionManageWebhooks, hook.OrgPubId.String); restErr != nil {
+    return nil, restErr
+  }
+
+  return hook, nil
+}
+
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+  var hook *Webhook = &Webhook{}
+  if authClient, restErr := handlers.CheckAndExtract(w, r, hook, `Webhook`); restErr != nil {
+    return // response handled by CheckAndExtract
+  } else if _, restErr := authorizeRequest(w, r, authClient, ActionManageWebhooks, hook.OrgPubId.String); restErr != nil {
+    return // response handled by authorizeRequest
+  } else {
+    hook, restErr := CreateWebhook(hook, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, hook, `Webhook created.`, nil)
+  }
+}
+
+// listWebhooksHandler lists the Webhooks scoped to the Org given by the
+// 'orgPubId' query parameter or, lacking that, those covering all Orgs.
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else {
+    orgPubID := r.URL.Query().Get(`orgPubId`)
+    if _, restErr := authorizeRequest(w, r, authClient, ActionManageWebhooks, orgPubID); restErr != nil {
+      return // response handled by authorizeRequest
+    }
+
+    hooks, restErr := ListWebhooks(orgPubID, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, hooks, `Webhooks retrieved.`, nil)
+  }
+}
+
+func webhookDetailHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if hook, restErr := authorizeWebhook(w, r, authClient); restErr != nil {
+    return // response handled by authorizeWebhook
+  } else {
+    rest.StandardResponse(w, hook, `Webhook retrieved.`, nil)
+  }
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if hook, restErr := authorizeWebhook(w, r, authClient); restErr != nil {
+    return // response handled by authorizeWebhook
+  } else {
+    if restErr := DeleteWebhook(hook.Id, r.Context()); restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, nil, `Webhook deleted.`, nil)
+  }
+}
+
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+  if authClient, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  } else if hook, restErr := authorizeWebhook(w, r, authClient); restErr != nil {
+    return // response handled by authorizeWebhook
+  } else {
+    params, restErr := extractListParams(r)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    deliveries, restErr := ListWebhookDeliveries(hook.Id, params.Limit, r.Context())
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    rest.StandardResponse(w, deliveries, `Webhook deliveries retrieved.`, nil)
+  }
+}
+
+func initWebhooksAPI(r *mux.Router) {
+  r.HandleFunc("/orgs/webhooks/", createWebhookHandler).Methods("POST")
+  r.HandleFunc("/orgs/webhooks/", listWebhooksHandler).Methods("GET")
+  r.HandleFunc("/orgs/webhooks/{webhookId:[0-9]+}/", webhookDetailHandler).Methods("GET")
+  r.HandleFunc("/orgs/webhooks/{webhookId:[0-9]+}/", deleteWebhookHandler).Methods("DELETE")
+  r.HandleFunc("/orgs/webhooks/{webhookId:[0-9]+}/deliveries/", webhookDeliveriesHandler).Methods("GET")
+}
@@ -0,0 +1,172 @@
+package orgs_test
+
+import (
+  "context"
+  "encoding/json"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "sync"
+  "testing"
+
+  . "github.com/Liquid-Labs/catalyst-orgs-api/go/resources/orgs"
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/stretchr/testify/assert"
+  "github.com/stretchr/testify/require"
+)
+
+// webhookReceiver records the verified deliveries made to it.
+type webhookReceiver struct {
+  secret string
+  status int
+  mu     sync.Mutex
+  bodies [][]byte
+  events []string
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  body, _ := ioutil.ReadAll(r.Body)
+  if !VerifyWebhookSignature(rcv.secret, r.Header.Get(WebhookTimestampHeader), body, r.Header.Get(WebhookSignatureHeader)) {
+    w.WriteHeader(http.StatusUnauthorized)
+    return
+  }
+  rcv.mu.Lock()
+  rcv.bodies = append(rcv.bodies, body)
+  rcv.events = append(rcv.events, r.Header.Get(WebhookEventHeader))
+  rcv.mu.Unlock()
+  w.WriteHeader(rcv.status)
+}
+
+// trustingSender creates a WebhookSender trusting the test server's
+// certificate.
+func trustingSender(server *httptest.Server) *WebhookSender {
+  sender := NewWebhookSender()
+  sender.Client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+  return sender
+}
+
+func TestWebhookSenderSend(t *testing.T) {
+  rcv := &webhookReceiver{secret: `shh`, status: http.StatusNoContent}
+  server := httptest.NewTLSServer(rcv)
+  defer server.Close()
+  sender := trustingSender(server)
+
+  _, err := sender.Send(server.URL, `shh`, EventOrgUpdated, 1, []byte(`{}`), context.Background())
+  assert.Error(t, err, `Unexpected non-error sending to loopback address.`)
+  assert.Empty(t, rcv.bodies, `Unexpected delivery to loopback address.`)
+
+  defer func(allow bool) { WebhookAllowPrivateNetworks = allow }(WebhookAllowPrivateNetworks)
+  WebhookAllowPrivateNetworks = true
+  status, err := sender.Send(server.URL, `shh`, EventOrgUpdated, 1, []byte(`{"displayName":"Foo"}`), context.Background())
+  require.NoError(t, err, `Unexpected error sending webhook.`)
+  assert.Equal(t, http.StatusNoContent, status, `Unexpected status.`)
+  require.Len(t, rcv.bodies, 1, `Delivery not verified.`)
+  assert.JSONEq(t, `{"displayName":"Foo"}`, string(rcv.bodies[0]), `Unexpected body.`)
+  assert.Equal(t, string(EventOrgUpdated), rcv.events[0], `Unexpected event header.`)
+
+  status, err = sender.Send(server.URL, `wrong`, EventOrgUpdated, 2, []byte(`{}`), context.Background())
+  assert.Error(t, err, `Unexpected non-error for rejected delivery.`)
+  assert.Equal(t, http.StatusUnauthorized, status, `Unexpected status.`)
+}
+
+func TestWebhookSenderRedirect(t *testing.T) {
+  defer func(allow bool) { WebhookAllowPrivateNetworks = allow }(WebhookAllowPrivateNetworks)
+  WebhookAllowPrivateNetworks = true
+  rcv := &webhookReceiver{secret: `shh`, status: http.StatusNoContent}
+  mux := http.NewServeMux()
+  mux.Handle(`/hook`, rcv)
+  mux.Handle(`/moved`, http.RedirectHandler(`/hook`, http.StatusTemporaryRedirect))
+  server := httptest.NewTLSServer(mux)
+  defer server.Close()
+
+  status, err := trustingSender(server).Send(server.URL + `/moved`, `shh`, EventOrgUpdated, 1, []byte(`{}`), context.Background())
+  assert.Error(t, err, `Unexpected non-error for redirect.`)
+  assert.Equal(t, http.StatusTemporaryRedirect, status, `Unexpected status.`)
+  assert.Empty(t, rcv.bodies, `Redirect followed.`)
+}
+
+func TestWebhookSignature(t *testing.T) {
+  signature := SignWebhook(`shh`, `1546300800`, []byte(`{}`))
+  assert.True(t, VerifyWebhookSignature(`shh`, `1546300800`, []byte(`{}`), signature), `Signature not verified.`)
+  assert.False(t, VerifyWebhookSignature(`shh`, `1546300801`, []byte(`{}`), signature), `Signature verified with wrong timestamp.`)
+  assert.False(t, VerifyWebhookSignature(`shh`, `1546300800`, []byte(`{ }`), signature), `Signature verified with wrong body.`)
+}
+
+func TestWebhookMatches(t *testing.T) {
+  hook := &Webhook{EventTypes: []EventType{EventOrgCreated}}
+  assert.True(t, hook.Matches(&Event{Type: EventOrgCreated, OrgPubId: `a`}), `Unscoped webhook did not match.`)
+  assert.False(t, hook.Matches(&Event{Type: EventOrgUpdated, OrgPubId: `a`}), `Webhook matched other event type.`)
+  hook.OrgPubId = nulls.NewString(`B`)
+  assert.True(t, hook.Matches(&Event{Type: EventOrgCreated, OrgPubId: `b`}), `Scoped webhook did not match.`)
+  assert.False(t, hook.Matches(&Event{Type: EventOrgCreated, OrgPubId: `a`}), `Scoped webhook matched other org.`)
+}
+
+func TestWebhookValidate(t *testing.T) {
+  hook := &Webhook{URL: `https://example.com/hook`, EventTypes: []EventType{EventOrgCreated}}
+  assert.NoError(t, hook.Validate(), `Unexpected error validating webhook.`)
+  for _, invalid := range []*Webhook{
+    &Webhook{URL: `/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `ftp://example.com/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `http://example.com/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://127.0.0.1/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://10.1.2.3/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://169.254.169.254/latest/meta-data`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://[::1]/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://[::ffff:192.168.0.1]/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: `https://localhost/hook`, EventTypes: hook.EventTypes},
+    &Webhook{URL: hook.URL},
+    &Webhook{URL: hook.URL, EventTypes: []EventType{`OrgEaten`}},
+  } {
+    restErr := invalid.Validate()
+    if assert.Errorf(t, restErr, `Unexpected non-error validating %+v.`, invalid) {
+      assert.Equal(t, http.StatusUnprocessableEntity, restErr.Code(), `Unexpected error code.`)
+    }
+  }
+}
+
+func testOrgWebhooks(t *testing.T) {
+  ctx := context.Background()
+  defer func(allow bool) { WebhookAllowPrivateNetworks = allow }(WebhookAllowPrivateNetworks)
+  WebhookAllowPrivateNetworks = true
+  rcv := &webhookReceiver{secret: `shh`, status: http.StatusOK}
+  server := httptest.NewTLSServer(rcv)
+  defer server.Close()
+
+  hook, restErr := CreateWebhook(&Webhook{URL: server.URL, EventTypes: []EventType{EventOrgUpdated}, OrgPubId: nulls.NewString(someOrgID), Secret: `shh`}, ctx)
+  require.NoError(t, restErr, `Unexpected error creating webhook.`)
+  hooks, restErr := ListWebhooks(someOrgID, ctx)
+  require.NoError(t, restErr, `Unexpected error listing webhooks.`)
+  require.Len(t, hooks, 1, `Unexpected number of webhooks.`)
+  assert.Empty(t, hooks[0].Secret, `Secret revealed in listing.`)
+  var stored string
+  require.NoError(t, sqldb.DB.QueryRow(`SELECT secret FROM org_webhooks WHERE id=?`, hook.Id).Scan(&stored), `Unexpected error reading stored secret.`)
+  assert.NotContains(t, stored, `shh`, `Secret stored in the clear.`)
+
+  _, restErr = PatchOrg(someOrgID, []byte(`{"summary": "Hooked."}`), nulls.NewNullInt64(), ctx)
+  require.NoError(t, restErr, `Unexpected error patching org.`)
+  dispatcher := NewDispatcher()
+  dispatcher.BatchSize = 1000
+  dispatcher.Subscribe(`webhooks`, WebhookSink{})
+  _, err := dispatcher.DispatchPending(ctx)
+  require.NoError(t, err, `Unexpected error dispatching events.`)
+  deliverer := NewWebhookDeliverer()
+  deliverer.Sender = trustingSender(server)
+  _, err = deliverer.DeliverPending(ctx)
+  require.NoError(t, err, `Unexpected error delivering webhooks.`)
+
+  // Any earlier, retried events for the org are delivered too.
+  require.NotEmpty(t, rcv.bodies, `No deliveries.`)
+  var org Org
+  require.NoError(t, json.Unmarshal(rcv.bodies[len(rcv.bodies) - 1], &org), `Unexpected error decoding delivery.`)
+  assert.Equal(t, `Hooked.`, org.Summary.String, `Unexpected delivered org.`)
+  deliveries, restErr := ListWebhookDeliveries(hook.Id, 0, ctx)
+  require.NoError(t, restErr, `Unexpected error listing deliveries.`)
+  require.Len(t, deliveries, len(rcv.bodies), `Unexpected number of logged deliveries.`)
+  assert.True(t, deliveries[0].DeliveredAt.Valid, `Delivery not logged as delivered.`)
+  assert.Equal(t, int64(http.StatusOK), deliveries[0].Status.Int64, `Unexpected logged status.`)
+
+  require.NoError(t, DeleteWebhook(hook.Id, ctx), `Unexpected error deleting webhook.`)
+  _, restErr = GetWebhook(hook.Id, ctx)
+  assert.Error(t, restErr, `Unexpected non-error getting deleted webhook.`)
+}
@@ -20,6 +20,17 @@ orgPropsModel.push({
   model     : Address,
   valueType : arrayType,
   writable  : true})
+orgPropsModel.push({
+  propName            : 'parentPubId',
+  writable            : true,
+  optionalForComplete : true
+})
+orgPropsModel.push({
+  propName            : 'archivedAt',
+  unsetForNew         : true,
+  writable            : false,
+  optionalForComplete : true
+})
 orgPropsModel.push({
   propName            : 'changeDesc',
   unsetForNew         : true,